@@ -0,0 +1,4 @@
+drop procedure if exists get_trending;
+drop procedure if exists refresh_trending;
+drop table if exists trending_scores;
+drop table if exists trending_windows;
@@ -0,0 +1,70 @@
+create table if not exists trending_windows (
+	`name` varchar(8) not null,
+	`span` int unsigned not null,
+	`decay` int unsigned not null,
+
+	primary key (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- `span` is the length of the window, `decay` is the time after which an
+-- event weighs 1/e of a fresh one, both in seconds.
+insert ignore into trending_windows(name, span, decay) values
+	('24h', 86400, 21600),
+	('7d', 604800, 172800),
+	('30d', 2592000, 604800);
+
+create table if not exists trending_scores (
+	`type` enum('book', 'tv', 'movie') not null,
+	`item_id` bigint unsigned not null,
+	`time_window` varchar(8) not null,
+	`score` double not null,
+	`events` int unsigned not null,
+	`computed_at` timestamp default current_timestamp,
+
+	primary key (`time_window`, `type`, `item_id`),
+	key (`time_window`, `type`, `score`),
+	foreign key (`time_window`) references trending_windows(`name`) on delete cascade
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+create procedure if not exists refresh_trending()
+begin
+	declare exit handler for sqlexception
+	begin
+		rollback;
+		resignal;
+	end;
+
+	start transaction;
+	delete from trending_scores;
+	insert into trending_scores(type, item_id, time_window, score, events, computed_at)
+	-- `movie` and `tv` events refer to the same catalog.
+	select if(ue.type = 'movie', 'tv', ue.type) as item_type, ue.item_id, w.name,
+		sum(
+			case ue.event
+				when 'like' then 1.0
+				when 'playlist' then 0.5
+				when 'unplaylist' then -0.5
+				when 'dislike' then -1.0
+			end * exp(-timestampdiff(second, ue.timestamp, current_timestamp) / w.decay)
+		) as score,
+		count(*), current_timestamp
+	from user_events ue
+	join trending_windows w
+		on ue.timestamp >= timestampadd(second, -w.span, current_timestamp)
+	group by item_type, ue.item_id, w.name
+	having score > 0;
+	commit;
+end;
+
+create procedure if not exists get_trending(
+in p_type enum('book', 'tv', 'movie'),
+in p_window varchar(8),
+in p_limit int
+)
+begin
+	select item_id, score, events, computed_at
+	from trending_scores
+	where type=p_type and time_window=p_window
+	order by score desc, events desc
+	limit p_limit;
+end;
@@ -0,0 +1,33 @@
+drop procedure if exists refresh_trending;
+create procedure refresh_trending()
+begin
+	declare exit handler for sqlexception
+	begin
+		rollback;
+		resignal;
+	end;
+
+	start transaction;
+	delete from trending_scores;
+	insert into trending_scores(type, item_id, time_window, score, events, computed_at)
+	-- `movie` and `tv` events refer to the same catalog.
+	select if(ue.type = 'movie', 'tv', ue.type) as item_type, ue.item_id, w.name,
+		sum(
+			case ue.event
+				when 'like' then 1.0
+				when 'playlist' then 0.5
+				when 'unplaylist' then -0.5
+				when 'dislike' then -1.0
+			end * exp(-timestampdiff(second, ue.timestamp, current_timestamp) / w.decay)
+		) as score,
+		count(*), current_timestamp
+	from user_events ue
+	join trending_windows w
+		on ue.timestamp >= timestampadd(second, -w.span, current_timestamp)
+	group by item_type, ue.item_id, w.name
+	having score > 0;
+	commit;
+end;
+
+alter table trending_windows drop column `seed_weight`;
+drop table if exists seed_interactions;
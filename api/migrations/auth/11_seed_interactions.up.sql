@@ -0,0 +1,63 @@
+-- Anonymous interactions imported from the MovieLens ratings of The Movies
+-- Dataset. `seed_user` is the MovieLens user, it is unrelated to our users.
+create table if not exists seed_interactions (
+	`seed_user` bigint unsigned not null,
+	`event` enum('like', 'dislike') not null,
+	`type` enum('book', 'tv', 'movie') not null,
+	`item_id` bigint unsigned not null,
+	`rating` float not null,
+	`timestamp` timestamp null,
+
+	primary key (`seed_user`, `type`, `item_id`),
+	key (`type`, `item_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- `seed_weight` is how much a seed interaction weighs against a user event.
+alter table trending_windows add column `seed_weight` double not null default 0.1;
+
+-- The seed interactions are years old, they are shifted so that the newest
+-- one happened now.
+drop procedure if exists refresh_trending;
+create procedure refresh_trending()
+begin
+	declare seed_shift bigint default 0;
+	declare exit handler for sqlexception
+	begin
+		rollback;
+		resignal;
+	end;
+
+	select coalesce(timestampdiff(second, max(timestamp), current_timestamp), 0)
+	into seed_shift from seed_interactions;
+
+	start transaction;
+	delete from trending_scores;
+	insert into trending_scores(type, item_id, time_window, score, events, computed_at)
+	select e.item_type, e.item_id, w.name,
+		sum(e.weight * if(e.seed, w.seed_weight, 1.0)
+			* exp(-timestampdiff(second, e.at, current_timestamp) / w.decay)) as score,
+		count(*), current_timestamp
+	from (
+		-- `movie` and `tv` events refer to the same catalog.
+		select if(ue.type = 'movie', 'tv', ue.type) as item_type, ue.item_id,
+			case ue.event
+				when 'like' then 1.0
+				when 'playlist' then 0.5
+				when 'unplaylist' then -0.5
+				when 'dislike' then -1.0
+			end as weight,
+			ue.timestamp as at, false as seed
+		from user_events ue
+		union all
+		select if(si.type = 'movie', 'tv', si.type), si.item_id,
+			if(si.event = 'like', 1.0, -1.0),
+			timestampadd(second, seed_shift, si.timestamp), true
+		from seed_interactions si
+		where si.timestamp is not null
+	) e
+	join trending_windows w
+		on e.at >= timestampadd(second, -w.span, current_timestamp)
+	group by e.item_type, e.item_id, w.name
+	having score > 0;
+	commit;
+end;
@@ -0,0 +1,54 @@
+-- Only the events rewritten by the up migration become `tv` again, the ones
+-- pushed as `movie` since then stay as they are.
+update user_events ue join series_events_backup b
+	on b.source = 'user_events' and b.ID = ue.ID
+set ue.type = 'tv';
+update event_outbox o join series_events_backup b
+	on b.source = 'event_outbox' and b.ID = o.ID
+set o.type = 'tv';
+drop table if exists series_events_backup;
+
+drop procedure if exists refresh_trending;
+create procedure refresh_trending()
+begin
+	declare seed_shift bigint default 0;
+	declare exit handler for sqlexception
+	begin
+		rollback;
+		resignal;
+	end;
+
+	select coalesce(timestampdiff(second, max(timestamp), current_timestamp), 0)
+	into seed_shift from seed_interactions;
+
+	start transaction;
+	delete from trending_scores;
+	insert into trending_scores(type, item_id, time_window, score, events, computed_at)
+	select e.item_type, e.item_id, w.name,
+		sum(e.weight * if(e.seed, w.seed_weight, 1.0)
+			* exp(-timestampdiff(second, e.at, current_timestamp) / w.decay)) as score,
+		count(*), current_timestamp
+	from (
+		-- `movie` and `tv` events refer to the same catalog.
+		select if(ue.type = 'movie', 'tv', ue.type) as item_type, ue.item_id,
+			case ue.event
+				when 'like' then 1.0
+				when 'playlist' then 0.5
+				when 'unplaylist' then -0.5
+				when 'dislike' then -1.0
+			end as weight,
+			ue.timestamp as at, false as seed
+		from user_events ue
+		union all
+		select if(si.type = 'movie', 'tv', si.type), si.item_id,
+			if(si.event = 'like', 1.0, -1.0),
+			timestampadd(second, seed_shift, si.timestamp), true
+		from seed_interactions si
+		where si.timestamp is not null
+	) e
+	join trending_windows w
+		on e.at >= timestampadd(second, -w.span, current_timestamp)
+	group by e.item_type, e.item_id, w.name
+	having score > 0;
+	commit;
+end;
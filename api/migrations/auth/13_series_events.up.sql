@@ -0,0 +1,63 @@
+-- `tv` used to be another name for `movie`, now it is a TV series. The events
+-- recorded so far all refer to movies. The rewritten rows are kept in
+-- `series_events_backup`, so the down migration can bring `tv` back. The
+-- trending scores are recomputed from the events.
+create table if not exists series_events_backup(
+	`source` enum('user_events', 'event_outbox') not null,
+	`ID` bigint unsigned not null,
+
+	primary key (`source`, `ID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+insert ignore into series_events_backup(source, ID)
+select 'user_events', ID from user_events where type = 'tv';
+insert ignore into series_events_backup(source, ID)
+select 'event_outbox', ID from event_outbox where type = 'tv';
+
+update user_events set type = 'movie' where type = 'tv';
+update event_outbox set type = 'movie' where type = 'tv';
+delete from trending_scores where type = 'tv';
+
+drop procedure if exists refresh_trending;
+create procedure refresh_trending()
+begin
+	declare seed_shift bigint default 0;
+	declare exit handler for sqlexception
+	begin
+		rollback;
+		resignal;
+	end;
+
+	select coalesce(timestampdiff(second, max(timestamp), current_timestamp), 0)
+	into seed_shift from seed_interactions;
+
+	start transaction;
+	delete from trending_scores;
+	insert into trending_scores(type, item_id, time_window, score, events, computed_at)
+	select e.item_type, e.item_id, w.name,
+		sum(e.weight * if(e.seed, w.seed_weight, 1.0)
+			* exp(-timestampdiff(second, e.at, current_timestamp) / w.decay)) as score,
+		count(*), current_timestamp
+	from (
+		select ue.type as item_type, ue.item_id,
+			case ue.event
+				when 'like' then 1.0
+				when 'playlist' then 0.5
+				when 'unplaylist' then -0.5
+				when 'dislike' then -1.0
+			end as weight,
+			ue.timestamp as at, false as seed
+		from user_events ue
+		union all
+		select si.type, si.item_id,
+			if(si.event = 'like', 1.0, -1.0),
+			timestampadd(second, seed_shift, si.timestamp), true
+		from seed_interactions si
+		where si.timestamp is not null
+	) e
+	join trending_windows w
+		on e.at >= timestampadd(second, -w.span, current_timestamp)
+	group by e.item_type, e.item_id, w.name
+	having score > 0;
+	commit;
+end;
@@ -0,0 +1,12 @@
+-- The outbox IDs can commit out of order, so the rows delivered to a sink are
+-- tracked one by one. `event_outbox_cursors.last_id` becomes the low-water
+-- mark: every row up to it has been delivered, the deliveries below it are
+-- dropped.
+create table if not exists event_outbox_deliveries(
+	`sink` varchar(64) not null,
+	`outbox_id` bigint unsigned not null,
+	`delivered_at` timestamp default current_timestamp,
+
+	primary key (`sink`, `outbox_id`),
+	foreign key (`outbox_id`) references event_outbox(`ID`) on delete cascade
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
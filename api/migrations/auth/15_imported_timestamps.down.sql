@@ -0,0 +1,28 @@
+drop procedure if exists push_events_at;
+
+drop procedure if exists push_events;
+create procedure push_events(
+in p_token varchar(512), 
+in p_event enum('like', 'dislike', 'playlist', 'unplaylist'), 
+in p_type enum('book', 'tv', 'movie', 'concert'),
+in p_item_id bigint unsigned
+)
+begin
+	declare v_event_id bigint unsigned;
+	declare exit handler for sqlexception
+	begin
+		rollback;
+		resignal;
+	end;
+
+	start transaction;
+	insert into user_events(token, event, type, item_id, timestamp) 
+	values (p_token, p_event, p_type, p_item_id, current_timestamp);
+	set v_event_id = last_insert_id();
+
+	insert into event_outbox(event_id, user_id, event, type, item_id)
+	select v_event_id, ult.user_id, p_event, p_type, p_item_id
+	from user_login_timestamps ult
+	where ult.token = p_token;
+	commit;
+end;
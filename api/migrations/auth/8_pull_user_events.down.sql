@@ -0,0 +1 @@
+drop procedure if exists pull_user_events;
@@ -0,0 +1,8 @@
+create procedure if not exists pull_user_events(in p_user_id bigint unsigned)
+begin
+	select ue.item_id, ue.event, ue.type, ue.timestamp
+	from user_events ue
+	join user_login_timestamps ult on ult.token = ue.token
+	where ult.user_id = p_user_id
+	order by ue.timestamp, ue.ID;
+end;
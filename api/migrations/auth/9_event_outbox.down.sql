@@ -0,0 +1,15 @@
+drop procedure if exists push_events;
+
+create procedure push_events(
+in p_token varchar(512), 
+in p_event enum('like', 'dislike', 'playlist', 'unplaylist'), 
+in p_type enum('book', 'tv', 'movie'),
+in p_item_id bigint unsigned
+)
+begin
+	insert into user_events(token, event, type, item_id, timestamp) 
+	values (p_token, p_event, p_type, p_item_id, current_timestamp);
+end;
+
+drop table if exists event_outbox_cursors;
+drop table if exists event_outbox;
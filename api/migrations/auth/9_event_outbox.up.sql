@@ -0,0 +1,50 @@
+create table if not exists event_outbox(
+	`ID` bigint unsigned auto_increment,
+	`event_id` bigint unsigned not null,
+	`user_id` bigint unsigned not null,
+	`event` enum('like', 'dislike', 'playlist', 'unplaylist') not null,
+	`type` enum('book', 'tv', 'movie') not null,
+	`item_id` bigint unsigned not null,
+	`created_at` timestamp default current_timestamp,
+
+	primary key (`ID`),
+	foreign key (`event_id`) references user_events(`ID`) on delete cascade
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+create table if not exists event_outbox_cursors(
+	`sink` varchar(64) not null,
+	`last_id` bigint unsigned not null default 0,
+	`attempts` int unsigned not null default 0,
+	`last_error` varchar(512) null,
+	`next_attempt_at` timestamp default current_timestamp,
+
+	primary key (`sink`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+drop procedure if exists push_events;
+
+create procedure push_events(
+in p_token varchar(512), 
+in p_event enum('like', 'dislike', 'playlist', 'unplaylist'), 
+in p_type enum('book', 'tv', 'movie'),
+in p_item_id bigint unsigned
+)
+begin
+	declare v_event_id bigint unsigned;
+	declare exit handler for sqlexception
+	begin
+		rollback;
+		resignal;
+	end;
+
+	start transaction;
+	insert into user_events(token, event, type, item_id, timestamp) 
+	values (p_token, p_event, p_type, p_item_id, current_timestamp);
+	set v_event_id = last_insert_id();
+
+	insert into event_outbox(event_id, user_id, event, type, item_id)
+	select v_event_id, ult.user_id, p_event, p_type, p_item_id
+	from user_login_timestamps ult
+	where ult.token = p_token;
+	commit;
+end;
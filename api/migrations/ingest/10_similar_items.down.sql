@@ -0,0 +1,2 @@
+drop procedure if exists get_similar_movies;
+drop procedure if exists get_similar_books;
@@ -0,0 +1,54 @@
+create procedure if not exists get_similar_movies (in p_movie_id bigint unsigned, in p_limit int)
+begin
+   select s.movie_id, sum(s.weight) as score, group_concat(distinct s.kind)
+   from (
+      select b.movie_id, 3 as weight, 'genres' as kind
+      from movie2genres a
+      join movie2genres b on b.genre_id = a.genre_id and b.movie_id <> a.movie_id
+      where a.movie_id = p_movie_id
+      union all
+      select b.movie_id, 1, 'keywords'
+      from movie2keywords a
+      join movie2keywords b on b.keyword_id = a.keyword_id and b.movie_id <> a.movie_id
+      where a.movie_id = p_movie_id
+      union all
+      select b.movie_id, 2, 'companies'
+      from movie2companies a
+      join movie2companies b on b.company_id = a.company_id and b.movie_id <> a.movie_id
+      where a.movie_id = p_movie_id
+      union all
+      select b.movie_id, 1, 'languages'
+      from movie2languages a
+      join movie2languages b on b.language_encoding = a.language_encoding and b.movie_id <> a.movie_id
+      where a.movie_id = p_movie_id
+   ) s
+   join movies m on m.tmdb_id = s.movie_id
+   group by s.movie_id, m.popularity
+   order by score desc, m.popularity desc
+   limit p_limit;
+end;
+
+create procedure if not exists get_similar_books (in p_book_id bigint unsigned, in p_limit int)
+begin
+   select s.book_id, sum(s.weight) as score, group_concat(distinct s.kind)
+   from (
+      select b.book_id, 3 as weight, 'authors' as kind
+      from authors a
+      join authors b on b.author = a.author and b.book_id <> a.book_id
+      where a.book_id = p_book_id
+      union all
+      select b.ID, 2, 'publisher'
+      from books a
+      join books b on b.publisher = a.publisher and b.ID <> a.ID
+      where a.ID = p_book_id and a.publisher <> ''
+      union all
+      select b.ID, 1, 'language'
+      from books a
+      join books b on b.language = a.language and b.ID <> a.ID
+      where a.ID = p_book_id
+   ) s
+   join books bk on bk.ID = s.book_id
+   group by s.book_id, bk.total_ratings
+   order by score desc, bk.total_ratings desc
+   limit p_limit;
+end;
@@ -0,0 +1,5 @@
+drop procedure if exists get_new_movies;
+drop procedure if exists get_new_books;
+drop procedure if exists get_popular_movies_in_genres;
+alter table books drop column created_at;
+alter table movies drop column created_at;
@@ -0,0 +1,37 @@
+alter table movies
+add column created_at timestamp default current_timestamp;
+
+alter table books
+add column created_at timestamp default current_timestamp;
+
+create procedure if not exists get_new_movies (in p_since timestamp, in p_limit int)
+begin
+   select m.tmdb_id
+   from movies m
+   where m.created_at > p_since
+   order by m.created_at desc, m.popularity desc
+   limit p_limit;
+end;
+
+create procedure if not exists get_new_books (in p_since timestamp, in p_limit int)
+begin
+   select b.ID
+   from books b
+   where b.created_at > p_since
+   order by b.created_at desc, b.total_ratings desc
+   limit p_limit;
+end;
+
+create procedure if not exists get_popular_movies_in_genres (in p_genres text, in p_limit int)
+begin
+   select m.tmdb_id
+   from movies m
+   where exists (
+      select 1
+      from movie2genres m2g
+      join genres g on g.ID = m2g.genre_id
+      where m2g.movie_id = m.tmdb_id and find_in_set(g.genre, p_genres)
+   )
+   order by m.popularity desc
+   limit p_limit;
+end;
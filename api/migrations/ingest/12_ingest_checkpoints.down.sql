@@ -0,0 +1 @@
+drop table if exists ingest_checkpoints;
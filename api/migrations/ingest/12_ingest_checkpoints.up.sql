@@ -0,0 +1,12 @@
+create table if not exists ingest_checkpoints (
+	file varchar(512) not null,
+	byte_offset bigint unsigned not null default 0,
+	rows_read bigint unsigned not null default 0,
+	file_hash char(64) not null,
+	completed bool not null default false,
+	updated_at timestamp default current_timestamp on update current_timestamp,
+	primary key (file)
+)
+ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
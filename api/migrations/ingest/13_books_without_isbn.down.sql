@@ -0,0 +1,4 @@
+delete from books where isbn='' and isbn13='';
+alter table books
+	drop index isbn_pair,
+	add unique key isbn (isbn, isbn13);
@@ -0,0 +1,5 @@
+-- The books-data dataset has no ISBN, such books are stored with empty ones.
+-- Only the known ISBNs have to be unique.
+alter table books
+	drop index isbn,
+	add unique key isbn_pair ((nullif(isbn, '')), (nullif(isbn13, '')));
@@ -0,0 +1,6 @@
+drop procedure if exists find_concerts;
+drop procedure if exists get_concert_by_id;
+drop table if exists events;
+drop table if exists venues;
+drop table if exists artists;
+delete from read_table where directory='concerts-data';
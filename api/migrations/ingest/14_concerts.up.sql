@@ -0,0 +1,96 @@
+insert ignore into read_table(directory, data_type) values
+	('concerts-data', 'music');
+
+create table if not exists artists (
+	ID bigint unsigned auto_increment,
+	name varchar(256) not null,
+	genre varchar(64) null,
+	country char(2) null,
+	primary key (ID),
+	unique key (name)
+)
+ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
+
+create table if not exists venues (
+	ID bigint unsigned auto_increment,
+	name varchar(256) not null,
+	city varchar(128) not null,
+	country char(2) null,
+	latitude double null,
+	longitude double null,
+	primary key (ID),
+	unique key (name, city),
+	key (city)
+)
+ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
+
+-- `external_id` is the id of the event in the source file, re-imported events
+-- are updated.
+create table if not exists events (
+	ID bigint unsigned auto_increment,
+	external_id varchar(128) not null,
+	title varchar(256) not null,
+	artist_id bigint unsigned not null,
+	venue_id bigint unsigned not null,
+	starts_at datetime not null,
+	status enum('scheduled', 'postponed', 'cancelled', 'sold_out') default 'scheduled',
+	ticket_url varchar(512) null,
+	created_at timestamp default current_timestamp,
+	updated_at timestamp default current_timestamp on update current_timestamp,
+	primary key (ID),
+	unique key (external_id),
+	key (starts_at),
+	foreign key (artist_id) references artists(ID) on delete cascade,
+	foreign key (venue_id) references venues(ID) on delete cascade
+)
+ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
+
+create procedure if not exists get_concert_by_id (in p_id bigint unsigned)
+begin
+   select e.ID, e.external_id, e.title, e.starts_at, e.status,
+      coalesce(e.ticket_url, ''), a.name, coalesce(a.genre, ''),
+      coalesce(a.country, ''), v.name, v.city, coalesce(v.country, ''),
+      v.latitude, v.longitude
+   from events e
+   join artists a on a.ID = e.artist_id
+   join venues v on v.ID = e.venue_id
+   where e.ID = p_id;
+end;
+
+-- Every filter is optional, null skips it. The distance is in kilometres.
+create procedure if not exists find_concerts (
+in p_from datetime,
+in p_to datetime,
+in p_city varchar(128),
+in p_country char(2),
+in p_artist varchar(256),
+in p_lat double,
+in p_lon double,
+in p_radius double,
+in p_limit int
+)
+begin
+   select e.ID, e.external_id, e.title, e.starts_at, e.status,
+      coalesce(e.ticket_url, ''), a.name, coalesce(a.genre, ''),
+      coalesce(a.country, ''), v.name, v.city, coalesce(v.country, ''),
+      v.latitude, v.longitude
+   from events e
+   join artists a on a.ID = e.artist_id
+   join venues v on v.ID = e.venue_id
+   where (p_from is null or e.starts_at >= p_from)
+      and (p_to is null or e.starts_at < p_to)
+      and (p_city is null or v.city = p_city)
+      and (p_country is null or v.country = p_country)
+      and (p_artist is null or a.name like concat('%', p_artist, '%'))
+      and (p_lat is null or p_lon is null or (v.latitude is not null
+         and st_distance_sphere(point(v.longitude, v.latitude),
+            point(p_lon, p_lat)) <= p_radius * 1000))
+   order by e.starts_at, e.ID
+   limit p_limit;
+end;
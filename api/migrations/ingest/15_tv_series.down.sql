@@ -0,0 +1,12 @@
+drop procedure if exists get_changed_series;
+drop procedure if exists get_similar_series;
+drop procedure if exists get_series_genres;
+drop procedure if exists get_series_networks;
+drop procedure if exists get_series_seasons;
+drop procedure if exists find_series_id;
+drop procedure if exists get_series_by_id;
+drop table if exists series2genres;
+drop table if exists series2networks;
+drop table if exists networks;
+drop table if exists seasons;
+drop table if exists series;
@@ -0,0 +1,170 @@
+-- TV series have their own TMDB ids, they used to be loaded into `movies`
+-- where the ids collide with the movie ones.
+create table if not exists series (
+	ID bigint unsigned auto_increment,
+	tmdb_id bigint unsigned not null,
+	language char(2) null,
+	title varchar(256) not null,
+	original_title varchar(256) null,
+	overview varchar(2048) null,
+	popularity float null,
+	first_air_date date null,
+	last_air_date date null,
+	number_of_seasons smallint unsigned not null default 0,
+	number_of_episodes int unsigned not null default 0,
+	episode_runtime smallint unsigned null,
+	status enum ('Returning Series', 'Planned', 'In Production', 'Ended',
+		'Canceled', 'Pilot', 'N/A') default 'N/A',
+	in_production bool not null default false,
+	tagline varchar(128) null,
+	rating float default 0,
+	total_ratings bigint unsigned default 0,
+	created_at timestamp default current_timestamp,
+	updated_at timestamp default current_timestamp on update current_timestamp,
+
+	primary key (ID),
+	unique key (tmdb_id),
+	key (popularity)
+)
+ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
+
+create table if not exists seasons (
+	ID bigint unsigned auto_increment,
+	series_id bigint unsigned not null,
+	season_number smallint unsigned not null,
+	name varchar(256) not null,
+	overview varchar(2048) null,
+	air_date date null,
+	episode_count int unsigned not null default 0,
+
+	primary key (ID),
+	unique key (series_id, season_number),
+	foreign key (series_id) references series(tmdb_id) on delete cascade
+)
+ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
+
+-- `ID` is the TMDB id of the network.
+create table if not exists networks (
+	ID bigint unsigned not null,
+	name varchar(128) not null,
+	country char(2) null,
+
+	primary key (ID)
+)
+ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
+
+create table if not exists series2networks (
+	ID bigint unsigned auto_increment,
+	series_id bigint unsigned not null,
+	network_id bigint unsigned not null,
+
+	primary key (ID),
+	unique key (series_id, network_id),
+	foreign key (series_id) references series(tmdb_id) on delete cascade,
+	foreign key (network_id) references networks(ID) on delete cascade
+)
+ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
+
+create table if not exists series2genres (
+	ID bigint unsigned auto_increment,
+	series_id bigint unsigned not null,
+	genre_id bigint unsigned not null,
+
+	primary key (ID),
+	unique key (series_id, genre_id),
+	foreign key (series_id) references series(tmdb_id) on delete cascade,
+	foreign key (genre_id) references genres(ID) on delete cascade
+)
+ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
+
+create procedure if not exists get_series_by_id (in p_series_id bigint unsigned)
+begin
+   select ID, tmdb_id, language, title, original_title, overview, popularity,
+      first_air_date, last_air_date, number_of_seasons, number_of_episodes,
+      episode_runtime, status, in_production, tagline, rating, total_ratings
+   from series s
+   where s.tmdb_id = p_series_id;
+end;
+
+create procedure if not exists find_series_id (in q_title varchar(255))
+begin
+   select tmdb_id
+   from series s
+   where s.title like concat('%', q_title, '%')
+      or s.original_title like concat('%', q_title, '%')
+   order by s.popularity desc
+   limit 1;
+end;
+
+create procedure if not exists get_series_seasons (in p_series_id bigint unsigned)
+begin
+   select season_number, name, overview, air_date, episode_count
+   from seasons
+   where series_id = p_series_id
+   order by season_number;
+end;
+
+create procedure if not exists get_series_networks (in p_series_id bigint unsigned)
+begin
+   select n.ID, n.name, n.country
+   from networks n
+   join series2networks s2n on s2n.network_id = n.ID and s2n.series_id = p_series_id;
+end;
+
+create procedure if not exists get_series_genres (in p_series_id bigint unsigned)
+begin
+   select g.ID, g.genre
+   from genres g
+   join series2genres s2g on s2g.genre_id = g.ID and s2g.series_id = p_series_id;
+end;
+
+create procedure if not exists get_similar_series (in p_series_id bigint unsigned, in p_limit int)
+begin
+   select s.series_id, sum(s.weight) as score, group_concat(distinct s.kind)
+   from (
+      select b.series_id, 3 as weight, 'genres' as kind
+      from series2genres a
+      join series2genres b on b.genre_id = a.genre_id and b.series_id <> a.series_id
+      where a.series_id = p_series_id
+      union all
+      select b.series_id, 2, 'networks'
+      from series2networks a
+      join series2networks b on b.network_id = a.network_id and b.series_id <> a.series_id
+      where a.series_id = p_series_id
+      union all
+      select b.tmdb_id, 1, 'language'
+      from series a
+      join series b on b.language = a.language and b.tmdb_id <> a.tmdb_id
+      where a.tmdb_id = p_series_id
+   ) s
+   join series sr on sr.tmdb_id = s.series_id
+   group by s.series_id, sr.popularity
+   order by score desc, sr.popularity desc
+   limit p_limit;
+end;
+
+create procedure if not exists get_changed_series (in p_since timestamp)
+begin
+   select s.tmdb_id, s.title, coalesce(s.overview, ''),
+      coalesce((select group_concat(g.genre separator '|')
+         from series2genres s2g
+         join genres g on g.ID = s2g.genre_id
+         where s2g.series_id = s.tmdb_id), ''),
+      coalesce((select group_concat(n.name separator '|')
+         from series2networks s2n
+         join networks n on n.ID = s2n.network_id
+         where s2n.series_id = s.tmdb_id), '')
+   from series s
+   where s.updated_at > p_since
+   order by s.tmdb_id;
+end;
@@ -0,0 +1,9 @@
+drop procedure if exists get_catalog_history;
+drop procedure if exists get_refresh_candidates;
+drop table if exists catalog_history;
+
+alter table series
+drop column refreshed_at;
+
+alter table movies
+drop column refreshed_at;
@@ -0,0 +1,66 @@
+alter table movies
+add column refreshed_at timestamp null;
+
+alter table series
+add column refreshed_at timestamp null;
+
+-- Every change made by the refresher, one row per changed field. The values
+-- are kept as text, `status` is not a number.
+create table if not exists catalog_history (
+	ID bigint unsigned auto_increment,
+	type enum('movie', 'tv') not null,
+	tmdb_id bigint unsigned not null,
+	field enum('popularity', 'rating', 'total_ratings', 'status') not null,
+	old_value varchar(32) null,
+	new_value varchar(32) null,
+	changed_at timestamp default current_timestamp,
+
+	primary key (ID),
+	key (type, tmdb_id, field, changed_at)
+)
+ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
+
+-- get_refresh_candidates returns the titles not refreshed for at least
+-- p_min_age seconds, the most viewed in the last week first, then the
+-- stalest ones.
+create procedure if not exists get_refresh_candidates (
+in p_type enum('movie', 'tv'),
+in p_min_age int unsigned,
+in p_limit int
+)
+begin
+   declare p_before timestamp default timestampadd(second, -p_min_age, current_timestamp);
+   select c.tmdb_id
+   from (
+      select m.tmdb_id, coalesce(m.refreshed_at, m.updated_at) as refreshed_at
+      from movies m
+      where p_type = 'movie'
+      union all
+      select s.tmdb_id, coalesce(s.refreshed_at, s.updated_at)
+      from series s
+      where p_type = 'tv'
+   ) c
+   left join (
+      select ue.item_id, count(*) as views
+      from user_events ue
+      where ue.type = p_type
+         and ue.timestamp >= timestampadd(day, -7, current_timestamp)
+      group by ue.item_id
+   ) v on v.item_id = c.tmdb_id
+   where c.refreshed_at is null or c.refreshed_at < p_before
+   order by coalesce(v.views, 0) desc, c.refreshed_at asc
+   limit p_limit;
+end;
+
+create procedure if not exists get_catalog_history (
+in p_type enum('movie', 'tv'),
+in p_tmdb_id bigint unsigned
+)
+begin
+   select field, old_value, new_value, changed_at
+   from catalog_history
+   where type = p_type and tmdb_id = p_tmdb_id
+   order by changed_at, ID;
+end;
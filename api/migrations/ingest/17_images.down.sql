@@ -0,0 +1,25 @@
+drop procedure if exists get_production_companies;
+create procedure if not exists get_production_companies (in movie_id bigint unsigned)
+begin
+   select c.ID, c.company 
+   from companies c
+   join movie2companies m2c on c.ID = m2c.company_id and m2c.movie_id=movie_id;
+end;
+
+drop procedure if exists get_book_cover;
+drop procedure if exists get_series_images;
+drop procedure if exists get_movie_images;
+
+alter table books
+drop column cover_url;
+
+alter table companies
+drop column logo_path;
+
+alter table series
+drop column poster_path,
+drop column backdrop_path;
+
+alter table movies
+drop column poster_path,
+drop column backdrop_path;
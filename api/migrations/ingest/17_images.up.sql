@@ -0,0 +1,46 @@
+-- The image paths of TMDB, e.g. `/kqjL17yufvn9OVLyXYpvtyrFfak.jpg`, are kept
+-- without the host and the size, the services build the URLs.
+alter table movies
+add column poster_path varchar(64) null,
+add column backdrop_path varchar(64) null;
+
+alter table series
+add column poster_path varchar(64) null,
+add column backdrop_path varchar(64) null;
+
+alter table companies
+add column logo_path varchar(64) null;
+
+-- The cover of a book is a full URL given by the dataset, the books without
+-- one get the cover of their ISBN.
+alter table books
+add column cover_url varchar(512) null;
+
+create procedure if not exists get_movie_images (in movie_id bigint unsigned)
+begin
+   select poster_path, backdrop_path
+   from movies m
+   where m.tmdb_id=movie_id;
+end;
+
+create procedure if not exists get_series_images (in p_series_id bigint unsigned)
+begin
+   select poster_path, backdrop_path
+   from series s
+   where s.tmdb_id=p_series_id;
+end;
+
+create procedure if not exists get_book_cover (in book_id bigint unsigned)
+begin
+   select cover_url
+   from books b
+   where b.ID=book_id;
+end;
+
+drop procedure if exists get_production_companies;
+create procedure if not exists get_production_companies (in movie_id bigint unsigned)
+begin
+   select c.ID, c.company, c.logo_path
+   from companies c
+   join movie2companies m2c on c.ID = m2c.company_id and m2c.movie_id=movie_id;
+end;
@@ -0,0 +1,2 @@
+drop table if exists ingest_dead_letters;
+drop table if exists ingest_reports;
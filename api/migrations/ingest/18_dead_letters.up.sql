@@ -0,0 +1,33 @@
+-- Every load of the datasets, the summary holds the rows read, accepted and
+-- rejected per reason of every file.
+create table if not exists ingest_reports (
+	ID bigint unsigned auto_increment,
+	started_at timestamp default current_timestamp,
+	finished_at timestamp null,
+	summary json null,
+
+	primary key (ID)
+)
+ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
+
+-- The rows rejected during a load. `line` is the number of the record counted
+-- from 1, the CSV header included.
+create table if not exists ingest_dead_letters (
+	ID bigint unsigned auto_increment,
+	report_id bigint unsigned not null,
+	file varchar(512) not null,
+	line bigint unsigned not null,
+	reason varchar(128) not null,
+	error text not null,
+	raw mediumtext not null,
+	created_at timestamp default current_timestamp,
+
+	primary key (ID),
+	key (report_id, reason),
+	foreign key (report_id) references ingest_reports(ID) on delete cascade
+)
+ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,21 @@
+-- Every run of a loading source: a dataset of the load on start or the bulk
+-- ingestion. `loaders` holds the rows loaded and failed, with the errors, of
+-- every loader of the run.
+create table if not exists ingest_runs (
+	ID bigint unsigned auto_increment,
+	source varchar(64) not null,
+	status enum('running', 'completed', 'failed') not null default 'running',
+	report_id bigint unsigned null,
+	started_at timestamp default current_timestamp,
+	finished_at timestamp null,
+	loaded bigint unsigned not null default 0,
+	loaders json null,
+	error text null,
+
+	primary key (ID),
+	key (source, started_at),
+	foreign key (report_id) references ingest_reports(ID) on delete set null
+)
+ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,2 @@
+-- The foreign key needs an index on book_id once the unique key is gone.
+alter table authors add key authors_book (book_id), drop index authors_book_author;
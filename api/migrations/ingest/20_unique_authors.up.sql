@@ -0,0 +1,7 @@
+-- Resumed and repeated loads insert the authors of a book again, the unique
+-- key makes `insert ignore` skip them. The duplicates already stored are
+-- removed first, the oldest row is kept.
+delete a from authors a
+join authors b on b.book_id = a.book_id and b.author = a.author and b.ID < a.ID;
+
+alter table authors add unique key authors_book_author (book_id, author);
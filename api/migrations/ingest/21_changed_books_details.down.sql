@@ -0,0 +1,8 @@
+drop procedure if exists get_changed_books;
+create procedure get_changed_books (in p_since timestamp)
+begin
+   select b.ID, b.title
+   from books b
+   where b.updated_at > p_since
+   order by b.ID;
+end;
@@ -0,0 +1,14 @@
+-- The books are synced with their authors, publisher and language, they are
+-- the keywords of the book in the recommendation service.
+drop procedure if exists get_changed_books;
+create procedure get_changed_books (in p_since timestamp)
+begin
+   select b.ID, b.title,
+      coalesce((select group_concat(a.author order by a.ID separator '|')
+         from authors a
+         where a.book_id = b.ID), ''),
+      coalesce(b.publisher, ''), coalesce(b.language, '')
+   from books b
+   where b.updated_at > p_since
+   order by b.ID;
+end;
@@ -0,0 +1,52 @@
+-- The changed items are compared with `>=` and return their `updated_at`, the
+-- sync is stamped with the latest one it sent. The items updated in the same
+-- second as the last sync are sent again rather than missed.
+drop procedure if exists get_changed_movies;
+create procedure get_changed_movies (in p_since timestamp)
+begin
+   select m.tmdb_id, m.title, coalesce(m.overview, ''),
+      coalesce((select group_concat(g.genre separator '|')
+         from movie2genres m2g
+         join genres g on g.ID = m2g.genre_id
+         where m2g.movie_id = m.tmdb_id), ''),
+      coalesce((select group_concat(k.keyword separator '|')
+         from movie2keywords m2k
+         join keywords k on k.ID = m2k.keyword_id
+         where m2k.movie_id = m.tmdb_id), ''),
+      m.updated_at
+   from movies m
+   where m.updated_at >= p_since
+   order by m.tmdb_id;
+end;
+
+drop procedure if exists get_changed_series;
+create procedure get_changed_series (in p_since timestamp)
+begin
+   select s.tmdb_id, s.title, coalesce(s.overview, ''),
+      coalesce((select group_concat(g.genre separator '|')
+         from series2genres s2g
+         join genres g on g.ID = s2g.genre_id
+         where s2g.series_id = s.tmdb_id), ''),
+      coalesce((select group_concat(n.name separator '|')
+         from series2networks s2n
+         join networks n on n.ID = s2n.network_id
+         where s2n.series_id = s.tmdb_id), ''),
+      s.updated_at
+   from series s
+   where s.updated_at >= p_since
+   order by s.tmdb_id;
+end;
+
+drop procedure if exists get_changed_books;
+create procedure get_changed_books (in p_since timestamp)
+begin
+   select b.ID, b.title,
+      coalesce((select group_concat(a.author order by a.ID separator '|')
+         from authors a
+         where a.book_id = b.ID), ''),
+      coalesce(b.publisher, ''), coalesce(b.language, ''),
+      b.updated_at
+   from books b
+   where b.updated_at >= p_since
+   order by b.ID;
+end;
@@ -0,0 +1,38 @@
+drop procedure if exists refresh_summaries;
+drop table if exists summary_refreshes;
+drop table if exists default_books_recommendation;
+drop table if exists top_100_books;
+drop table if exists default_shows_recommendation;
+drop table if exists top_100_shows;
+
+-- `8_the_most_popular.down` drops the views, they're brought back as plain
+-- views, because MySQL can't create the materialized ones.
+create view top_100_shows as
+select ID, budget, tmdb_id, language, title, overview,
+	popularity, release_date, revenue, runtime, status,
+	tagline, rating, total_ratings
+from movies
+order by popularity desc
+limit 100;
+
+create view top_100_books as
+select ID, title, isbn, isbn13, language, pages, release_date, publisher, 
+	rating, total_ratings
+from books 
+order by total_ratings desc, rating desc
+limit 100;
+
+create view default_shows_recommendation as
+select ID, budget, tmdb_id, language, title, overview,
+	popularity, release_date, revenue, runtime, status,
+	tagline, rating, total_ratings
+from movies
+order by popularity desc
+limit 25;
+
+create view default_books_recommendation as
+select ID, title, isbn, isbn13, language, pages, release_date, publisher, 
+	rating, total_ratings
+from books 
+order by total_ratings desc, rating desc
+limit 25;
@@ -0,0 +1,113 @@
+-- MySQL has no materialized views, the summaries are plain tables filled by
+-- `refresh_summaries`. `position` keeps the ranking. The views are dropped in
+-- case `8_the_most_popular` was run by a database that supports them.
+drop view if exists top_100_shows;
+drop view if exists top_100_books;
+drop view if exists default_shows_recommendation;
+drop view if exists default_books_recommendation;
+
+create table if not exists top_100_shows (
+	position int unsigned not null,
+	ID bigint unsigned not null,
+	budget bigint unsigned null,
+	tmdb_id bigint unsigned not null,
+	language char(2) null,
+	title varchar(256) not null,
+	overview varchar(2048) null,
+	popularity float null,
+	release_date date null,
+	revenue bigint null,
+	runtime smallint unsigned null,
+	status enum ('Released', 'Rumored', 'Post Production', 'N/A') default 'N/A',
+	tagline varchar(128) null,
+	rating float default 0,
+	total_ratings bigint unsigned default 0,
+
+	primary key (position)
+)
+ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
+
+create table if not exists default_shows_recommendation like top_100_shows;
+
+create table if not exists top_100_books (
+	position int unsigned not null,
+	ID bigint unsigned not null,
+	title varchar(128) not null,
+	isbn char(10) not null,
+	isbn13 char(13) not null,
+	language varchar(3),
+	pages int,
+	release_date date null,
+	publisher varchar(128),
+	rating float not null,
+	total_ratings bigint unsigned,
+
+	primary key (position)
+)
+ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
+
+create table if not exists default_books_recommendation like top_100_books;
+
+create table if not exists summary_refreshes (
+	name varchar(64) not null,
+	refreshed_at timestamp null,
+	row_count bigint unsigned not null default 0,
+
+	primary key (name)
+)
+ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
+
+create procedure if not exists refresh_summaries()
+begin
+	declare exit handler for sqlexception
+	begin
+		rollback;
+		resignal;
+	end;
+
+	start transaction;
+	delete from top_100_shows;
+	insert into top_100_shows
+	select row_number() over (order by popularity desc, ID), ID, budget,
+		tmdb_id, language, title, overview, popularity, release_date, revenue,
+		runtime, status, tagline, rating, total_ratings
+	from movies
+	order by popularity desc, ID
+	limit 100;
+
+	delete from default_shows_recommendation;
+	insert into default_shows_recommendation
+	select * from top_100_shows where position <= 25;
+
+	delete from top_100_books;
+	insert into top_100_books
+	select row_number() over (order by total_ratings desc, rating desc, ID), ID,
+		title, isbn, isbn13, language, pages, release_date, publisher, rating,
+		total_ratings
+	from books
+	order by total_ratings desc, rating desc, ID
+	limit 100;
+
+	delete from default_books_recommendation;
+	insert into default_books_recommendation
+	select * from top_100_books where position <= 25;
+
+	insert into summary_refreshes(name, refreshed_at, row_count) values
+		('top_100_shows', current_timestamp, (select count(*) from top_100_shows)),
+		('default_shows_recommendation', current_timestamp,
+			(select count(*) from default_shows_recommendation)),
+		('top_100_books', current_timestamp, (select count(*) from top_100_books)),
+		('default_books_recommendation', current_timestamp,
+			(select count(*) from default_books_recommendation))
+	on duplicate key update
+		refreshed_at=values(refreshed_at), row_count=values(row_count);
+	commit;
+end;
+
+call refresh_summaries();
@@ -0,0 +1,5 @@
+drop procedure if exists get_changed_movies;
+drop procedure if exists get_changed_books;
+drop table if exists sync_state;
+alter table books drop column updated_at;
+alter table movies drop column updated_at;
@@ -0,0 +1,38 @@
+alter table movies
+add column updated_at timestamp default current_timestamp on update current_timestamp;
+
+alter table books
+add column updated_at timestamp default current_timestamp on update current_timestamp;
+
+create table if not exists sync_state (
+	target varchar(64) not null,
+	synced_at timestamp null,
+	primary key (target)
+)
+ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
+
+create procedure if not exists get_changed_movies (in p_since timestamp)
+begin
+   select m.tmdb_id, m.title, coalesce(m.overview, ''),
+      coalesce((select group_concat(g.genre separator '|')
+         from movie2genres m2g
+         join genres g on g.ID = m2g.genre_id
+         where m2g.movie_id = m.tmdb_id), ''),
+      coalesce((select group_concat(k.keyword separator '|')
+         from movie2keywords m2k
+         join keywords k on k.ID = m2k.keyword_id
+         where m2k.movie_id = m.tmdb_id), '')
+   from movies m
+   where m.updated_at > p_since
+   order by m.tmdb_id;
+end;
+
+create procedure if not exists get_changed_books (in p_since timestamp)
+begin
+   select b.ID, b.title
+   from books b
+   where b.updated_at > p_since
+   order by b.ID;
+end;
@@ -6,13 +6,19 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"os"
 
 	"github.com/sadsonkeenolee/IO_projekt/internal/services/auth"
 	"github.com/sadsonkeenolee/IO_projekt/internal/services/ingest"
 	"github.com/sadsonkeenolee/IO_projekt/internal/services/search"
+	"github.com/sadsonkeenolee/IO_projekt/internal/services/search/recommender"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/images"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/mlclient"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/outbox"
 	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/tmdb"
 	"github.com/sadsonkeenolee/IO_projekt/pkg/utils"
 )
 
@@ -26,6 +32,7 @@ var wipeFlag = flag.Bool("wipe", false, "wipe out a database")
 var versionFlag = flag.Int("version", 0, "value of migration")
 var serviceNameFlag = flag.String("service", "", "service name to run")
 var apiFlag = flag.String("api", "", "api key for TMDB")
+var resyncFlag = flag.Bool("resync", false, "push the whole catalog to the recommendation service (ingest)")
 
 const (
 	Invalid = iota
@@ -100,17 +107,13 @@ func main() {
 		EnvVariables["MIGRATIONS"] = ConstructMigrationPath(InitJoinedPath(EnvVariables["MIGRATIONS"], "ingest"))
 		if *apiFlag != "" {
 			EnvVariables["TMDB_API_KEY"] = *apiFlag
-			EnvVariables["TMDB_FETCH_MOVIE_BASIC"] = "https://api.themoviedb.org/3/search/tv?query=%v&include_adult=true&language=en-US&page=1"
-			EnvVariables["TMDB_FETCH_MOVIE_SPECIFIC"] = "https://api.themoviedb.org/3/tv/%v"
 		} else if !*migrateFlag {
-			MainLogger.Println("Missing TMDB API key for search service. Pass --api=\"<key>\" if you want the update functionality to work.")
+			MainLogger.Println("Missing TMDB API key for search service. Pass --api=\"<key>\" or set `Tmdb.api_key` if you want the update functionality to work.")
 		}
 	case Search:
 		EnvVariables["MIGRATIONS"] = ConstructMigrationPath(InitJoinedPath(EnvVariables["MIGRATIONS"], "search"))
 		if *apiFlag != "" {
 			EnvVariables["TMDB_API_KEY"] = *apiFlag
-			EnvVariables["TMDB_FETCH_MOVIE_BASIC"] = "https://api.themoviedb.org/3/search/tv?query=%v&include_adult=true&language=en-US&page=1"
-			EnvVariables["TMDB_FETCH_MOVIE_SPECIFIC"] = "https://api.themoviedb.org/3/tv/%v"
 		} else if !*migrateFlag {
 			MainLogger.Println("Missing TMDB API key for search service. Pass --api=\"<key>\" if you want the update functionality to work.")
 		}
@@ -140,12 +143,18 @@ func main() {
 		)
 		c := services.NewConnection("ConnInfo", v)
 		db := services.NewDatabase(c)
+		var r *outbox.Relay
+		if oc := outbox.NewConfig("Outbox", v); oc != nil {
+			r = outbox.NewRelay(db, l, oc, outbox.NewSinks(oc)...)
+		}
 		s = auth.AuthBuilder(
 			auth.WithLogger(l),
 			auth.WithRouter(ge),
 			auth.WithViper(v),
 			auth.WithConnectionInfo(c),
-			auth.WithDatabase(db))
+			auth.WithDatabase(db),
+			auth.WithEventBroker(auth.NewEventBroker()),
+			auth.WithOutboxRelay(r))
 	case Ingest:
 		l := services.NewLogger(
 			os.Stdout,
@@ -160,6 +169,10 @@ func main() {
 		)
 		c := services.NewConnection("ConnInfo", v)
 		db := services.NewDatabase(c)
+		var rc *mlclient.Client
+		if mc := mlclient.NewConfig("Recommender", v); mc != nil {
+			rc = mlclient.NewClient(mc)
+		}
 		s = ingest.IngestBuilder(
 			ingest.WithLogger(l),
 			ingest.WithRouter(ge),
@@ -167,6 +180,14 @@ func main() {
 			ingest.WithConnectionInfo(c),
 			ingest.WithDatabase(db),
 			ingest.WithBatch(256),
+			ingest.WithRecommender(rc),
+			ingest.WithFullResync(*resyncFlag),
+			ingest.WithSummariesInterval(v.GetInt("Summaries.interval")),
+			ingest.WithSeedConfig(ingest.NewSeedConfig("Seed", v)),
+			ingest.WithTmdb(tmdb.NewClient(tmdb.NewConfig("Tmdb", v))),
+			ingest.WithRefresherConfig(ingest.NewRefresherConfig("Refresher", v)),
+			ingest.WithBulkConfig(ingest.NewBulkConfig("Bulk", v)),
+			ingest.WithSources(ingest.NewSources("Sources", v)),
 		)
 	case Search:
 		l := services.NewLogger(
@@ -182,12 +203,25 @@ func main() {
 		)
 		c := services.NewConnection("ConnInfo", v)
 		db := services.NewDatabase(c)
+		// The recommendation service is used if configured, otherwise the
+		// in-process engine.
+		var rc search.Recommender = recommender.NewEngine(db, l,
+			recommender.NewConfig("Engine", v))
+		if mc := mlclient.NewConfig("Recommender", v); mc != nil {
+			rc = mlclient.NewClient(mc)
+		}
 		s = search.SearchBuilder(
 			search.WithLogger(l),
 			search.WithRouter(ge),
 			search.WithViper(v),
 			search.WithConnectionInfo(c),
 			search.WithDatabase(db),
+			search.WithRecommender(rc),
+			search.WithTrendingJob(search.NewTrendingJob(db, l,
+				search.NewTrendingConfig("Trending", v))),
+			search.WithSimilarCache(search.NewSimilarCache(search.SimilarCacheTtl*time.Second,
+				search.SimilarCacheSize)),
+			search.WithImages(images.NewConfig("Images", v)),
 		)
 	}
 
@@ -2,12 +2,15 @@
 package auth
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -22,6 +25,7 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/github"
 	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/outbox"
 	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
 )
 
@@ -37,6 +41,9 @@ const (
 
 type AuthService struct {
 	services.Service
+	Broker *EventBroker
+	// Relay is optional, without it the outbox is only written to.
+	Relay *outbox.Relay
 }
 
 func WithLogger(l *log.Logger) func(a *AuthService) {
@@ -69,6 +76,18 @@ func WithDatabase(db *sql.DB) func(a *AuthService) {
 	}
 }
 
+func WithEventBroker(b *EventBroker) func(a *AuthService) {
+	return func(a *AuthService) {
+		a.Broker = b
+	}
+}
+
+func WithOutboxRelay(r *outbox.Relay) func(a *AuthService) {
+	return func(a *AuthService) {
+		a.Relay = r
+	}
+}
+
 // Main constructor for the authorization service. Provide all necessary
 // functions into `opts` - they will be executed in the given order.
 func AuthBuilder(opts ...func(*AuthService)) services.IService {
@@ -90,6 +109,15 @@ func (a *AuthService) Start() error {
 		v1.POST("auth/register", a.OnUserRegister)
 		v1.POST("auth/event/push", a.OnUserEventPush)
 		v1.POST("auth/event/pull", a.OnUserEventPull)
+		v1.GET("auth/event/stream", a.OnUserEventStream)
+		v1.GET("auth/library/export", a.OnLibraryExport)
+		v1.POST("auth/library/import", a.OnLibraryImport)
+	}
+
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	defer stopRelay()
+	if a.Relay != nil {
+		go a.Relay.Run(relayCtx)
 	}
 
 	go func() {
@@ -102,6 +130,7 @@ func (a *AuthService) Start() error {
 	signal.Notify(kill, syscall.SIGINT, syscall.SIGTERM)
 	sig := <-kill
 	a.Logger.Printf("Gracefully shutting down the server: %v\n.", sig)
+	stopRelay()
 	a.State = services.StateDown
 	a.DB.Close()
 	return fmt.Errorf("server closed")
@@ -118,8 +147,7 @@ func (a *AuthService) OnUserEventPush(ctx *gin.Context) {
 		services.NewBadCredentialsCoreResponse(ctx, services.InvalidRequestMessage)
 		return
 	}
-	if _, err := a.DB.Exec(`call push_events(?, ?, ?, ?)`,
-		u.Token, u.EventName, u.ItemType, u.ItemId); err != nil {
+	if err := a.pushEvent(&u, time.Now()); err != nil {
 		services.NewBadCredentialsCoreResponse(ctx, services.InvalidRequestMessage)
 		a.Logger.Println(err)
 		return
@@ -127,6 +155,73 @@ func (a *AuthService) OnUserEventPush(ctx *gin.Context) {
 	services.NewGoodContentRequest(ctx, "added")
 }
 
+// pushEvent saves the event made at the given time, then notifies the user's
+// streams and wakes up the outbox relay.
+func (a *AuthService) pushEvent(u *database.UserEventPushRequest, at time.Time) error {
+	if _, err := a.DB.Exec(`call push_events_at(?, ?, ?, ?, ?)`,
+		u.Token, u.EventName, u.ItemType, u.ItemId, at); err != nil {
+		return err
+	}
+	a.PublishEvent(u, at)
+	if a.Relay != nil {
+		a.Relay.Notify()
+	}
+	return nil
+}
+
+// PublishEvent notifies every open stream of the user that pushed the event.
+func (a *AuthService) PublishEvent(u *database.UserEventPushRequest, at time.Time) {
+	userId, err := a.FetchUserIdByToken(u.Token)
+	if err != nil {
+		a.Logger.Printf("couldn't publish the event, reason: %v\n", err)
+		return
+	}
+	itemId, err := strconv.ParseUint(u.ItemId, 10, 64)
+	if err != nil {
+		a.Logger.Printf("couldn't publish the event, reason: %v\n", err)
+		return
+	}
+	a.Broker.Publish(userId, database.Event{
+		ItemId:    itemId,
+		Name:      u.EventName,
+		ItemType:  u.ItemType,
+		Timestamp: at.Unix(),
+	})
+}
+
+// OnUserEventStream keeps the connection open and pushes the user's events
+// as Server-Sent Events. The token is passed as a query parameter, because
+// the browser's EventSource can't set the request body nor headers.
+func (a *AuthService) OnUserEventStream(ctx *gin.Context) {
+	userId, err := a.FetchUserIdByToken(ctx.Query("access_token"))
+	if err != nil {
+		a.Logger.Println(err)
+		services.NewBadCredentialsCoreResponse(ctx, services.InvalidRequestMessage)
+		return
+	}
+
+	c := a.Broker.Subscribe(userId)
+	defer a.Broker.Unsubscribe(userId, c)
+	keepAlive := time.NewTicker(StreamKeepAlive * time.Second)
+	defer keepAlive.Stop()
+
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-c:
+			if !ok {
+				return false
+			}
+			ctx.SSEvent(event.Name, event)
+			return true
+		case <-keepAlive.C:
+			ctx.SSEvent("ping", time.Now().Unix())
+			return true
+		case <-ctx.Request.Context().Done():
+			return false
+		}
+	})
+}
+
 func (a *AuthService) OnUserEventPull(ctx *gin.Context) {
 	var u database.UserEventPushRequest
 	if err := ctx.ShouldBindBodyWithJSON(&u); err != nil {
@@ -208,6 +303,10 @@ func (a *AuthService) HealthCheck() error {
 	if a.ConfigReader == nil {
 		return fmt.Errorf("No config setup")
 	}
+
+	if a.Broker == nil {
+		return fmt.Errorf("No event broker setup")
+	}
 	return nil
 }
 
@@ -369,6 +468,12 @@ func (a *AuthService) FetchUser(username *string) (*services.User[[]byte], error
 	return &u, nil
 }
 
+// FetchUserIdByToken returns the owner of the session token, if the session is
+// still valid.
+func (a *AuthService) FetchUserIdByToken(token string) (uint64, error) {
+	return database.FetchUserIdByToken(a.DB, token)
+}
+
 // ExposeConnection exposes configuration.
 func (a *AuthService) ExposeConnection() *services.Connection {
 	return a.ConnInfo
@@ -0,0 +1,339 @@
+package auth
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
+)
+
+const (
+	// MaxImportSize limits the size (in bytes) of the uploaded library.
+	MaxImportSize = 8 << 20
+)
+
+// LibraryCsvHeader is the header of the exported (and importable) CSV.
+var LibraryCsvHeader = []string{"id", "name", "type", "timestamp"}
+
+// importedRow is a single row of an imported file, before it's matched to the
+// catalog. If Id is 0, the Title is used to find the item. Rows with non-empty
+// Reason are malformed and only reported back.
+type importedRow struct {
+	Line      int
+	Id        uint64
+	Title     string
+	EventName string
+	ItemType  string
+	// Timestamp is when the event was made, 0 if it isn't known.
+	Timestamp int64
+	Reason    string
+}
+
+type importParser = func(r io.Reader) ([]importedRow, error)
+
+var importParsers map[string]importParser = map[string]importParser{
+	"json":             parseLibraryJson,
+	"csv":              parseLibraryCsv,
+	"letterboxd":       parseLetterboxdCsv,
+	"letterboxd-likes": parseLetterboxdLikesCsv,
+	"goodreads":        parseGoodreadsCsv,
+}
+
+// OnLibraryExport sends the user's library as a JSON or CSV file.
+func (a *AuthService) OnLibraryExport(ctx *gin.Context) {
+	userId, err := a.FetchUserIdByToken(ctx.Query("access_token"))
+	if err != nil {
+		a.Logger.Println(err)
+		services.NewBadCredentialsCoreResponse(ctx, services.InvalidRequestMessage)
+		return
+	}
+
+	events, err := database.FetchUserEvents(a.DB, userId)
+	if err != nil {
+		a.Logger.Printf("couldn't fetch the events, reason: %v\n", err)
+		services.NewBadCredentialsCoreResponse(ctx, services.InternalMessage)
+		return
+	}
+
+	switch ctx.DefaultQuery("format", "json") {
+	case "json":
+		ctx.Header("Content-Disposition", `attachment; filename="library.json"`)
+		ctx.JSON(http.StatusOK, database.UserLibrary{
+			Events:      events,
+			Collections: database.CollapseEvents(events),
+		})
+	case "csv":
+		ctx.Header("Content-Disposition", `attachment; filename="library.csv"`)
+		ctx.Header("Content-Type", "text/csv")
+		ctx.Status(http.StatusOK)
+		w := csv.NewWriter(ctx.Writer)
+		w.Write(LibraryCsvHeader)
+		for _, e := range events {
+			w.Write([]string{
+				strconv.FormatUint(e.ItemId, 10), e.Name, e.ItemType,
+				strconv.FormatInt(e.Timestamp, 10),
+			})
+		}
+		w.Flush()
+	default:
+		services.NewBadCredentialsCoreResponse(ctx, services.InvalidRequestMessage)
+	}
+}
+
+// OnLibraryImport reads an uploaded file (form field `file`) and pushes its
+// events as if they were made by the user, at the exported time if there is
+// one. Rows from the external services are
+// matched to the catalog by title, the rows that couldn't be matched are
+// reported back.
+func (a *AuthService) OnLibraryImport(ctx *gin.Context) {
+	token := ctx.Query("access_token")
+	if _, err := a.FetchUserIdByToken(token); err != nil {
+		a.Logger.Println(err)
+		services.NewBadCredentialsCoreResponse(ctx, services.InvalidRequestMessage)
+		return
+	}
+
+	parse, ok := importParsers[ctx.DefaultQuery("format", "json")]
+	if !ok {
+		services.NewBadCredentialsCoreResponse(ctx, services.InvalidRequestMessage)
+		return
+	}
+
+	fh, err := ctx.FormFile("file")
+	if err != nil || fh.Size > MaxImportSize {
+		a.Logger.Printf("invalid file, reason: %v\n", err)
+		services.NewBadCredentialsCoreResponse(ctx, services.InvalidRequestMessage)
+		return
+	}
+	fd, err := fh.Open()
+	if err != nil {
+		a.Logger.Println(err)
+		services.NewBadCredentialsCoreResponse(ctx, services.InternalMessage)
+		return
+	}
+	defer fd.Close()
+
+	rows, err := parse(fd)
+	if err != nil {
+		a.Logger.Printf("couldn't parse the file, reason: %v\n", err)
+		services.NewBadCredentialsCoreResponse(ctx, services.InvalidRequestMessage)
+		return
+	}
+
+	resp := database.UserLibraryImportResponse{Unmatched: []database.UnmatchedRow{}}
+	for _, row := range rows {
+		if row.Reason != "" {
+			resp.Unmatched = append(resp.Unmatched, database.UnmatchedRow{
+				Line: row.Line, Title: row.Title, Reason: row.Reason,
+			})
+			continue
+		}
+		if row.Id == 0 {
+			if row.Id, err = a.FindItemIdByTitle(row.ItemType, row.Title); err != nil {
+				resp.Unmatched = append(resp.Unmatched, database.UnmatchedRow{
+					Line: row.Line, Title: row.Title, Reason: "title not found",
+				})
+				continue
+			}
+		}
+
+		u := database.UserEventPushRequest{
+			UserEventPullRequest: database.UserEventPullRequest{
+				Token:     token,
+				EventName: row.EventName,
+				ItemType:  row.ItemType,
+			},
+			ItemId: strconv.FormatUint(row.Id, 10),
+		}
+		if !u.ValidateFields() {
+			resp.Unmatched = append(resp.Unmatched, database.UnmatchedRow{
+				Line: row.Line, Title: row.Title, Reason: "invalid event or type",
+			})
+			continue
+		}
+		at := time.Now()
+		if row.Timestamp > 0 && row.Timestamp < at.Unix() {
+			at = time.Unix(row.Timestamp, 0)
+		}
+		if err := a.pushEvent(&u, at); err != nil {
+			a.Logger.Println(err)
+			resp.Unmatched = append(resp.Unmatched, database.UnmatchedRow{
+				Line: row.Line, Title: row.Title, Reason: "couldn't save the event",
+			})
+			continue
+		}
+		resp.Imported++
+	}
+	services.NewGoodContentRequest(ctx, resp)
+}
+
+// FindItemIdByTitle uses the catalog's title lookup to find the item's id.
+func (a *AuthService) FindItemIdByTitle(itemType, title string) (uint64, error) {
+	var id uint64
+	var query string
+	switch itemType {
+	case "book":
+		query = `call find_book_id(?)`
+	case "tv":
+		query = `call find_series_id(?)`
+	default:
+		query = `call find_movie_id(?)`
+	}
+	if err := a.DB.QueryRow(query, title).Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func parseLibraryJson(r io.Reader) ([]importedRow, error) {
+	var lib database.UserLibrary
+	if err := json.NewDecoder(r).Decode(&lib); err != nil {
+		return nil, err
+	}
+	rows := make([]importedRow, 0, len(lib.Events))
+	for i, e := range lib.Events {
+		rows = append(rows, importedRow{
+			Line:      i + 1,
+			Id:        e.ItemId,
+			Title:     strconv.FormatUint(e.ItemId, 10),
+			EventName: e.Name,
+			ItemType:  e.ItemType,
+			Timestamp: e.Timestamp,
+		})
+	}
+	return rows, nil
+}
+
+func parseLibraryCsv(r io.Reader) ([]importedRow, error) {
+	return parseCsvWithHeader(r, func(line int, get func(string) string) *importedRow {
+		id, err := strconv.ParseUint(get("id"), 10, 64)
+		if err != nil {
+			return &importedRow{Line: line, Title: get("id"), Reason: "invalid id"}
+		}
+		var timestamp int64
+		if get("timestamp") != "" {
+			if timestamp, err = strconv.ParseInt(get("timestamp"), 10, 64); err != nil {
+				return &importedRow{Line: line, Title: get("id"), Reason: "invalid timestamp"}
+			}
+		}
+		return &importedRow{
+			Line:      line,
+			Id:        id,
+			Title:     get("id"),
+			EventName: get("name"),
+			ItemType:  get("type"),
+			Timestamp: timestamp,
+		}
+	})
+}
+
+// parseLetterboxdCsv reads Letterboxd's diary, ratings and watched exports.
+// Ratings are in 0.5-5 range, anything below 2.5 counts as a dislike. Watching
+// a film doesn't mean liking it, so the unrated rows are only reported back.
+func parseLetterboxdCsv(r io.Reader) ([]importedRow, error) {
+	return parseCsvWithHeader(r, func(line int, get func(string) string) *importedRow {
+		row := &importedRow{
+			Line:      line,
+			Title:     get("Name"),
+			EventName: "like",
+			ItemType:  "movie",
+		}
+		rating, err := strconv.ParseFloat(get("Rating"), 64)
+		switch {
+		case err != nil:
+			row.Reason = "no rating"
+		case rating < 2.5:
+			row.EventName = "dislike"
+		}
+		return row
+	})
+}
+
+// parseLetterboxdLikesCsv reads Letterboxd's likes export (`likes/films.csv`),
+// every film in it is liked.
+func parseLetterboxdLikesCsv(r io.Reader) ([]importedRow, error) {
+	return parseCsvWithHeader(r, func(line int, get func(string) string) *importedRow {
+		return &importedRow{
+			Line:      line,
+			Title:     get("Name"),
+			EventName: "like",
+			ItemType:  "movie",
+		}
+	})
+}
+
+// parseGoodreadsCsv reads Goodreads' library export. Books on the `to-read`
+// shelf go to the playlist, rated books are liked or disliked, the unrated
+// books from the other shelves are only reported back.
+func parseGoodreadsCsv(r io.Reader) ([]importedRow, error) {
+	return parseCsvWithHeader(r, func(line int, get func(string) string) *importedRow {
+		row := &importedRow{
+			Line:      line,
+			Title:     trimSeriesSuffix(get("Title")),
+			EventName: "like",
+			ItemType:  "book",
+		}
+		rating, _ := strconv.Atoi(get("My Rating"))
+		switch {
+		case get("Exclusive Shelf") == "to-read":
+			row.EventName = "playlist"
+		case rating <= 0:
+			row.Reason = "no rating"
+		case rating < 3:
+			row.EventName = "dislike"
+		}
+		return row
+	})
+}
+
+// parseCsvWithHeader reads the CSV and lets mapRow access the columns by the
+// header names. Missing columns are returned as empty strings.
+func parseCsvWithHeader(r io.Reader, mapRow func(int, func(string) string) *importedRow) ([]importedRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read the header, reason: %v", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+
+	rows := []importedRow{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %v, reason: %v", line, err)
+		}
+		get := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		rows = append(rows, *mapRow(line, get))
+	}
+	return rows, nil
+}
+
+// trimSeriesSuffix removes Goodreads' series annotation, e.g.
+// "The Hunger Games (The Hunger Games, #1)" becomes "The Hunger Games".
+func trimSeriesSuffix(title string) string {
+	if i := strings.LastIndex(title, " ("); i > 0 && strings.HasSuffix(title, ")") {
+		return title[:i]
+	}
+	return title
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"sync"
+
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+)
+
+const (
+	// StreamBufferSize is how many events a slow subscriber may lag behind
+	// before new events are dropped for it.
+	StreamBufferSize = 32
+	// StreamKeepAlive is an interval (in seconds) of the keep alive messages.
+	StreamKeepAlive = 15
+)
+
+// EventBroker fans out the user events to every open stream of the same user,
+// so all the tabs and devices see the changes made in any of them.
+type EventBroker struct {
+	mu          sync.RWMutex
+	subscribers map[uint64]map[chan database.Event]bool
+}
+
+func NewEventBroker() *EventBroker {
+	return &EventBroker{
+		subscribers: make(map[uint64]map[chan database.Event]bool),
+	}
+}
+
+// Subscribe registers a new stream for the user and returns the channel the
+// events will be delivered to.
+func (b *EventBroker) Subscribe(userId uint64) chan database.Event {
+	c := make(chan database.Event, StreamBufferSize)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[userId]; !ok {
+		b.subscribers[userId] = make(map[chan database.Event]bool)
+	}
+	b.subscribers[userId][c] = true
+	return c
+}
+
+// Unsubscribe removes the stream and closes its channel.
+func (b *EventBroker) Unsubscribe(userId uint64, c chan database.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	streams, ok := b.subscribers[userId]
+	if !ok {
+		return
+	}
+	if _, ok := streams[c]; !ok {
+		return
+	}
+	delete(streams, c)
+	close(c)
+	if len(streams) == 0 {
+		delete(b.subscribers, userId)
+	}
+}
+
+// Publish sends the event to every stream of the user. It never blocks, if the
+// stream is full the event is dropped for that stream.
+func (b *EventBroker) Publish(userId uint64, e database.Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for c := range b.subscribers[userId] {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
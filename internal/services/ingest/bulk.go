@@ -0,0 +1,491 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/tmdb"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/utils"
+	"github.com/spf13/viper"
+)
+
+const (
+	// DefaultBulkInterval is how often, in seconds, the catalog is grown, TMDB
+	// publishes the exports once a day.
+	DefaultBulkInterval      = 86400
+	DefaultBulkBudget        = 1000
+	DefaultBulkMinPopularity = 5.0
+	// BulkBatchSize is how many fetched titles are loaded between checkpoints.
+	BulkBatchSize = 20
+	// MaxDiscoverPages is the last page of `/discover` served by TMDB.
+	MaxDiscoverPages = 500
+	// ExportsDirectory keeps the downloaded exports, relative to DOWNLOAD_DIR.
+	ExportsDirectory = "tmdb-exports"
+)
+
+// requestCosts is how many requests it takes to fetch a title, a movie needs
+// its credits and keywords too.
+var requestCosts map[string]int = map[string]int{
+	"movie": 3,
+	"tv":    1,
+}
+
+var (
+	errBudgetSpent = errors.New("request budget spent")
+	errBulkRunning = errors.New("bulk ingestion is already running")
+)
+
+// BulkConfig is read from the `Bulk` section of the ingest service's config.
+type BulkConfig struct {
+	Interval int `mapstructure:"interval"`
+	// Budget is how many TMDB requests a single run can send, zero disables
+	// the bulk ingestion.
+	Budget int `mapstructure:"budget"`
+	// Discover and Exports are the types, `movie` and `tv`, loaded from
+	// `/discover` and from the daily id exports. Discover goes first.
+	Discover []string `mapstructure:"discover"`
+	Exports  []string `mapstructure:"exports"`
+	// MinPopularity skips the less popular titles of the exports, most of
+	// them are.
+	MinPopularity float64 `mapstructure:"min_popularity"`
+}
+
+// BulkReport describes the last bulk ingestion run.
+type BulkReport struct {
+	Running    bool       `json:"running"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Requests   int        `json:"requests"`
+	// Loaded is keyed by the source, e.g. `discover/movie`.
+	Loaded map[string]int64 `json:"loaded"`
+	Error  string           `json:"error,omitempty"`
+}
+
+// bulkRun spends the request budget of a single run.
+type bulkRun struct {
+	i      *Ingest
+	ctx    context.Context
+	left   int
+	report *BulkReport
+}
+
+// NewBulkConfig reads the bulk ingestion configuration, the defaults are used
+// if the section is missing.
+func NewBulkConfig(tableName string, v *viper.Viper) *BulkConfig {
+	c := BulkConfig{
+		Discover: []string{"movie", "tv"},
+		Exports:  []string{"movie", "tv"},
+	}
+	if v != nil && v.IsSet(tableName) {
+		if err := v.UnmarshalKey(tableName, &c); err != nil {
+			GlobalIngestLogger.Printf("Got error while unmarshalling: %v\n", err)
+		}
+	}
+	if c.Interval <= 0 {
+		c.Interval = DefaultBulkInterval
+	}
+	// zero budget is a valid setting, only a missing one gets the default
+	if v == nil || !v.IsSet(tableName+".budget") {
+		c.Budget = DefaultBulkBudget
+	}
+	if c.Budget < 0 {
+		c.Budget = 0
+	}
+	if v == nil || !v.IsSet(tableName+".min_popularity") {
+		c.MinPopularity = DefaultBulkMinPopularity
+	}
+	return &c
+}
+
+// WithBulkConfig sets how the catalog is grown from the TMDB exports and
+// `/discover`.
+func WithBulkConfig(c *BulkConfig) func(i *Ingest) {
+	return func(i *Ingest) {
+		i.Bulk = c
+	}
+}
+
+// take charges n requests, false if the budget can't afford them.
+func (r *bulkRun) take(n int) bool {
+	if r.left < n {
+		return false
+	}
+	r.left -= n
+	r.i.bulkReportMu.Lock()
+	r.report.Requests += n
+	r.i.bulkReportMu.Unlock()
+	return true
+}
+
+// fetch returns the title ready for its loaders.
+func (r *bulkRun) fetch(itemType string, id uint64) (*database.Insertable, error) {
+	if !r.take(requestCosts[itemType]) {
+		return nil, errBudgetSpent
+	}
+	var ins database.Insertable
+	switch itemType {
+	case "movie":
+		mi, err := r.i.FetchMovieDataFromWebSpecific(r.ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if ins, err = database.CastFromMovieInsertableToInsertable(mi); err != nil {
+			return nil, err
+		}
+	case "tv":
+		t, err := r.i.FetchTvDataFromWebSpecific(r.ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		ins = t.IntoSeriesInsertable()
+	default:
+		return nil, fmt.Errorf("unknown type %v", itemType)
+	}
+	return &ins, nil
+}
+
+// fetchMissing fetches the title if it isn't in the catalog yet, nil if it
+// is or if TMDB doesn't have it.
+func (r *bulkRun) fetchMissing(itemType string, id uint64) (*database.Insertable, error) {
+	var known bool
+	if err := r.i.DB.QueryRowContext(r.ctx, `select exists(select 1 from `+
+		catalogTables[itemType]+` where tmdb_id=?)`, id).Scan(&known); err != nil || known {
+		return nil, err
+	}
+	ins, err := r.fetch(itemType, id)
+	if errors.Is(err, tmdb.ErrNotFound) {
+		return nil, nil
+	}
+	return ins, err
+}
+
+func (r *bulkRun) load(itemType string, batch []*database.Insertable) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	if itemType == "tv" {
+		return r.i.MergeSeriesPipeline(r.ctx, &batch)
+	}
+	return r.i.InsertMoviePipeline(r.ctx, &batch)
+}
+
+// discover loads the missing titles from the pages of `/discover`, the last
+// loaded page is kept in the checkpoint `discover/<type>`. Having reached the
+// last page it starts over, the new popular titles show up on the first ones.
+func (r *bulkRun) discover(itemType string) (int64, error) {
+	name := "discover/" + itemType
+	cp, err := r.i.LoadCheckpoint(name)
+	if err != nil {
+		return 0, err
+	}
+	if cp == nil {
+		cp = &Checkpoint{File: name}
+	}
+
+	var loaded int64
+	for page := int(cp.Row) + 1; ; page++ {
+		if page > MaxDiscoverPages {
+			cp.Row = 0
+			return loaded, r.i.SaveCheckpoint(cp)
+		}
+		if !r.take(1) {
+			return loaded, errBudgetSpent
+		}
+		var res *utils.TmdbResponseContentSchema
+		if itemType == "tv" {
+			res, err = r.i.Tmdb.DiscoverTv(r.ctx, page)
+		} else {
+			res, err = r.i.Tmdb.DiscoverMovie(r.ctx, page)
+		}
+		if err != nil {
+			return loaded, err
+		}
+
+		// an interrupted page is fetched again on the next run, its loaded
+		// titles are skipped then
+		batch := []*database.Insertable{}
+		for _, result := range res.Results {
+			ins, err := r.fetchMissing(itemType, result.Id)
+			if err != nil {
+				if loadErr := r.load(itemType, batch); loadErr == nil {
+					loaded += int64(len(batch))
+				}
+				return loaded, err
+			}
+			if ins != nil {
+				batch = append(batch, ins)
+			}
+		}
+		if err := r.load(itemType, batch); err != nil {
+			return loaded, err
+		}
+		loaded += int64(len(batch))
+
+		cp.Row = int64(page)
+		if page >= res.TotalPages {
+			cp.Row = 0
+		}
+		if err := r.i.SaveCheckpoint(cp); err != nil || cp.Row == 0 {
+			return loaded, err
+		}
+	}
+}
+
+// export loads the missing titles of the daily id export, the read lines are
+// kept in the checkpoint of the export file. An export is read until its end
+// before the next one is downloaded.
+func (r *bulkRun) export(itemType string) (int64, error) {
+	name, err := r.i.exportFile(r.ctx, itemType)
+	if err != nil {
+		return 0, err
+	}
+	path := filepath.Join(os.Getenv("DOWNLOAD_DIR"), name)
+	hash, _, err := utils.FileHash(path, -1)
+	if err != nil {
+		return 0, err
+	}
+	cp, err := r.i.LoadCheckpoint(name)
+	if err != nil {
+		return 0, err
+	}
+	if cp == nil || cp.Hash != hash {
+		cp = &Checkpoint{File: name, Hash: hash}
+	}
+	if cp.Completed {
+		return 0, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var loaded int64
+	batch := make([]*database.Insertable, 0, BulkBatchSize)
+	commit := func(next int64) error {
+		if err := r.load(itemType, batch); err != nil {
+			return err
+		}
+		loaded += int64(len(batch))
+		batch = batch[:0]
+		cp.Row = next
+		return r.i.SaveCheckpoint(cp)
+	}
+
+	next := cp.Row
+	err = tmdb.ReadExport(f, cp.Row, func(line int64, e *tmdb.ExportEntry) error {
+		if e.Adult || e.Video || e.Popularity < r.i.Bulk.MinPopularity {
+			next = line + 1
+			return nil
+		}
+		ins, err := r.fetchMissing(itemType, e.Id)
+		if err != nil {
+			// the line is read again on the next run
+			return errors.Join(err, commit(line))
+		}
+		next = line + 1
+		if ins == nil {
+			return nil
+		}
+		batch = append(batch, ins)
+		if len(batch) >= BulkBatchSize {
+			return commit(next)
+		}
+		return nil
+	})
+	if err != nil {
+		return loaded, err
+	}
+	cp.Completed = true
+	if err := commit(next); err != nil {
+		return loaded, err
+	}
+	r.i.Logger.Printf("%v loaded, %v records.\n", name, loaded)
+	return loaded, nil
+}
+
+// exportFile returns the export to read, relative to DOWNLOAD_DIR. It is the
+// unfinished one if there is any, otherwise yesterday's export is downloaded
+// and the finished ones are removed.
+func (i *Ingest) exportFile(ctx context.Context, itemType string) (string, error) {
+	dir := filepath.Join(os.Getenv("DOWNLOAD_DIR"), ExportsDirectory)
+	latest, err := tmdb.ExportName(itemType, time.Now().AddDate(0, 0, -1))
+	if err != nil {
+		return "", err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, latest[:len(latest)-len("01_02_2006.json.gz")]+"*.json.gz"))
+	if err != nil {
+		return "", err
+	}
+	finished := []string{}
+	for _, path := range paths {
+		name := filepath.ToSlash(filepath.Join(ExportsDirectory, filepath.Base(path)))
+		cp, err := i.LoadCheckpoint(name)
+		if err != nil {
+			return "", err
+		}
+		if cp == nil || !cp.Completed {
+			return name, nil
+		}
+		if filepath.Base(path) != latest {
+			finished = append(finished, path)
+		}
+	}
+
+	name := filepath.ToSlash(filepath.Join(ExportsDirectory, latest))
+	path := filepath.Join(dir, latest)
+	if _, err := os.Stat(path); err == nil {
+		return name, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, latest+".*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if err := i.Tmdb.DownloadExport(ctx, itemType, time.Now().AddDate(0, 0, -1), f); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", err
+	}
+	for _, old := range finished {
+		if err := os.Remove(old); err != nil {
+			i.Logger.Printf("couldn't remove %v, reason: %v\n", old, err)
+		}
+	}
+	i.Logger.Printf("%v downloaded.\n", name)
+	return name, nil
+}
+
+// RunBulkIngest grows the catalog from `/discover` and the daily id exports
+// until the request budget is spent. Only one run at a time is allowed.
+func (i *Ingest) RunBulkIngest(ctx context.Context) (*BulkReport, error) {
+	if !i.bulkMu.TryLock() {
+		return nil, errBulkRunning
+	}
+	defer i.bulkMu.Unlock()
+	return i.runBulkIngest(ctx)
+}
+
+// runBulkIngest expects bulkMu to be held.
+func (i *Ingest) runBulkIngest(ctx context.Context) (*BulkReport, error) {
+	report := &BulkReport{Running: true, StartedAt: time.Now(), Loaded: map[string]int64{}}
+	i.bulkReportMu.Lock()
+	i.bulkReport = report
+	i.bulkReportMu.Unlock()
+
+	run := i.beginRun("bulk")
+	r := bulkRun{i: i, ctx: withRun(ctx, run), left: i.Bulk.Budget, report: report}
+	sources := []struct {
+		name  string
+		types []string
+		load  func(string) (int64, error)
+	}{
+		{"discover", i.Bulk.Discover, r.discover},
+		{"export", i.Bulk.Exports, r.export},
+	}
+	var runErr error
+	var total int64
+run:
+	for _, source := range sources {
+		for _, itemType := range source.types {
+			if _, ok := catalogTables[itemType]; !ok {
+				i.Logger.Printf("unknown bulk ingestion type %v\n", itemType)
+				continue
+			}
+			loaded, err := source.load(itemType)
+			total += loaded
+			i.bulkReportMu.Lock()
+			report.Loaded[source.name+"/"+itemType] += loaded
+			i.bulkReportMu.Unlock()
+			if errors.Is(err, errBudgetSpent) {
+				break run
+			}
+			if err != nil {
+				runErr = err
+				break run
+			}
+		}
+	}
+
+	finishedAt := time.Now()
+	i.bulkReportMu.Lock()
+	report.Running = false
+	report.FinishedAt = &finishedAt
+	if runErr != nil {
+		report.Error = runErr.Error()
+	}
+	i.bulkReportMu.Unlock()
+	i.finishRun(run, total, runErr)
+
+	i.Logger.Printf("Bulk ingestion completed: %v, %v requests, %v records.\n",
+		finishedAt.Sub(report.StartedAt), report.Requests, total)
+	if total > 0 {
+		i.refreshSummariesInBackground()
+		i.syncRecommenderInBackground(false)
+	}
+	return report, runErr
+}
+
+// RunBulkScheduler grows the catalog periodically until the context is
+// cancelled. It does nothing without a TMDB key.
+func (i *Ingest) RunBulkScheduler(ctx context.Context) {
+	if i.Bulk.Budget == 0 || i.Tmdb.ApiKey == "" {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(i.Bulk.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := i.RunBulkIngest(ctx); err != nil {
+				i.Logger.Printf("Bulk ingestion failed, reason: %v\n", err)
+			}
+		}
+	}
+}
+
+// StartBulkIngest starts a bulk ingestion run in the background.
+func (i *Ingest) StartBulkIngest(ctx *gin.Context) {
+	if i.Bulk.Budget == 0 || i.Tmdb.ApiKey == "" {
+		services.NewBadContentRequest(ctx, "bulk ingestion is disabled")
+		return
+	}
+	if !i.bulkMu.TryLock() {
+		services.NewBadContentRequest(ctx, errBulkRunning.Error())
+		return
+	}
+	go func() {
+		defer i.bulkMu.Unlock()
+		// the run outlives the request
+		if _, err := i.runBulkIngest(context.Background()); err != nil {
+			i.Logger.Printf("Bulk ingestion failed, reason: %v\n", err)
+		}
+	}()
+	services.NewGoodContentRequest(ctx, "bulk ingestion started")
+}
+
+// BulkStatus returns the report of the last or the running bulk ingestion.
+func (i *Ingest) BulkStatus(ctx *gin.Context) {
+	i.bulkReportMu.Lock()
+	defer i.bulkReportMu.Unlock()
+	services.NewGoodContentRequest(ctx, i.bulkReport)
+}
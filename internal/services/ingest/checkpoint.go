@@ -0,0 +1,164 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/utils"
+)
+
+const (
+	// CheckpointBatchSize is how many records are loaded between checkpoints.
+	CheckpointBatchSize = 2048
+)
+
+// Checkpoint is the progress of a single file, saved after every committed
+// batch.
+type Checkpoint struct {
+	// File is relative to DOWNLOAD_DIR.
+	File      string
+	Offset    int64
+	Row       int64
+	Hash      string
+	Completed bool
+}
+
+// BatchFunc loads a batch of extracted records, the checkpoint is moved only
+// if it succeeds.
+type BatchFunc = func(batch []*database.Insertable) error
+
+// LoadCheckpoint returns the checkpoint of the file, nil if the file has never
+// been read.
+func (i *Ingest) LoadCheckpoint(file string) (*Checkpoint, error) {
+	cp := &Checkpoint{File: file}
+	err := i.DB.QueryRow(`select byte_offset, rows_read, file_hash, completed
+		from ingest_checkpoints where file=?`, file).Scan(&cp.Offset, &cp.Row,
+		&cp.Hash, &cp.Completed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+func (i *Ingest) SaveCheckpoint(cp *Checkpoint) error {
+	_, err := i.DB.Exec(`insert into ingest_checkpoints(file, byte_offset,
+		rows_read, file_hash, completed) values (?, ?, ?, ?, ?)
+		on duplicate key update byte_offset=values(byte_offset),
+		rows_read=values(rows_read), file_hash=values(file_hash),
+		completed=values(completed)`, cp.File, cp.Offset, cp.Row, cp.Hash,
+		cp.Completed)
+	return err
+}
+
+// resumePoint decides where the file should be read from. An unchanged file
+// is skipped if it was read fully, or resumed if it was interrupted. A file
+// that only grew since it was read fully is read from the old end, any other
+// change means the whole file is read again.
+func (i *Ingest) resumePoint(path string, cp *Checkpoint, hash string) (*Checkpoint, bool, error) {
+	fresh := &Checkpoint{File: cp.File, Hash: hash}
+	switch {
+	case cp.Hash == hash && cp.Completed:
+		return nil, true, nil
+	case cp.Hash == hash:
+		return &Checkpoint{File: cp.File, Offset: cp.Offset, Row: cp.Row, Hash: hash}, false, nil
+	case cp.Completed:
+		prefixHash, _, err := utils.FileHash(path, cp.Offset)
+		if err != nil {
+			return nil, false, err
+		}
+		if prefixHash == cp.Hash {
+			i.Logger.Printf("%v grew since the last read, loading the delta.\n", cp.File)
+			return &Checkpoint{File: cp.File, Offset: cp.Offset, Row: cp.Row, Hash: hash}, false, nil
+		}
+	}
+	i.Logger.Printf("%v changed since the last read, loading it again.\n", cp.File)
+	return fresh, false, nil
+}
+
+// StreamFile extracts the file in batches and loads them, saving a checkpoint
+// after every batch. The name is relative to DOWNLOAD_DIR. Returns the number
+// of loaded records.
+func (i *Ingest) StreamFile(name string, load BatchFunc, funcs ...ExtractFunc) (int64, error) {
+	path := filepath.Join(os.Getenv("DOWNLOAD_DIR"), name)
+	hash, _, err := utils.FileHash(path, -1)
+	if err != nil {
+		return 0, err
+	}
+	cp, err := i.LoadCheckpoint(name)
+	if err != nil {
+		return 0, err
+	}
+	if cp == nil {
+		cp = &Checkpoint{File: name, Hash: hash}
+	} else {
+		var skip bool
+		if cp, skip, err = i.resumePoint(path, cp, hash); err != nil {
+			return 0, err
+		}
+		if skip {
+			i.Logger.Printf("%v hasn't changed, skipping.\n", name)
+			return 0, nil
+		}
+	}
+
+	streamer, err := i.streamerFor(path)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := make(chan utils.Record)
+	streamErr := make(chan error, 1)
+	go func() {
+		streamErr <- streamer.Stream(ctx, path, cp.Offset, cp.Row, i.Logger, c)
+	}()
+
+	var loaded int64
+	batch := make([]*database.Insertable, 0, CheckpointBatchSize)
+	last := *cp
+	commit := func() error {
+		if len(batch) > 0 {
+			if err := load(batch); err != nil {
+				return err
+			}
+			loaded += int64(len(batch))
+			batch = batch[:0]
+		}
+		*cp = last
+		return i.SaveCheckpoint(cp)
+	}
+
+	fr := i.fileReport(path)
+	for record := range c {
+		if data, ok := i.extractRecord(fr, &record, funcs...); ok {
+			batch = append(batch, &data)
+		}
+		last.Offset, last.Row = record.Offset, record.Row+1
+		if len(batch) >= CheckpointBatchSize {
+			if err := commit(); err != nil {
+				return loaded, err
+			}
+		}
+	}
+
+	// the records streamed before a failure are whole, they are loaded but the
+	// file stays incomplete and is resumed after them
+	err = <-streamErr
+	last.Completed = err == nil
+	if commitErr := commit(); commitErr != nil {
+		return loaded, errors.Join(err, commitErr)
+	}
+	if err != nil {
+		return loaded, fmt.Errorf("couldn't read %v: %w", name, err)
+	}
+	i.Logger.Printf("%v loaded, %v records.\n", name, loaded)
+	return loaded, nil
+}
@@ -0,0 +1,119 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/utils"
+)
+
+// ExtractJson is Extract for JSON arrays and JSON Lines, every element is
+// passed to the extractors as a record with a single field.
+func (i *Ingest) ExtractJson(path *string, funcs ...ExtractFunc) ([]*database.Insertable, error) {
+	c := make(chan []string)
+	var streamErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		streamErr = utils.JsonStreamer(path, i.Logger, c)
+	}()
+
+	var extractedData []*database.Insertable
+	var row int64
+	fr := i.fileReport(*path)
+	for stream := range c {
+		record := utils.Record{Fields: stream, Row: row, Raw: stream[0]}
+		if data, ok := i.extractRecord(fr, &record, funcs...); ok {
+			extractedData = append(extractedData, &data)
+		}
+		row++
+	}
+	<-done
+	return extractedData, streamErr
+}
+
+// MergeConcertPipeline loads the concerts with their artists and venues.
+func (i *Ingest) MergeConcertPipeline(ctx context.Context, concerts *[]*database.Insertable) error {
+	cip, err := database.NewInsertPipeline(concerts)
+	if err != nil {
+		return fmt.Errorf("cannot create pipeline, %v\n", err)
+	}
+	if err := i.Load(ctx, &cip, database.MergeIntoConcerts(i.DB, &i.MaxBatchSize)); err != nil {
+		i.Logger.Printf("Error while loading concerts, reason: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// concertsSource is every data file of the directory. The JSON files are
+// loaded whole, the others are streamed with checkpoints, the events are
+// updated by their id either way.
+type concertsSource struct {
+	directory string
+}
+
+func newConcertsSource(c *SourceConfig) Source {
+	return &concertsSource{c.Directory}
+}
+
+func (s *concertsSource) DataType() string {
+	return "music"
+}
+
+func (s *concertsSource) Discover(i *Ingest) ([]string, error) {
+	return globSource(s.directory, "*.csv", "*.jsonl", "*.parquet", "*.json")
+}
+
+func (s *concertsSource) Extractors(i *Ingest, file string) ([]ExtractFunc, error) {
+	if filepath.Ext(file) == ".json" {
+		return []ExtractFunc{database.ConcertFromJsonStream}, nil
+	}
+	extractor, err := i.headerExtractor(file, database.ConcertFromStream)
+	if err != nil {
+		return nil, err
+	}
+	return []ExtractFunc{extractor}, nil
+}
+
+func (s *concertsSource) Loader(ctx context.Context, i *Ingest, file string) (BatchFunc, error) {
+	return func(batch []*database.Insertable) error {
+		return i.MergeConcertPipeline(ctx, &batch)
+	}, nil
+}
+
+// LoadJsonFile loads the whole JSON file, unless it hasn't changed since the
+// last load. The name is relative to DOWNLOAD_DIR.
+func (i *Ingest) LoadJsonFile(name string, load BatchFunc, funcs ...ExtractFunc) (int64, error) {
+	path := filepath.Join(os.Getenv("DOWNLOAD_DIR"), name)
+	hash, size, err := utils.FileHash(path, -1)
+	if err != nil {
+		return 0, err
+	}
+	cp, err := i.LoadCheckpoint(name)
+	if err != nil {
+		return 0, err
+	}
+	if cp != nil && cp.Hash == hash && cp.Completed {
+		i.Logger.Printf("%v hasn't changed, skipping.\n", name)
+		return 0, nil
+	}
+
+	records, err := i.ExtractJson(&path, funcs...)
+	if err != nil {
+		return 0, err
+	}
+	if len(records) > 0 {
+		if err := load(records); err != nil {
+			return 0, err
+		}
+	}
+	if err := i.SaveCheckpoint(&Checkpoint{File: name, Offset: size,
+		Row: int64(len(records)), Hash: hash, Completed: true}); err != nil {
+		return 0, err
+	}
+	i.Logger.Printf("%v loaded, %v records.\n", name, len(records))
+	return int64(len(records)), nil
+}
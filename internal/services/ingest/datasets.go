@@ -0,0 +1,166 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+)
+
+// HeaderExtractorBuilder builds the extractor from the header of the file.
+type HeaderExtractorBuilder = func(header []string) (ExtractFunc, error)
+
+// headerExtractor reads the header of the file, the name is relative to
+// DOWNLOAD_DIR.
+func (i *Ingest) headerExtractor(name string, build HeaderExtractorBuilder) (ExtractFunc, error) {
+	path := filepath.Join(os.Getenv("DOWNLOAD_DIR"), name)
+	streamer, err := i.streamerFor(path)
+	if err != nil {
+		return nil, err
+	}
+	header, err := streamer.Header(path)
+	if err != nil {
+		return nil, err
+	}
+	extractor, err := build(header)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", name, err)
+	}
+	return extractor, nil
+}
+
+// extractWithHeader extracts the whole file with a header driven extractor.
+func (i *Ingest) extractWithHeader(name string, build HeaderExtractorBuilder) ([]*database.Insertable, error) {
+	extractor, err := i.headerExtractor(name, build)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(os.Getenv("DOWNLOAD_DIR"), name)
+	return i.Extract(&path, extractor)
+}
+
+// moviesDataSource is The Movies Dataset, the movies are joined with their
+// keywords and credits and updated by tmdb_id if they are already in the
+// catalog. The MovieLens ratings go after them, they refer to the movies.
+type moviesDataSource struct {
+	directory string
+}
+
+func newMoviesDataSource(c *SourceConfig) Source {
+	return &moviesDataSource{c.Directory}
+}
+
+func (s *moviesDataSource) DataType() string {
+	return "media"
+}
+
+func (s *moviesDataSource) Discover(i *Ingest) ([]string, error) {
+	files := []string{filepath.Join(s.directory, "movies_metadata.csv")}
+	if i.Seed.Ratings != "" {
+		files = append(files, filepath.Join(s.directory, i.Seed.Ratings))
+	}
+	return files, nil
+}
+
+func (s *moviesDataSource) Extractors(i *Ingest, file string) ([]ExtractFunc, error) {
+	build := database.MoviesDataFromStream
+	if s.isRatings(i, file) {
+		build = database.RatingsFromStream
+	}
+	extractor, err := i.headerExtractor(file, build)
+	if err != nil {
+		return nil, err
+	}
+	return []ExtractFunc{extractor}, nil
+}
+
+func (s *moviesDataSource) Loader(ctx context.Context, i *Ingest, file string) (BatchFunc, error) {
+	if s.isRatings(i, file) {
+		return i.seedLoader(ctx, filepath.Join(s.directory, "links.csv")), nil
+	}
+
+	var keywords, credits []*database.Insertable
+	return func(batch []*database.Insertable) error {
+		// keywords and credits are only needed if there is something to load
+		if keywords == nil {
+			extracted, err := i.extractWithHeader(filepath.Join(s.directory,
+				"keywords.csv"), database.MoviesDataKeywordsFromStream)
+			if err != nil {
+				return err
+			}
+			keywords = extracted
+			i.Logger.Println("Keywords extraction completed.")
+		}
+		if credits == nil {
+			extracted, err := i.extractWithHeader(filepath.Join(s.directory,
+				"credits.csv"), database.MoviesDataCreditsFromStream)
+			if err != nil {
+				return err
+			}
+			credits = extracted
+			i.Logger.Println("Credits extraction completed.")
+		}
+
+		withKeywords, err := i.Transform(&batch, &keywords,
+			database.MoviesDataJoinKeywords)
+		if err != nil {
+			return err
+		}
+		joined, err := i.Transform(&withKeywords, &credits, database.TmdbJoinBoth)
+		if err != nil {
+			return err
+		}
+		return i.InsertMoviePipeline(ctx, &joined)
+	}, nil
+}
+
+func (s *moviesDataSource) isRatings(i *Ingest, file string) bool {
+	return i.Seed.Ratings != "" && file == filepath.Join(s.directory, i.Seed.Ratings)
+}
+
+// MergeBookPipeline merges the books without a Goodreads id into the catalog.
+func (i *Ingest) MergeBookPipeline(ctx context.Context, books *[]*database.Insertable) error {
+	bip, err := database.NewInsertPipeline(books)
+	if err != nil {
+		return fmt.Errorf("cannot create pipeline, %v\n", err)
+	}
+	if err := i.Load(ctx, &bip, database.MergeIntoBooks(i.DB, &i.MaxBatchSize)); err != nil {
+		i.Logger.Printf("Error while merging books, reason: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// booksDataSource is every data file of the books dataset, the books are merged by
+// ISBN, or by the title and the author.
+type booksDataSource struct {
+	directory string
+}
+
+func newBooksDataSource(c *SourceConfig) Source {
+	return &booksDataSource{c.Directory}
+}
+
+func (s *booksDataSource) DataType() string {
+	return "book"
+}
+
+func (s *booksDataSource) Discover(i *Ingest) ([]string, error) {
+	return globSource(s.directory, "*.csv", "*.jsonl", "*.parquet")
+}
+
+func (s *booksDataSource) Extractors(i *Ingest, file string) ([]ExtractFunc, error) {
+	extractor, err := i.headerExtractor(file, database.BooksDataFromStream)
+	if err != nil {
+		return nil, err
+	}
+	return []ExtractFunc{extractor}, nil
+}
+
+func (s *booksDataSource) Loader(ctx context.Context, i *Ingest, file string) (BatchFunc, error) {
+	return func(batch []*database.Insertable) error {
+		return i.MergeBookPipeline(ctx, &batch)
+	}, nil
+}
@@ -2,7 +2,8 @@
 package ingest
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,7 +11,8 @@ import (
 	"os/signal"
 	"path/filepath"
 	"sort"
-	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -18,7 +20,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/mlclient"
 	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/tmdb"
 	"github.com/sadsonkeenolee/IO_projekt/pkg/utils"
 	"github.com/spf13/viper"
 )
@@ -36,6 +40,34 @@ type LoadFunc = func(*database.Insertable) error
 type Ingest struct {
 	services.Service
 	MaxBatchSize int
+	// Recommender is optional, without it the catalog is not synced.
+	Recommender *mlclient.Client
+	// FullResync forces the full catalog sync on start.
+	FullResync bool
+	// SummariesInterval is how often the summary tables are refreshed.
+	SummariesInterval time.Duration
+	// Seed configures the import of the MovieLens ratings.
+	Seed *SeedConfig
+	// Tmdb fetches the titles missing from the catalog.
+	Tmdb *tmdb.Client
+	// Refresher configures the periodic refresh of the titles from TMDB.
+	Refresher *RefresherConfig
+	// Bulk configures growing the catalog from the TMDB exports and
+	// `/discover`.
+	Bulk *BulkConfig
+	// Sources are the datasets loaded on start.
+	Sources      []*DatasetSource
+	syncMu       sync.Mutex
+	summariesMu  sync.Mutex
+	bulkMu       sync.Mutex
+	bulkReportMu sync.Mutex
+	bulkReport   *BulkReport
+	reportMu     sync.Mutex
+	// report is the summary of the last or the running load of the datasets.
+	report *IngestReport
+	runsMu sync.Mutex
+	// runs are the runs in progress.
+	runs []*IngestRun
 }
 
 func WithLogger(l *log.Logger) func(i *Ingest) {
@@ -78,6 +110,35 @@ func WithBatch(n int) func(i *Ingest) {
 	}
 }
 
+func WithRecommender(c *mlclient.Client) func(i *Ingest) {
+	return func(i *Ingest) {
+		i.Recommender = c
+	}
+}
+
+func WithTmdb(c *tmdb.Client) func(i *Ingest) {
+	return func(i *Ingest) {
+		i.Tmdb = c
+	}
+}
+
+func WithFullResync(b bool) func(i *Ingest) {
+	return func(i *Ingest) {
+		i.FullResync = b
+	}
+}
+
+// WithSummariesInterval sets the refresh interval of the summary tables, in
+// seconds.
+func WithSummariesInterval(n int) func(i *Ingest) {
+	return func(i *Ingest) {
+		if n <= 0 {
+			n = DefaultSummariesInterval
+		}
+		i.SummariesInterval = time.Duration(n) * time.Second
+	}
+}
+
 func IngestBuilder(opts ...func(*Ingest)) services.IService {
 	i := &Ingest{}
 	for _, opt := range opts {
@@ -111,30 +172,32 @@ func (i *Ingest) IsDataExtracted() ([]*database.DatasetFileMetadata, error) {
 // Extract parses stream and puts data into meaningful structure.
 // Function requires full path to a file and defined extractor functions that
 // will perform other extraction operations in order provided by the caller.
+// The format of the file is picked by streamerFor.
 func (i *Ingest) Extract(path *string, funcs ...ExtractFunc) ([]*database.Insertable, error) {
-	var c chan []string = make(chan []string)
+	streamer, err := i.streamerFor(*path)
+	if err != nil {
+		return nil, err
+	}
+	var c chan utils.Record = make(chan utils.Record)
 	var extractedData []*database.Insertable
-	go utils.CsvStreamer(path, GlobalIngestLogger, c)
-	for stream := range c {
-		var data database.Insertable
-		var shouldAppend bool = true
-		for _, extractor := range funcs {
-			err := extractor(&stream, &data)
-			if err != nil {
-				i.Logger.Printf("Got error while extracting: %v\n", err)
-				shouldAppend = false
-				break
-			}
-		}
-		if shouldAppend {
+	var streamErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		streamErr = streamer.Stream(context.Background(), *path, 0, 0, GlobalIngestLogger, c)
+	}()
+	fr := i.fileReport(*path)
+	for record := range c {
+		if data, ok := i.extractRecord(fr, &record, funcs...); ok {
 			extractedData = append(extractedData, &data)
 		}
 	}
-	return extractedData, nil
+	<-done
+	return extractedData, streamErr
 }
 
 // InsertMoviePipeline prepares the data to insert into database
-func (i *Ingest) InsertMoviePipeline(movies *[]*database.Insertable) error {
+func (i *Ingest) InsertMoviePipeline(ctx context.Context, movies *[]*database.Insertable) error {
 	ip, err := database.NewInsertPipeline(movies)
 	if err != nil {
 		return fmt.Errorf("Error while creating a pipeline: %v\n", err)
@@ -152,21 +215,25 @@ func (i *Ingest) InsertMoviePipeline(movies *[]*database.Insertable) error {
 		database.InsertIntoMovie2KeywordsChunked(i.DB, &i.MaxBatchSize),
 		database.InsertIntoMovie2LanguagesChunked(i.DB, &i.MaxBatchSize),
 		database.InsertIntoMovie2CountriesChunked(i.DB, &i.MaxBatchSize),
+		database.UpdateImagesForMovies(i.DB, &i.MaxBatchSize),
 	}
 
-	// Try to load whatever is possible, ignore the errors
+	// Try to load whatever is possible, report the errors at the end
+	errs := []error{}
 	for _, loader := range loaders {
-		if err := i.Load(&ip, loader); err != nil {
+		if err := i.Load(ctx, &ip, loader); err != nil {
 			i.Logger.Printf("Error while loading the data, reason: %v\n", err)
+			errs = append(errs, err)
 		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 func (i *Ingest) RebuildAllTables() {
 	tables := []string{"movies", "languages", "keywords", "genres", "countries",
 		"movie2companies", "movie2countries", "movie2genres", "movie2keywords",
-		"movie2languages", "books", "authors",
+		"movie2languages", "books", "authors", "artists", "venues", "events",
+		"series", "seasons", "networks", "series2networks", "series2genres",
 	}
 	// Try to rebuild table, ignore failures
 	for _, table := range tables {
@@ -176,26 +243,30 @@ func (i *Ingest) RebuildAllTables() {
 	}
 }
 
-func (i *Ingest) FirstMovieLoadPipeline(path1, path2 string) {
-	mme1, err := i.Extract(&path1, database.TmdbMapFromStream)
-	if err != nil {
-		i.Logger.Fatalf("First extraction failed: %v\n", err)
-	}
-	i.Logger.Println("First extraction completed.")
-	mme2, err := i.Extract(&path2, database.TmdbMapCreditsFromStream)
-	if err != nil {
-		i.Logger.Fatalf("Second extraction failed: %v\n", err)
-	}
-	i.Logger.Println("Second extraction completed.")
-	final, err := i.Transform(&mme1, &mme2, database.TmdbJoinBoth)
-	if err != nil {
-		i.Logger.Fatalf("Transforming failed: %v\n", err)
+// moviesLoader loads the batches of movies joined with the credits, the name
+// of the credits is relative to DOWNLOAD_DIR.
+func (i *Ingest) moviesLoader(ctx context.Context, creditsName string) BatchFunc {
+	var credits []*database.Insertable
+	return func(batch []*database.Insertable) error {
+		// the credits are only needed if there is something to load
+		if credits == nil {
+			creditsPath := filepath.Join(os.Getenv("DOWNLOAD_DIR"), creditsName)
+			extracted, err := i.Extract(&creditsPath, database.TmdbMapCreditsFromStream)
+			if err != nil {
+				return err
+			}
+			credits = extracted
+			i.Logger.Println("Credits extraction completed.")
+		}
+		joined, err := i.Transform(&batch, &credits, database.TmdbJoinBoth)
+		if err != nil {
+			return err
+		}
+		return i.InsertMoviePipeline(ctx, &joined)
 	}
-	i.Logger.Println("Transforming completed.")
-	i.InsertMoviePipeline(&final)
 }
 
-func (i *Ingest) BookInsertPipeline(books *[]*database.Insertable) error {
+func (i *Ingest) BookInsertPipeline(ctx context.Context, books *[]*database.Insertable) error {
 	bip, err := database.NewInsertPipeline(books)
 	if err != nil {
 		return fmt.Errorf("cannot create pipeline, %v\n", err)
@@ -206,21 +277,44 @@ func (i *Ingest) BookInsertPipeline(books *[]*database.Insertable) error {
 		database.InsertIntoAuthorsChunked(i.DB, &i.MaxBatchSize),
 	}
 
+	errs := []error{}
 	for _, loader := range loaders {
-		if err := i.Load(&bip, loader); err != nil {
+		if err := i.Load(ctx, &bip, loader); err != nil {
 			i.Logger.Printf("Error while loading books, reason: %v\n", err)
+			errs = append(errs, err)
 		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
-func (i *Ingest) FirstBookLoadPipeline(path3 string) {
-	bis, err := i.Extract(&path3, database.BookFromStream)
-	if err != nil {
-		i.Logger.Fatalf("Third extraction failed: %v\n", err)
+// LoadDatasets streams every source, the unchanged files are skipped and the
+// interrupted ones are resumed. A source is marked as read once all of its
+// files are loaded. Every source is loaded in its own run. Returns the number
+// of loaded records.
+func (i *Ingest) LoadDatasets(ctx context.Context) int64 {
+	i.registerSources()
+	i.beginReport()
+	defer i.finishReport()
+	var total int64
+	for _, ds := range i.Sources {
+		run := i.beginRun(ds.Name)
+		loaded, err := i.LoadSource(withRun(ctx, run), ds)
+		i.finishRun(run, loaded, err)
+		total += loaded
+		if err != nil {
+			i.Logger.Printf("%v loading stopped, reason: %v\n", ds.Name, err)
+			continue
+		}
+		i.MarkDatasetRead(ds.Config.Directory)
+	}
+	return total
+}
+
+func (i *Ingest) MarkDatasetRead(directory string) {
+	if _, err := i.DB.Exec(`update read_table set read_at=1 where directory=?`,
+		directory); err != nil {
+		i.Logger.Printf("couldn't update read_table, reason: %v\n", err)
 	}
-	i.Logger.Println("Third extraction completed.")
-	i.BookInsertPipeline(&bis)
 }
 
 // Transform applies transformations to the given data. This function will fail
@@ -236,11 +330,20 @@ func (i *Ingest) Transform(left, right *[]*database.Insertable, funcs ...Transfo
 	return transformedData, nil
 }
 
-func (i *Ingest) Load(pipeline *database.Insertable, funcs ...LoadFunc) error {
+// Load runs every loader over the pipeline, the rows of every loader are
+// counted into the run of the context.
+func (i *Ingest) Load(ctx context.Context, pipeline *database.Insertable, funcs ...LoadFunc) error {
+	run := runFrom(ctx)
+	rows := pipelineRows(pipeline)
+	errs := []error{}
 	for _, loader := range funcs {
-		loader(pipeline)
+		err := loader(pipeline)
+		i.recordLoader(run, loaderName(loader), rows, err)
+		if err != nil {
+			errs = append(errs, err)
+		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 func (i *Ingest) Start() error {
@@ -248,7 +351,32 @@ func (i *Ingest) Start() error {
 		GlobalIngestLogger.Fatalf("HealthCheck failed, reason: %v\n", err)
 	}
 
-	dfms, err := i.IsDataExtracted()
+	// v1 of api, served during the load so the runs can be followed.
+	{
+		v1 := i.Router.Group("/v1")
+		v1.POST("api/ingest/:identifier", i.NewTvRecord)
+		v1.POST("api/ingest/tv", i.NewTvRecord)
+		v1.POST("api/ingest/tv/:identifier", i.NewTvRecord)
+		v1.POST("api/ingest/movie/:identifier", i.NewMovieRecord)
+		v1.GET("api/ingest/summaries", i.SummariesStatus)
+		v1.GET("api/ingest/history/:type/:identifier", i.CatalogHistory)
+		v1.POST("api/ingest/bulk", i.StartBulkIngest)
+		v1.GET("api/ingest/bulk", i.BulkStatus)
+		v1.GET("api/ingest/reports", i.Reports)
+		v1.GET("api/ingest/reports/:identifier", i.ReportById)
+		v1.GET("api/ingest/reports/:identifier/rejected", i.DeadLetters)
+		v1.GET("api/ingest/runs", i.Runs)
+		v1.GET("api/ingest/runs/:identifier", i.RunById)
+	}
+
+	go func() {
+		if err := i.Router.Run(":9998"); err != nil && err != http.ErrServerClosed {
+			i.Logger.Fatalf("Router failed: %v\n", err)
+		}
+	}()
+
+	i.failInterruptedRuns()
+	_, err := i.IsDataExtracted()
 	if err != nil {
 		i.Logger.Printf("Error: %v.\n", err)
 		i.Logger.Println("Service goes into `Idle mode`.")
@@ -256,49 +384,40 @@ func (i *Ingest) Start() error {
 		i.State = services.StateIdle
 	}
 
-	if err == nil && len(dfms) != 0 {
-		// Extract data here
-		i.Logger.Println("Extracting data for the first ever setup...")
-		path1 := filepath.Join(os.Getenv("DOWNLOAD_DIR"), "tmdb-movies-data/tmdb_5000_movies.csv")
-		path2 := filepath.Join(os.Getenv("DOWNLOAD_DIR"), "tmdb-movies-data/tmdb_5000_credits.csv")
-		path3 := filepath.Join(os.Getenv("DOWNLOAD_DIR"), "goodreads-books-data/books.csv")
-
+	if err == nil {
 		// Pipeline starts here
-		{
-			start := time.Now()
-			i.FirstMovieLoadPipeline(path1, path2)
-			i.FirstBookLoadPipeline(path3)
-			tx, err := i.DB.Begin()
-			updateStmt, err := tx.Prepare(`update read_table set read_at=1 where read_at=0`)
-			if err != nil {
-				i.Logger.Printf("couldn't update read_table, reason: %v\n", err)
+		start := time.Now()
+		if loaded := i.LoadDatasets(context.Background()); loaded > 0 {
+			i.RebuildAllTables()
+			if err := i.RefreshSummaries(); err != nil {
+				i.Logger.Printf("Summaries refresh failed, reason: %v\n", err)
 			}
-			defer updateStmt.Close()
-			if _, err := updateStmt.Exec(); err != nil {
-				i.Logger.Printf("couldn't update read_table, reason: %v\n", err)
+			i.Logger.Printf("Loading completed: %v, %v records.\n", time.Since(start), loaded)
+			// Only the changed items are sent, on the first load it is
+			// everything.
+			if !i.FullResync {
+				i.syncRecommenderInBackground(false)
 			}
-			elapsed := time.Since(start)
-			i.RebuildAllTables()
-			i.Logger.Printf("Loading completed: %v.\n", elapsed)
 		}
 		// Pipeline ends here
 	}
-	// v1 of api.
-	{
-		v1 := i.Router.Group("/v1")
-		v1.POST("api/ingest/:identifier", i.NewTvRecord)
-	}
 
-	go func() {
-		if err := i.Router.Run(":9998"); err != nil && err != http.ErrServerClosed {
-			i.Logger.Fatalf("Router failed: %v\n", err)
+	if i.FullResync {
+		if err := i.SyncRecommender(true); err != nil {
+			i.Logger.Printf("Recommender sync failed, reason: %v\n", err)
 		}
-	}()
+	}
+	refresherCtx, stopRefresher := context.WithCancel(context.Background())
+	defer stopRefresher()
+	go i.RunSummaryRefresher(refresherCtx)
+	go i.RunCatalogRefresher(refresherCtx)
+	go i.RunBulkScheduler(refresherCtx)
 
 	kill := make(chan os.Signal, 1)
 	signal.Notify(kill, syscall.SIGINT, syscall.SIGTERM)
 	sig := <-kill
 	i.Logger.Printf("Gracefully shutting down the server: %v\n.", sig)
+	stopRefresher()
 	i.State = services.StateDown
 	i.DB.Close()
 	return fmt.Errorf("server closed")
@@ -328,56 +447,83 @@ func (i *Ingest) HealthCheck() error {
 	if i.MaxBatchSize <= 0 {
 		return fmt.Errorf("Incorrect batch size")
 	}
-	return nil
-}
 
-// FetchTvDataFromWeb fetches basic data about the movies that the title matches
-func (i *Ingest) FetchTvDataFromWeb(title string) (*utils.TmdbResponseContentSchema, error) {
-	url := utils.SanitizeUrl(os.Getenv("TMDB_FETCH_MOVIE_BASIC"), title)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
+	if i.SummariesInterval <= 0 {
+		return fmt.Errorf("Incorrect summaries interval")
 	}
 
-	req.Header.Add("accept", "application/json")
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %v", os.Getenv("TMDB_API_KEY")))
-	body, err := utils.DoRequest(req)
-	if err != nil {
-		return nil, err
+	if i.Seed == nil {
+		return fmt.Errorf("No seed config setup")
 	}
-	var respJson utils.TmdbResponseContentSchema
-	if err := json.Unmarshal(body, &respJson); err != nil {
-		return nil, err
+
+	if i.Tmdb == nil {
+		return fmt.Errorf("No TMDB client setup")
 	}
-	return &respJson, nil
+
+	if i.Refresher == nil {
+		return fmt.Errorf("No refresher config setup")
+	}
+
+	if i.Bulk == nil {
+		return fmt.Errorf("No bulk config setup")
+	}
+
+	if i.Sources == nil {
+		return fmt.Errorf("No sources setup")
+	}
+	return nil
 }
 
-// FetchTvDataFromWebSpecific fetches all data about the movie that the title matches
-func (i *Ingest) FetchTvDataFromWebSpecific(id uint64) (*utils.TmdbTvSchema, error) {
-	url := utils.SanitizeUrl(os.Getenv("TMDB_FETCH_MOVIE_SPECIFIC"), strconv.FormatUint(id, 10))
-	req, err := http.NewRequest("GET", url, nil)
+// FetchTvDataFromWeb fetches basic data about the series that the title
+// matches, first aired in the year unless it is zero.
+func (i *Ingest) FetchTvDataFromWeb(ctx context.Context, title string, year int) (*utils.TmdbResponseContentSchema, error) {
+	return i.Tmdb.SearchTv(ctx, title, year, 1)
+}
+
+// FetchTvDataFromWebSpecific fetches all data about the series with the given id
+func (i *Ingest) FetchTvDataFromWebSpecific(ctx context.Context, id uint64) (*utils.TmdbTvSchema, error) {
+	return i.Tmdb.Tv(ctx, id)
+}
+
+// FetchMovieDataFromWeb fetches basic data about the movies that the title matches
+func (i *Ingest) FetchMovieDataFromWeb(ctx context.Context, title string) (*utils.TmdbResponseContentSchema, error) {
+	return i.Tmdb.SearchMovie(ctx, title, 1)
+}
+
+// FetchMovieDataFromWebSpecific fetches the movie with the given id together
+// with its credits and keywords. Missing credits or keywords are only logged.
+func (i *Ingest) FetchMovieDataFromWebSpecific(ctx context.Context, id uint64) (*database.MovieInsertable, error) {
+	m, err := i.Tmdb.Movie(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("accept", "application/json")
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %v", os.Getenv("TMDB_API_KEY")))
-	body, err := utils.DoRequest(req)
+	credits, err := i.Tmdb.MovieCredits(ctx, id)
 	if err != nil {
-		return nil, err
+		i.Logger.Printf("couldn't fetch the credits of %v, reason: %v\n", id, err)
 	}
-	var m utils.TmdbTvSchema
-	if err := json.Unmarshal(body, &m); err != nil {
-		return nil, err
+	keywords, err := i.Tmdb.MovieKeywords(ctx, id)
+	if err != nil {
+		i.Logger.Printf("couldn't fetch the keywords of %v, reason: %v\n", id, err)
 	}
-	return &m, nil
+	return m.IntoMovieInsertable(credits, keywords), nil
 }
 
-func (i *Ingest) NewTvRecord(ctx *gin.Context) {
-	var uc services.UriContent[string]
-	uc.Content = ctx.Param("identifier")
-	res, err := i.FetchTvDataFromWeb(uc.Content)
+// NewMovieRecord fetches the most popular movie matching the title and loads
+// it with its genres, keywords and credits.
+func (i *Ingest) NewMovieRecord(ctx *gin.Context) {
+	title := strings.TrimSpace(ctx.Param("identifier"))
+	if title == "" {
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	res, err := i.FetchMovieDataFromWeb(ctx, title)
 	if err != nil {
-		i.Logger.Printf("couldn't fetch the basic data %v\n", err)
+		i.Logger.Printf("couldn't fetch the basic data of %v, reason: %v\n", title, err)
+		services.NewStatusContentRequest(ctx, tmdbErrorStatus(err), services.InternalMessage)
+		return
+	}
+	if len(res.Results) == 0 {
+		services.NewStatusContentRequest(ctx, http.StatusNotFound, "no movie matches the title")
 		return
 	}
 	sort.Slice(
@@ -385,24 +531,56 @@ func (i *Ingest) NewTvRecord(ctx *gin.Context) {
 		func(i, j int) bool {
 			return res.Results[i].Popularity > res.Results[j].Popularity
 		})
-	relevantID := res.Results[0].Id
-	tmdbSchema, err := i.FetchTvDataFromWebSpecific(relevantID)
-	if err != nil {
-		i.Logger.Printf("couldn't fetch the specific data %v\n", err)
+	id := res.Results[0].Id
+
+	var present bool
+	if err := i.DB.QueryRowContext(ctx, `select exists(select 1 from movies
+		where tmdb_id=?)`, id).Scan(&present); err != nil {
+		i.Logger.Printf("couldn't check the movie %v, reason: %v\n", id, err)
+		services.NewStatusContentRequest(ctx, http.StatusInternalServerError, services.InternalMessage)
 		return
 	}
-	mi := tmdbSchema.IntoMovieInsertable()
-	if mi == nil {
-		i.Logger.Printf("couldn't transform into MovieInsertable.\n")
+	mi, err := i.FetchMovieDataFromWebSpecific(ctx, id)
+	if err != nil {
+		i.Logger.Printf("couldn't fetch the movie %v, reason: %v\n", id, err)
+		services.NewStatusContentRequest(ctx, tmdbErrorStatus(err), services.InternalMessage)
 		return
 	}
 	ins, err := database.CastFromMovieInsertableToInsertable(mi)
 	if err != nil {
 		i.Logger.Println(err)
+		services.NewStatusContentRequest(ctx, http.StatusInternalServerError, services.InternalMessage)
 		return
 	}
 	mis := []*database.Insertable{&ins}
-	i.InsertMoviePipeline(&mis)
+	if err := i.InsertMoviePipeline(ctx, &mis); err != nil {
+		i.Logger.Printf("couldn't load the movie %v, reason: %v\n", id, err)
+		services.NewStatusContentRequest(ctx, http.StatusInternalServerError, services.InternalMessage)
+		return
+	}
+
+	if present {
+		services.NewStatusContentRequest(ctx, http.StatusOK, MovieRecordResponse{
+			Status: RecordPresent, TmdbId: id, Title: mi.Title})
+		return
+	}
+	services.NewStatusContentRequest(ctx, http.StatusCreated, MovieRecordResponse{
+		Status: RecordInserted, TmdbId: id, Title: mi.Title})
+	i.refreshSummariesInBackground()
+	i.syncRecommenderInBackground(false)
+}
+
+// MergeSeriesPipeline loads the series with their seasons and networks.
+func (i *Ingest) MergeSeriesPipeline(ctx context.Context, series *[]*database.Insertable) error {
+	sip, err := database.NewInsertPipeline(series)
+	if err != nil {
+		return fmt.Errorf("cannot create pipeline, %v\n", err)
+	}
+	if err := i.Load(ctx, &sip, database.MergeIntoSeries(i.DB, &i.MaxBatchSize)); err != nil {
+		i.Logger.Printf("Error while loading series, reason: %v\n", err)
+		return err
+	}
+	return nil
 }
 
 // ExposeConnection exposes configuration.
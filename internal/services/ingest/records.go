@@ -0,0 +1,214 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/tmdb"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/utils"
+)
+
+const (
+	// DominantPopularity is how many times more popular than the next match
+	// a series has to be, to be picked when the title matches several.
+	DominantPopularity = 3.0
+	// MaxCandidates is how many matches are returned for an ambiguous title.
+	MaxCandidates = 10
+)
+
+// What happened to the requested title.
+const (
+	RecordInserted = "inserted"
+	RecordUpdated  = "updated"
+	RecordPresent  = "present"
+)
+
+// TvRecordResponse is the answer of NewTvRecord.
+type TvRecordResponse struct {
+	Status string                     `json:"status"`
+	Series *database.SeriesSelectable `json:"series"`
+}
+
+// MovieRecordResponse is the answer of NewMovieRecord.
+type MovieRecordResponse struct {
+	Status string `json:"status"`
+	TmdbId uint64 `json:"tmdb_id"`
+	Title  string `json:"title"`
+}
+
+// TvCandidate is one of the series an ambiguous title matches, it can be
+// requested again by `tmdb_id`.
+type TvCandidate struct {
+	TmdbId       uint64  `json:"tmdb_id"`
+	Name         string  `json:"name"`
+	OriginalName string  `json:"original_name"`
+	FirstAirDate string  `json:"first_air_date"`
+	Popularity   float64 `json:"popularity"`
+}
+
+// TvAmbiguousResponse is the answer of NewTvRecord when the title matches
+// several series.
+type TvAmbiguousResponse struct {
+	Message    string        `json:"message"`
+	Candidates []TvCandidate `json:"candidates"`
+}
+
+// NewTvRecord fetches the series matching the title and loads it with its
+// seasons and networks. Query parameters: `year` of the first air date and
+// `tmdb_id`, which skips the search.
+func (i *Ingest) NewTvRecord(ctx *gin.Context) {
+	title := strings.TrimSpace(ctx.Param("identifier"))
+	var year int
+	var id uint64
+	var err error
+	if q := ctx.Query("year"); q != "" {
+		if year, err = strconv.Atoi(q); err != nil || year <= 0 {
+			services.NewStatusContentRequest(ctx, http.StatusBadRequest, "invalid year")
+			return
+		}
+	}
+	if q := ctx.Query("tmdb_id"); q != "" {
+		if id, err = strconv.ParseUint(q, 10, 64); err != nil || id == 0 {
+			services.NewStatusContentRequest(ctx, http.StatusBadRequest, "invalid tmdb_id")
+			return
+		}
+	}
+	if id == 0 && title == "" {
+		services.NewStatusContentRequest(ctx, http.StatusBadRequest, services.InvalidRequestMessage)
+		return
+	}
+
+	if id == 0 {
+		res, err := i.FetchTvDataFromWeb(ctx, title, year)
+		if err != nil {
+			i.Logger.Printf("couldn't fetch the basic data of %v, reason: %v\n", title, err)
+			services.NewStatusContentRequest(ctx, tmdbErrorStatus(err), services.InternalMessage)
+			return
+		}
+		match, candidates := matchSeries(res.Results, title, year)
+		if match == nil && len(candidates) == 0 {
+			services.NewStatusContentRequest(ctx, http.StatusNotFound, "no series matches the title")
+			return
+		}
+		if match == nil {
+			services.NewStatusContentRequest(ctx, http.StatusConflict, TvAmbiguousResponse{
+				Message:    "the title matches several series, pass `year` or `tmdb_id`",
+				Candidates: candidates,
+			})
+			return
+		}
+		id = match.Id
+	}
+
+	status, ss, err := i.loadTvRecord(ctx, id)
+	if err != nil {
+		i.Logger.Printf("couldn't load the series %v, reason: %v\n", id, err)
+		code := http.StatusInternalServerError
+		var te *tmdb.Error
+		if errors.As(err, &te) {
+			code = tmdbErrorStatus(err)
+		}
+		services.NewStatusContentRequest(ctx, code, services.InternalMessage)
+		return
+	}
+	code := http.StatusOK
+	if status == RecordInserted {
+		code = http.StatusCreated
+	}
+	services.NewStatusContentRequest(ctx, code, TvRecordResponse{Status: status, Series: ss})
+	if status != RecordPresent {
+		i.syncRecommenderInBackground(false)
+	}
+}
+
+// loadTvRecord fetches the series and merges it into the catalog, the stored
+// row is compared before and after to tell what happened.
+func (i *Ingest) loadTvRecord(ctx context.Context, id uint64) (string, *database.SeriesSelectable, error) {
+	before, err := database.ScanSeries(i.DB.QueryRowContext(ctx, `call get_series_by_id(?)`, id))
+	if err != nil && err != sql.ErrNoRows {
+		return "", nil, err
+	}
+	tmdbSchema, err := i.FetchTvDataFromWebSpecific(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	var ins database.Insertable = tmdbSchema.IntoSeriesInsertable()
+	sis := []*database.Insertable{&ins}
+	if err := i.MergeSeriesPipeline(ctx, &sis); err != nil {
+		return "", nil, err
+	}
+	after, err := database.ScanSeries(i.DB.QueryRowContext(ctx, `call get_series_by_id(?)`, id))
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch {
+	case before == nil:
+		return RecordInserted, after, nil
+	case reflect.DeepEqual(before, after):
+		return RecordPresent, after, nil
+	}
+	return RecordUpdated, after, nil
+}
+
+// matchSeries picks the series the title refers to. The exact title matches
+// are preferred, then the most popular one if it dominates the others. It
+// returns the candidates if the title is ambiguous, nothing if no series
+// matches at all.
+func matchSeries(results []utils.TmdbResultSchema, title string, year int) (*utils.TmdbResultSchema, []TvCandidate) {
+	matching := []utils.TmdbResultSchema{}
+	exact := []utils.TmdbResultSchema{}
+	for _, r := range results {
+		if year > 0 && !strings.HasPrefix(r.FirstAirDate, strconv.Itoa(year)) {
+			continue
+		}
+		matching = append(matching, r)
+		if strings.EqualFold(r.Name, title) || strings.EqualFold(r.OriginalName, title) {
+			exact = append(exact, r)
+		}
+	}
+	if len(exact) > 0 {
+		matching = exact
+	}
+	if len(matching) == 0 {
+		return nil, nil
+	}
+
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].Popularity > matching[j].Popularity
+	})
+	if len(matching) == 1 || matching[0].Popularity >= DominantPopularity*matching[1].Popularity {
+		return &matching[0], nil
+	}
+	candidates := make([]TvCandidate, 0, MaxCandidates)
+	for _, r := range matching[:min(len(matching), MaxCandidates)] {
+		candidates = append(candidates, TvCandidate{
+			TmdbId:       r.Id,
+			Name:         r.Name,
+			OriginalName: r.OriginalName,
+			FirstAirDate: r.FirstAirDate,
+			Popularity:   r.Popularity,
+		})
+	}
+	return nil, candidates
+}
+
+// tmdbErrorStatus maps the errors of the TMDB client to the reply statuses.
+func tmdbErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, tmdb.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, tmdb.ErrUnauthorized), errors.Is(err, tmdb.ErrRateLimited):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
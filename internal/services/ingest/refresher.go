@@ -0,0 +1,293 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/tmdb"
+	"github.com/spf13/viper"
+)
+
+const (
+	// DefaultRefresherInterval is how often, in seconds, the titles are
+	// refreshed from TMDB.
+	DefaultRefresherInterval = 3600
+	DefaultRefresherBatch    = 50
+	// DefaultRefresherMinAge is how long, in seconds, a refreshed title is
+	// left alone.
+	DefaultRefresherMinAge = 86400
+)
+
+// catalogTables maps the catalog types to their tables.
+var catalogTables map[string]string = map[string]string{
+	"movie": "movies",
+	"tv":    "series",
+}
+
+// RefresherConfig is read from the `Refresher` section of the ingest service's
+// config.
+type RefresherConfig struct {
+	Interval int `mapstructure:"interval"`
+	// Batch is how many titles of every type are refreshed per cycle, zero
+	// disables the refresher.
+	Batch  int `mapstructure:"batch"`
+	MinAge int `mapstructure:"min_age"`
+}
+
+// CatalogState holds the fields of a title that change after its release.
+type CatalogState struct {
+	Popularity   float32
+	Rating       float32
+	TotalRatings uint64
+	Status       string
+}
+
+// CatalogChange is a single row of `catalog_history`.
+type CatalogChange struct {
+	Field     string    `json:"field"`
+	OldValue  *string   `json:"old_value"`
+	NewValue  *string   `json:"new_value"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// NewRefresherConfig reads the refresher configuration, the defaults are used
+// if the section is missing.
+func NewRefresherConfig(tableName string, v *viper.Viper) *RefresherConfig {
+	c := RefresherConfig{}
+	if v != nil && v.IsSet(tableName) {
+		if err := v.UnmarshalKey(tableName, &c); err != nil {
+			GlobalIngestLogger.Printf("Got error while unmarshalling: %v\n", err)
+		}
+	}
+	if c.Interval <= 0 {
+		c.Interval = DefaultRefresherInterval
+	}
+	// zero batch is a valid setting, only a missing one gets the default
+	if v == nil || !v.IsSet(tableName+".batch") {
+		c.Batch = DefaultRefresherBatch
+	}
+	if c.Batch < 0 {
+		c.Batch = 0
+	}
+	if c.MinAge <= 0 {
+		c.MinAge = DefaultRefresherMinAge
+	}
+	return &c
+}
+
+// WithRefresherConfig sets how the titles are refreshed from TMDB.
+func WithRefresherConfig(c *RefresherConfig) func(i *Ingest) {
+	return func(i *Ingest) {
+		i.Refresher = c
+	}
+}
+
+// fields returns the state formatted the way it is kept in `catalog_history`.
+func (cs *CatalogState) fields() map[string]string {
+	return map[string]string{
+		"popularity":    strconv.FormatFloat(float64(cs.Popularity), 'f', -1, 32),
+		"rating":        strconv.FormatFloat(float64(cs.Rating), 'f', -1, 32),
+		"total_ratings": strconv.FormatUint(cs.TotalRatings, 10),
+		"status":        cs.Status,
+	}
+}
+
+// fetchCatalogState returns the current state of the title on TMDB. The
+// statuses unknown to the table are replaced by the current one.
+func (i *Ingest) fetchCatalogState(ctx context.Context, itemType string, id uint64,
+	current *CatalogState) (*CatalogState, error) {
+	var cs CatalogState
+	switch itemType {
+	case "movie":
+		m, err := i.Tmdb.Movie(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		cs = CatalogState{float32(m.Popularity), float32(m.VoteAverage), m.VoteCount, m.Status}
+		if !database.MovieStatuses[cs.Status] {
+			cs.Status = current.Status
+		}
+	case "tv":
+		t, err := i.Tmdb.Tv(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		cs = CatalogState{float32(t.Popularity), float32(t.VoteAverage), t.VoteCount, t.Status}
+		if !database.SeriesStatuses[cs.Status] {
+			cs.Status = current.Status
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %v", itemType)
+	}
+	return &cs, nil
+}
+
+// RefreshTitle fetches the title from TMDB, updates the changed fields and
+// records them in `catalog_history`. It returns how many fields changed.
+func (i *Ingest) RefreshTitle(ctx context.Context, itemType string, id uint64) (int, error) {
+	table, ok := catalogTables[itemType]
+	if !ok {
+		return 0, fmt.Errorf("unknown type %v", itemType)
+	}
+
+	var current CatalogState
+	var status sql.NullString
+	if err := i.DB.QueryRowContext(ctx, `select coalesce(popularity, 0),
+		coalesce(rating, 0), coalesce(total_ratings, 0), status
+		from `+table+` where tmdb_id=?`, id).Scan(&current.Popularity,
+		&current.Rating, &current.TotalRatings, &status); err != nil {
+		return 0, err
+	}
+	current.Status = status.String
+
+	next, err := i.fetchCatalogState(ctx, itemType, id, &current)
+	if errors.Is(err, tmdb.ErrNotFound) {
+		// The title is gone from TMDB, it is not asked for again until
+		// it becomes stale.
+		i.Logger.Printf("%v %v not found on TMDB\n", itemType, id)
+		_, err = i.DB.ExecContext(ctx, `update `+table+` set
+			refreshed_at=current_timestamp, updated_at=updated_at
+			where tmdb_id=?`, id)
+		return 0, err
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := i.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	changed := 0
+	oldFields, newFields := current.fields(), next.fields()
+	for _, field := range []string{"popularity", "rating", "total_ratings", "status"} {
+		if oldFields[field] == newFields[field] {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `insert into catalog_history
+			(type, tmdb_id, field, old_value, new_value) values (?, ?, ?, ?, ?)`,
+			itemType, id, field, oldFields[field], newFields[field]); err != nil {
+			return 0, err
+		}
+		changed++
+	}
+	// updated_at is kept when nothing changed, otherwise every refreshed
+	// title would be synced with the recommender.
+	if _, err := tx.ExecContext(ctx, `update `+table+` set popularity=?,
+		rating=?, total_ratings=?, status=?, refreshed_at=current_timestamp,
+		updated_at=if(?, current_timestamp, updated_at) where tmdb_id=?`,
+		next.Popularity, next.Rating, next.TotalRatings, next.Status,
+		changed > 0, id); err != nil {
+		return 0, err
+	}
+	return changed, tx.Commit()
+}
+
+// RefreshCatalog refreshes the most viewed and the stalest titles of every
+// type, returns how many fields changed.
+func (i *Ingest) RefreshCatalog(ctx context.Context) (int, error) {
+	start := time.Now()
+	titles, changes := 0, 0
+	for _, itemType := range []string{"movie", "tv"} {
+		ids, err := i.refreshCandidates(ctx, itemType)
+		if err != nil {
+			return changes, err
+		}
+		for _, id := range ids {
+			changed, err := i.RefreshTitle(ctx, itemType, id)
+			if errors.Is(err, tmdb.ErrUnauthorized) || ctx.Err() != nil {
+				return changes, err
+			}
+			if err != nil {
+				i.Logger.Printf("couldn't refresh %v %v, reason: %v\n", itemType, id, err)
+				continue
+			}
+			titles++
+			changes += changed
+		}
+	}
+	i.Logger.Printf("Catalog refreshed: %v, %v titles, %v changes.\n",
+		time.Since(start), titles, changes)
+	return changes, nil
+}
+
+func (i *Ingest) refreshCandidates(ctx context.Context, itemType string) ([]uint64, error) {
+	rows, err := i.DB.QueryContext(ctx, `call get_refresh_candidates(?, ?, ?)`,
+		itemType, i.Refresher.MinAge, i.Refresher.Batch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []uint64{}
+	for rows.Next() {
+		var id uint64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// RunCatalogRefresher refreshes the catalog periodically until the context is
+// cancelled. It does nothing without a TMDB key.
+func (i *Ingest) RunCatalogRefresher(ctx context.Context) {
+	if i.Refresher.Batch == 0 || i.Tmdb.ApiKey == "" {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(i.Refresher.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changes, err := i.RefreshCatalog(ctx)
+			if err != nil {
+				i.Logger.Printf("Catalog refresh failed, reason: %v\n", err)
+			}
+			if changes > 0 {
+				i.refreshSummariesInBackground()
+				i.syncRecommenderInBackground(false)
+			}
+		}
+	}
+}
+
+// CatalogHistory returns every recorded change of the title, oldest first.
+func (i *Ingest) CatalogHistory(ctx *gin.Context) {
+	itemType := ctx.Param("type")
+	id, err := strconv.ParseUint(ctx.Param("identifier"), 10, 64)
+	if _, ok := catalogTables[itemType]; !ok || err != nil {
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+
+	rows, err := i.DB.Query(`call get_catalog_history(?, ?)`, itemType, id)
+	if err != nil {
+		i.Logger.Printf("couldn't fetch the catalog history, reason: %v\n", err)
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	defer rows.Close()
+
+	changes := []CatalogChange{}
+	for rows.Next() {
+		var cc CatalogChange
+		if err := rows.Scan(&cc.Field, &cc.OldValue, &cc.NewValue, &cc.ChangedAt); err != nil {
+			i.Logger.Printf("couldn't scan the catalog change, reason: %v\n", err)
+			continue
+		}
+		changes = append(changes, cc)
+	}
+	services.NewGoodContentRequest(ctx, changes)
+}
@@ -0,0 +1,294 @@
+package ingest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/utils"
+)
+
+const (
+	// MalformedRecordReason rejects the records the streamer couldn't parse.
+	MalformedRecordReason = "malformed record"
+	// MaxDeadLetters is how many rejected rows of a file are kept per report,
+	// the others are only counted.
+	MaxDeadLetters = 10000
+	// MaxReports is how many of the latest reports are listed.
+	MaxReports              = 20
+	DefaultDeadLettersLimit = 100
+	MaxDeadLettersLimit     = 1000
+)
+
+// FileReport counts the rows of a single file.
+type FileReport struct {
+	File     string `json:"file"`
+	Read     int64  `json:"read"`
+	Accepted int64  `json:"accepted"`
+	// Rejected is keyed by the reason.
+	Rejected map[string]int64 `json:"rejected"`
+}
+
+// IngestReport is the summary of a single load of the datasets.
+type IngestReport struct {
+	Id         int64         `json:"id"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt *time.Time    `json:"finished_at"`
+	Files      []*FileReport `json:"files"`
+}
+
+// DeadLetter is a single row of `ingest_dead_letters`.
+type DeadLetter struct {
+	File      string    `json:"file"`
+	Line      int64     `json:"line"`
+	Reason    string    `json:"reason"`
+	Error     string    `json:"error"`
+	Raw       string    `json:"raw"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// beginReport starts the report of a load, the dead letters are only logged if
+// it can't be saved.
+func (i *Ingest) beginReport() {
+	report := &IngestReport{StartedAt: time.Now(), Files: []*FileReport{}}
+	if res, err := i.DB.Exec(`insert into ingest_reports () values ()`); err != nil {
+		i.Logger.Printf("couldn't save the ingest report, reason: %v\n", err)
+	} else if report.Id, err = res.LastInsertId(); err != nil {
+		i.Logger.Printf("couldn't save the ingest report, reason: %v\n", err)
+	}
+	i.reportMu.Lock()
+	i.report = report
+	i.reportMu.Unlock()
+}
+
+// finishReport logs and saves the summary of the load.
+func (i *Ingest) finishReport() {
+	i.reportMu.Lock()
+	defer i.reportMu.Unlock()
+	if i.report == nil {
+		return
+	}
+	finishedAt := time.Now()
+	i.report.FinishedAt = &finishedAt
+	for _, fr := range i.report.Files {
+		var rejected int64
+		for _, n := range fr.Rejected {
+			rejected += n
+		}
+		i.Logger.Printf("%v: %v read, %v accepted, %v rejected %v.\n", fr.File,
+			fr.Read, fr.Accepted, rejected, fr.Rejected)
+	}
+	if i.report.Id == 0 {
+		return
+	}
+	summary, err := json.Marshal(i.report.Files)
+	if err != nil {
+		i.Logger.Printf("couldn't save the ingest report, reason: %v\n", err)
+		return
+	}
+	if _, err := i.DB.Exec(`update ingest_reports set finished_at=?, summary=?
+		where ID=?`, finishedAt, summary, i.report.Id); err != nil {
+		i.Logger.Printf("couldn't save the ingest report, reason: %v\n", err)
+	}
+}
+
+// fileReport returns the counts of the file given by its full path. Outside
+// of a load the counts go nowhere.
+func (i *Ingest) fileReport(path string) *FileReport {
+	name, err := filepath.Rel(os.Getenv("DOWNLOAD_DIR"), path)
+	if err != nil {
+		name = path
+	}
+	i.reportMu.Lock()
+	defer i.reportMu.Unlock()
+	if i.report == nil || i.report.FinishedAt != nil {
+		return &FileReport{File: name, Rejected: map[string]int64{}}
+	}
+	for _, fr := range i.report.Files {
+		if fr.File == name {
+			return fr
+		}
+	}
+	fr := &FileReport{File: name, Rejected: map[string]int64{}}
+	i.report.Files = append(i.report.Files, fr)
+	return fr
+}
+
+// extractRecord runs the extractors over the record, the rejected records are
+// counted and sent to the dead letters. The header isn't counted.
+func (i *Ingest) extractRecord(fr *FileReport, r *utils.Record, funcs ...ExtractFunc) (database.Insertable, bool) {
+	if r.Err != nil {
+		i.reject(fr, r, MalformedRecordReason, r.Err)
+		return nil, false
+	}
+	var data database.Insertable
+	for _, extractor := range funcs {
+		if err := extractor(&r.Fields, &data); err != nil {
+			if errors.Is(err, database.ErrHeaderRow) {
+				return nil, false
+			}
+			i.reject(fr, r, database.RejectReason(err), err)
+			return nil, false
+		}
+	}
+	i.reportMu.Lock()
+	fr.Read++
+	fr.Accepted++
+	i.reportMu.Unlock()
+	return data, true
+}
+
+func (i *Ingest) reject(fr *FileReport, r *utils.Record, reason string, err error) {
+	i.Logger.Printf("Got error while extracting row %v of %v: %v\n", r.Row, fr.File, err)
+	i.reportMu.Lock()
+	fr.Read++
+	fr.Rejected[reason]++
+	var rejected int64
+	for _, n := range fr.Rejected {
+		rejected += n
+	}
+	var reportId int64
+	if i.report != nil && i.report.FinishedAt == nil {
+		reportId = i.report.Id
+	}
+	i.reportMu.Unlock()
+	if reportId == 0 || rejected > MaxDeadLetters {
+		return
+	}
+
+	raw := utils.FormatRecord(r)
+	if _, err := i.DB.Exec(`insert into ingest_dead_letters(report_id, file, line,
+		reason, error, raw) values (?, ?, ?, ?, ?, ?)`, reportId, fr.File, r.Row+1,
+		reason, err.Error(), utils.TruncateUtf8(raw, utils.MaxRawRecord)); err != nil {
+		i.Logger.Printf("couldn't save the dead letter, reason: %v\n", err)
+	}
+}
+
+// scanReport reads a row of `ingest_reports`.
+func (i *Ingest) scanReport(row interface{ Scan(...any) error }) (*IngestReport, error) {
+	var report IngestReport
+	var finishedAt sql.NullTime
+	var summary sql.NullString
+	if err := row.Scan(&report.Id, &report.StartedAt, &finishedAt, &summary); err != nil {
+		return nil, err
+	}
+	if finishedAt.Valid {
+		report.FinishedAt = &finishedAt.Time
+	}
+	report.Files = []*FileReport{}
+	if summary.Valid {
+		if err := json.Unmarshal([]byte(summary.String), &report.Files); err != nil {
+			return nil, err
+		}
+	}
+	return &report, nil
+}
+
+// Reports returns the summaries of the latest loads, newest first.
+func (i *Ingest) Reports(ctx *gin.Context) {
+	rows, err := i.DB.Query(`select ID, started_at, finished_at, summary
+		from ingest_reports order by ID desc limit ?`, MaxReports)
+	if err != nil {
+		i.Logger.Printf("couldn't fetch the ingest reports, reason: %v\n", err)
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	defer rows.Close()
+
+	reports := []*IngestReport{}
+	for rows.Next() {
+		report, err := i.scanReport(rows)
+		if err != nil {
+			i.Logger.Printf("couldn't scan the ingest report, reason: %v\n", err)
+			continue
+		}
+		reports = append(reports, report)
+	}
+	i.reportMu.Lock()
+	defer i.reportMu.Unlock()
+	for idx, report := range reports {
+		if i.report != nil && report.Id == i.report.Id && i.report.FinishedAt == nil {
+			reports[idx] = i.report
+		}
+	}
+	services.NewGoodContentRequest(ctx, reports)
+}
+
+// ReportById returns the summary of the load, the running one is updated
+// live.
+func (i *Ingest) ReportById(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("identifier"), 10, 64)
+	if err != nil {
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	i.reportMu.Lock()
+	if i.report != nil && i.report.Id == id && i.report.FinishedAt == nil {
+		services.NewGoodContentRequest(ctx, i.report)
+		i.reportMu.Unlock()
+		return
+	}
+	i.reportMu.Unlock()
+
+	report, err := i.scanReport(i.DB.QueryRow(`select ID, started_at, finished_at,
+		summary from ingest_reports where ID=?`, id))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			i.Logger.Printf("couldn't fetch the ingest report, reason: %v\n", err)
+		}
+		services.NewBadContentRequest(ctx, "report doesn't exist")
+		return
+	}
+	services.NewGoodContentRequest(ctx, report)
+}
+
+// DeadLetters returns the rows rejected during the load. Query parameters:
+// `reason`, `file`, `limit` and `offset`.
+func (i *Ingest) DeadLetters(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("identifier"), 10, 64)
+	if err != nil {
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(DefaultDeadLettersLimit)))
+	if err != nil || limit <= 0 {
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+
+	rows, err := i.DB.Query(`select file, line, reason, error, raw, created_at
+		from ingest_dead_letters where report_id=? and (?='' or reason=?)
+		and (?='' or file=?) order by ID limit ? offset ?`, id,
+		ctx.Query("reason"), ctx.Query("reason"), ctx.Query("file"),
+		ctx.Query("file"), min(limit, MaxDeadLettersLimit), offset)
+	if err != nil {
+		i.Logger.Printf("couldn't fetch the dead letters, reason: %v\n", err)
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	defer rows.Close()
+
+	letters := []DeadLetter{}
+	for rows.Next() {
+		var dl DeadLetter
+		if err := rows.Scan(&dl.File, &dl.Line, &dl.Reason, &dl.Error, &dl.Raw,
+			&dl.CreatedAt); err != nil {
+			i.Logger.Printf("couldn't scan the dead letter, reason: %v\n", err)
+			continue
+		}
+		letters = append(letters, dl)
+	}
+	services.NewGoodContentRequest(ctx, letters)
+}
@@ -0,0 +1,280 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/utils"
+)
+
+const (
+	RunRunning   = "running"
+	RunCompleted = "completed"
+	RunFailed    = "failed"
+	// MaxLoaderErrors is how many errors of a loader are kept per run, the
+	// others are only counted.
+	MaxLoaderErrors = 10
+	// MaxLoaderError limits, in bytes, a single kept error.
+	MaxLoaderError   = 1024
+	DefaultRunsLimit = 20
+	MaxRunsLimit     = 100
+)
+
+// LoaderStats counts the rows handed to a single loader.
+type LoaderStats struct {
+	Loaded int64 `json:"loaded"`
+	// Failed is the number of rows of the batches the loader failed on.
+	Failed int64    `json:"failed"`
+	Errors []string `json:"errors"`
+}
+
+// IngestRun is a single run of a loading source.
+type IngestRun struct {
+	Id         int64      `json:"id"`
+	Source     string     `json:"source"`
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	// Loaded is the number of loaded records, it is set when the run ends.
+	Loaded int64 `json:"loaded"`
+	// ReportId is the report of the load the run is a part of.
+	ReportId *int64                  `json:"report_id"`
+	Loaders  map[string]*LoaderStats `json:"loaders"`
+	Error    string                  `json:"error,omitempty"`
+}
+
+type runKey struct{}
+
+// withRun makes Load count the rows of the loaders into the run.
+func withRun(ctx context.Context, run *IngestRun) context.Context {
+	return context.WithValue(ctx, runKey{}, run)
+}
+
+func runFrom(ctx context.Context) *IngestRun {
+	run, _ := ctx.Value(runKey{}).(*IngestRun)
+	return run
+}
+
+// loaderName returns the name of the function which built the loader, e.g.
+// `InsertIntoMoviesChunked`.
+func loaderName(loader LoadFunc) string {
+	f := runtime.FuncForPC(reflect.ValueOf(loader).Pointer())
+	if f == nil {
+		return "unknown"
+	}
+	name := f.Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	if parts := strings.Split(name, "."); len(parts) > 1 {
+		return parts[1]
+	}
+	return name
+}
+
+// failInterruptedRuns fails the runs left running by the previous process.
+func (i *Ingest) failInterruptedRuns() {
+	if _, err := i.DB.Exec(`update ingest_runs set status=?, error='interrupted',
+		finished_at=current_timestamp where status=?`, RunFailed, RunRunning); err != nil {
+		i.Logger.Printf("couldn't update the ingest runs, reason: %v\n", err)
+	}
+}
+
+// beginRun starts the run of the source, it is a part of the running load of
+// the datasets if there is one. The run is only kept in memory if it can't be
+// saved.
+func (i *Ingest) beginRun(source string) *IngestRun {
+	run := &IngestRun{Source: source, Status: RunRunning, StartedAt: time.Now(),
+		Loaders: map[string]*LoaderStats{}}
+	i.reportMu.Lock()
+	if i.report != nil && i.report.FinishedAt == nil && i.report.Id != 0 {
+		reportId := i.report.Id
+		run.ReportId = &reportId
+	}
+	i.reportMu.Unlock()
+
+	if res, err := i.DB.Exec(`insert into ingest_runs(source, status, report_id)
+		values (?, ?, ?)`, source, RunRunning, run.ReportId); err != nil {
+		i.Logger.Printf("couldn't save the ingest run, reason: %v\n", err)
+	} else if run.Id, err = res.LastInsertId(); err != nil {
+		i.Logger.Printf("couldn't save the ingest run, reason: %v\n", err)
+	}
+	i.runsMu.Lock()
+	i.runs = append(i.runs, run)
+	i.runsMu.Unlock()
+	return run
+}
+
+// recordLoader counts the rows handed to the loader, outside of a run they go
+// nowhere.
+func (i *Ingest) recordLoader(run *IngestRun, name string, rows int64, err error) {
+	if run == nil {
+		return
+	}
+	i.runsMu.Lock()
+	defer i.runsMu.Unlock()
+	stats, ok := run.Loaders[name]
+	if !ok {
+		stats = &LoaderStats{Errors: []string{}}
+		run.Loaders[name] = stats
+	}
+	if err == nil {
+		stats.Loaded += rows
+		return
+	}
+	stats.Failed += rows
+	if len(stats.Errors) < MaxLoaderErrors {
+		stats.Errors = append(stats.Errors, utils.TruncateUtf8(err.Error(), MaxLoaderError))
+	}
+}
+
+// finishRun logs and saves the outcome of the run.
+func (i *Ingest) finishRun(run *IngestRun, loaded int64, err error) {
+	i.runsMu.Lock()
+	defer i.runsMu.Unlock()
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Loaded = loaded
+	run.Status = RunCompleted
+	if err != nil {
+		run.Status = RunFailed
+		run.Error = err.Error()
+	}
+	for idx, r := range i.runs {
+		if r == run {
+			i.runs = append(i.runs[:idx], i.runs[idx+1:]...)
+			break
+		}
+	}
+	i.Logger.Printf("%v run %v: %v, %v records.\n", run.Source, run.Status,
+		finishedAt.Sub(run.StartedAt), loaded)
+	if run.Id == 0 {
+		return
+	}
+	loaders, err := json.Marshal(run.Loaders)
+	if err != nil {
+		i.Logger.Printf("couldn't save the ingest run, reason: %v\n", err)
+		return
+	}
+	if _, err := i.DB.Exec(`update ingest_runs set status=?, finished_at=?,
+		loaded=?, loaders=?, error=nullif(?, '') where ID=?`, run.Status, finishedAt,
+		loaded, loaders, run.Error, run.Id); err != nil {
+		i.Logger.Printf("couldn't save the ingest run, reason: %v\n", err)
+	}
+}
+
+// runningRun returns the run in progress, expects runsMu to be held.
+func (i *Ingest) runningRun(id int64) *IngestRun {
+	for _, run := range i.runs {
+		if run.Id != 0 && run.Id == id {
+			return run
+		}
+	}
+	return nil
+}
+
+// scanRun reads a row of `ingest_runs`.
+func (i *Ingest) scanRun(row interface{ Scan(...any) error }) (*IngestRun, error) {
+	var run IngestRun
+	var reportId sql.NullInt64
+	var finishedAt sql.NullTime
+	var loaders, runErr sql.NullString
+	if err := row.Scan(&run.Id, &run.Source, &run.Status, &reportId, &run.StartedAt,
+		&finishedAt, &run.Loaded, &loaders, &runErr); err != nil {
+		return nil, err
+	}
+	if reportId.Valid {
+		run.ReportId = &reportId.Int64
+	}
+	if finishedAt.Valid {
+		run.FinishedAt = &finishedAt.Time
+	}
+	run.Error = runErr.String
+	run.Loaders = map[string]*LoaderStats{}
+	if loaders.Valid {
+		if err := json.Unmarshal([]byte(loaders.String), &run.Loaders); err != nil {
+			return nil, err
+		}
+	}
+	return &run, nil
+}
+
+// Runs returns the latest runs, newest first, the running ones are updated
+// live. Query parameters: `source` and `limit`.
+func (i *Ingest) Runs(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(DefaultRunsLimit)))
+	if err != nil || limit <= 0 {
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	rows, err := i.DB.Query(`select ID, source, status, report_id, started_at,
+		finished_at, loaded, loaders, error from ingest_runs where (?='' or source=?)
+		order by ID desc limit ?`, ctx.Query("source"), ctx.Query("source"),
+		min(limit, MaxRunsLimit))
+	if err != nil {
+		i.Logger.Printf("couldn't fetch the ingest runs, reason: %v\n", err)
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	defer rows.Close()
+
+	runs := []*IngestRun{}
+	for rows.Next() {
+		run, err := i.scanRun(rows)
+		if err != nil {
+			i.Logger.Printf("couldn't scan the ingest run, reason: %v\n", err)
+			continue
+		}
+		runs = append(runs, run)
+	}
+	i.runsMu.Lock()
+	defer i.runsMu.Unlock()
+	for idx, run := range runs {
+		if running := i.runningRun(run.Id); running != nil {
+			runs[idx] = running
+		}
+	}
+	services.NewGoodContentRequest(ctx, runs)
+}
+
+// RunById returns the run, the running one is updated live.
+func (i *Ingest) RunById(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("identifier"), 10, 64)
+	if err != nil {
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	i.runsMu.Lock()
+	if running := i.runningRun(id); running != nil {
+		services.NewGoodContentRequest(ctx, running)
+		i.runsMu.Unlock()
+		return
+	}
+	i.runsMu.Unlock()
+
+	run, err := i.scanRun(i.DB.QueryRow(`select ID, source, status, report_id,
+		started_at, finished_at, loaded, loaders, error from ingest_runs where ID=?`, id))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			i.Logger.Printf("couldn't fetch the ingest run, reason: %v\n", err)
+		}
+		services.NewBadContentRequest(ctx, "run doesn't exist")
+		return
+	}
+	services.NewGoodContentRequest(ctx, run)
+}
+
+// pipelineRows returns the number of rows of the pipeline.
+func pipelineRows(pipeline *database.Insertable) int64 {
+	if ip, ok := (*pipeline).(*database.InsertPipeline); ok && ip.Data != nil {
+		return int64(len(*ip.Data))
+	}
+	return 0
+}
@@ -0,0 +1,85 @@
+package ingest
+
+import (
+	"context"
+
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/spf13/viper"
+)
+
+const (
+	// DefaultSeedRatings is the MovieLens subset shipped with The Movies
+	// Dataset, `ratings.csv` has 26 million rows.
+	DefaultSeedRatings = "ratings_small.csv"
+	DefaultSeedLike    = 4.0
+	DefaultSeedDislike = 2.0
+)
+
+// SeedConfig is read from the `Seed` section of the ingest service's config.
+type SeedConfig struct {
+	// Ratings is the ratings file of movies-data, empty disables the seeding.
+	Ratings string `mapstructure:"ratings"`
+	// Like is the lowest rating counted as a like.
+	Like float64 `mapstructure:"like"`
+	// Dislike is the highest rating counted as a dislike.
+	Dislike float64 `mapstructure:"dislike"`
+}
+
+// NewSeedConfig reads the seeding configuration, the defaults are used if the
+// section is missing.
+func NewSeedConfig(tableName string, v *viper.Viper) *SeedConfig {
+	c := SeedConfig{
+		Ratings: DefaultSeedRatings,
+		Like:    DefaultSeedLike,
+		Dislike: DefaultSeedDislike,
+	}
+	if v != nil && v.IsSet(tableName) {
+		if err := v.UnmarshalKey(tableName, &c); err != nil {
+			GlobalIngestLogger.Printf("Got error while unmarshalling: %v\n", err)
+		}
+	}
+	if c.Like <= c.Dislike {
+		c.Like, c.Dislike = DefaultSeedLike, DefaultSeedDislike
+	}
+	return &c
+}
+
+// WithSeedConfig sets how the MovieLens ratings are imported.
+func WithSeedConfig(c *SeedConfig) func(i *Ingest) {
+	return func(i *Ingest) {
+		i.Seed = c
+	}
+}
+
+// seedLoader loads the batches of MovieLens ratings of The Movies Dataset as
+// anonymous seed interactions, the movies are mapped to TMDB through the
+// links, whose name is relative to DOWNLOAD_DIR.
+func (i *Ingest) seedLoader(ctx context.Context, linksName string) BatchFunc {
+	var links []*database.Insertable
+	mapRatings := database.MapRatingsThroughLinks(i.Seed.Like, i.Seed.Dislike)
+	return func(batch []*database.Insertable) error {
+		if links == nil {
+			extracted, err := i.extractWithHeader(linksName, database.LinksFromStream)
+			if err != nil {
+				return err
+			}
+			links = extracted
+			i.Logger.Println("Links extraction completed.")
+		}
+
+		seeds, err := i.Transform(&batch, &links, mapRatings)
+		if err != nil {
+			return err
+		}
+		// neutral ratings and unlinked movies leave nothing to load
+		if len(seeds) == 0 {
+			return nil
+		}
+		sip, err := database.NewInsertPipeline(&seeds)
+		if err != nil {
+			return err
+		}
+		return i.Load(ctx, &sip, database.InsertIntoSeedInteractionsChunked(i.DB,
+			&i.MaxBatchSize))
+	}
+}
@@ -0,0 +1,246 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/utils"
+	"github.com/spf13/viper"
+)
+
+// Source is a dataset loaded on start. Its files are streamed with
+// checkpoints, every file gets its own extractors and loader.
+type Source interface {
+	// DataType is the `data_type` of the source in `read_table`.
+	DataType() string
+	// Discover returns the files of the source relative to DOWNLOAD_DIR, in
+	// the order they are loaded.
+	Discover(i *Ingest) ([]string, error)
+	// Extractors turn the records of the file into Insertables.
+	Extractors(i *Ingest, file string) ([]ExtractFunc, error)
+	// Loader loads a batch of the extracted records of the file.
+	Loader(ctx context.Context, i *Ingest, file string) (BatchFunc, error)
+}
+
+// SourceFactory builds the source from its configuration.
+type SourceFactory = func(c *SourceConfig) Source
+
+// SourceConfig is read from the `Sources.<name>` section of the ingest
+// service's config.
+type SourceConfig struct {
+	// Enabled is true unless set otherwise.
+	Enabled bool `mapstructure:"enabled"`
+	// Directory is relative to DOWNLOAD_DIR, the name of the source by
+	// default. It is also the key of the source in `read_table`.
+	Directory string `mapstructure:"directory"`
+	// Format overrides the format of the files picked by their extension,
+	// one of utils.Streamers.
+	Format string `mapstructure:"format"`
+}
+
+// DatasetSource is a registered source with its configuration.
+type DatasetSource struct {
+	Name   string
+	Config *SourceConfig
+	Source Source
+}
+
+type registeredSource struct {
+	name    string
+	factory SourceFactory
+}
+
+// registeredSources are loaded in this order, the bigger datasets go after the
+// TMDB 5000 and the Goodreads ones and are merged into them.
+var registeredSources []registeredSource = []registeredSource{
+	{"tmdb-movies-data", newTmdbMoviesSource},
+	{"goodreads-books-data", newGoodreadsBooksSource},
+	{"movies-data", newMoviesDataSource},
+	{"books-data", newBooksDataSource},
+	// There is no public concerts dataset, the files are provided by hand.
+	{"concerts-data", newConcertsSource},
+}
+
+// RegisterSource adds the source after the registered ones, or replaces the
+// one registered under the same name. It has to be called before NewSources.
+func RegisterSource(name string, f SourceFactory) {
+	for idx, rs := range registeredSources {
+		if rs.name == name {
+			registeredSources[idx].factory = f
+			return
+		}
+	}
+	registeredSources = append(registeredSources, registeredSource{name, f})
+}
+
+// NewSources builds the enabled sources, every one is configured by its own
+// subsection of tableName.
+func NewSources(tableName string, v *viper.Viper) []*DatasetSource {
+	sources := []*DatasetSource{}
+	for _, rs := range registeredSources {
+		key := tableName + "." + rs.name
+		c := SourceConfig{Enabled: true}
+		if v != nil && v.IsSet(key) {
+			if err := v.UnmarshalKey(key, &c); err != nil {
+				GlobalIngestLogger.Printf("Got error while unmarshalling: %v\n", err)
+			}
+		}
+		if v == nil || !v.IsSet(key+".enabled") {
+			c.Enabled = true
+		}
+		if !c.Enabled {
+			continue
+		}
+		if c.Directory == "" {
+			c.Directory = rs.name
+		}
+		sources = append(sources, &DatasetSource{rs.name, &c, rs.factory(&c)})
+	}
+	return sources
+}
+
+// WithSources sets the datasets loaded on start.
+func WithSources(sources []*DatasetSource) func(i *Ingest) {
+	return func(i *Ingest) {
+		i.Sources = sources
+	}
+}
+
+// registerSources adds the sources missing from `read_table`.
+func (i *Ingest) registerSources() {
+	for _, ds := range i.Sources {
+		if _, err := i.DB.Exec(`insert ignore into read_table(directory, data_type)
+			values (?, ?)`, ds.Config.Directory, ds.Source.DataType()); err != nil {
+			i.Logger.Printf("couldn't register the source %v, reason: %v\n", ds.Name, err)
+		}
+	}
+}
+
+// LoadSource streams every file of the source, the failed files don't stop
+// the others. Returns the number of loaded records.
+func (i *Ingest) LoadSource(ctx context.Context, ds *DatasetSource) (int64, error) {
+	files, err := ds.Source.Discover(i)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	errs := []error{}
+	for _, file := range files {
+		extractors, err := ds.Source.Extractors(i, file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		load, err := ds.Source.Loader(ctx, i, file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var loaded int64
+		if strings.EqualFold(filepath.Ext(file), ".json") {
+			loaded, err = i.LoadJsonFile(file, load, extractors...)
+		} else {
+			loaded, err = i.StreamFile(file, load, extractors...)
+		}
+		total += loaded
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return total, errors.Join(errs...)
+}
+
+// streamerFor returns the streamer of the file given by its full path. The
+// files of a source are read in its format, if it has one.
+func (i *Ingest) streamerFor(path string) (utils.Streamer, error) {
+	for _, ds := range i.Sources {
+		if ds.Config.Format == "" {
+			continue
+		}
+		dir := filepath.Join(os.Getenv("DOWNLOAD_DIR"), ds.Config.Directory)
+		if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return utils.StreamerFor(path, ds.Config.Format)
+		}
+	}
+	return utils.StreamerFor(path, "")
+}
+
+// globSource returns the files of the directory matching any of the patterns,
+// relative to DOWNLOAD_DIR.
+func globSource(directory string, patterns ...string) ([]string, error) {
+	files := []string{}
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(filepath.Join(os.Getenv("DOWNLOAD_DIR"),
+			directory, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			files = append(files, filepath.Join(directory, filepath.Base(path)))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no %v files in %v", strings.Join(patterns, ", "),
+			directory)
+	}
+	return files, nil
+}
+
+// tmdbMoviesSource is the TMDB 5000 dataset, the movies are joined with the
+// credits.
+type tmdbMoviesSource struct {
+	directory string
+}
+
+func newTmdbMoviesSource(c *SourceConfig) Source {
+	return &tmdbMoviesSource{c.Directory}
+}
+
+func (s *tmdbMoviesSource) DataType() string {
+	return "media"
+}
+
+func (s *tmdbMoviesSource) Discover(i *Ingest) ([]string, error) {
+	return []string{filepath.Join(s.directory, "tmdb_5000_movies.csv")}, nil
+}
+
+func (s *tmdbMoviesSource) Extractors(i *Ingest, file string) ([]ExtractFunc, error) {
+	return []ExtractFunc{database.TmdbMapFromStream}, nil
+}
+
+func (s *tmdbMoviesSource) Loader(ctx context.Context, i *Ingest, file string) (BatchFunc, error) {
+	return i.moviesLoader(ctx, filepath.Join(s.directory, "tmdb_5000_credits.csv")), nil
+}
+
+// goodreadsBooksSource is the Goodreads dataset.
+type goodreadsBooksSource struct {
+	directory string
+}
+
+func newGoodreadsBooksSource(c *SourceConfig) Source {
+	return &goodreadsBooksSource{c.Directory}
+}
+
+func (s *goodreadsBooksSource) DataType() string {
+	return "book"
+}
+
+func (s *goodreadsBooksSource) Discover(i *Ingest) ([]string, error) {
+	return []string{filepath.Join(s.directory, "books.csv")}, nil
+}
+
+func (s *goodreadsBooksSource) Extractors(i *Ingest, file string) ([]ExtractFunc, error) {
+	return []ExtractFunc{database.BookFromStream}, nil
+}
+
+func (s *goodreadsBooksSource) Loader(ctx context.Context, i *Ingest, file string) (BatchFunc, error) {
+	return func(batch []*database.Insertable) error {
+		return i.BookInsertPipeline(ctx, &batch)
+	}, nil
+}
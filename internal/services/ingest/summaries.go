@@ -0,0 +1,85 @@
+package ingest
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
+)
+
+const (
+	// DefaultSummariesInterval is how often, in seconds, the summaries are
+	// refreshed if nothing was loaded in the meantime.
+	DefaultSummariesInterval = 3600
+)
+
+// SummaryStatus describes a single summary table.
+type SummaryStatus struct {
+	Name        string     `json:"name"`
+	RefreshedAt *time.Time `json:"refreshed_at"`
+	Rows        uint64     `json:"rows"`
+}
+
+// RefreshSummaries rebuilds the top 100 and the default recommendation
+// tables from the catalog.
+func (i *Ingest) RefreshSummaries() error {
+	i.summariesMu.Lock()
+	defer i.summariesMu.Unlock()
+	start := time.Now()
+	if _, err := i.DB.Exec(`call refresh_summaries()`); err != nil {
+		return err
+	}
+	i.Logger.Printf("Summaries refreshed: %v.\n", time.Since(start))
+	return nil
+}
+
+// refreshSummariesInBackground runs the refresh without blocking the caller.
+func (i *Ingest) refreshSummariesInBackground() {
+	go func() {
+		if err := i.RefreshSummaries(); err != nil {
+			i.Logger.Printf("Summaries refresh failed, reason: %v\n", err)
+		}
+	}()
+}
+
+// RunSummaryRefresher refreshes the summaries periodically until the context
+// is cancelled.
+func (i *Ingest) RunSummaryRefresher(ctx context.Context) {
+	ticker := time.NewTicker(i.SummariesInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := i.RefreshSummaries(); err != nil {
+				i.Logger.Printf("Summaries refresh failed, reason: %v\n", err)
+			}
+		}
+	}
+}
+
+// SummariesStatus returns the last refresh time and the row count of every
+// summary table.
+func (i *Ingest) SummariesStatus(ctx *gin.Context) {
+	rows, err := i.DB.Query(`select name, refreshed_at, row_count
+		from summary_refreshes order by name`)
+	if err != nil {
+		i.Logger.Printf("couldn't fetch the summaries status, reason: %v\n", err)
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	defer rows.Close()
+
+	statuses := []SummaryStatus{}
+	for rows.Next() {
+		var ss SummaryStatus
+		if err := rows.Scan(&ss.Name, &ss.RefreshedAt, &ss.Rows); err != nil {
+			i.Logger.Printf("couldn't scan the summary status, reason: %v\n", err)
+			continue
+		}
+		statuses = append(statuses, ss)
+	}
+	services.NewGoodContentRequest(ctx, statuses)
+}
@@ -0,0 +1,86 @@
+package ingest
+
+import (
+	"context"
+	"time"
+
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/mlclient"
+)
+
+const (
+	// RecommenderSyncTarget is the key of the recommender in `sync_state`.
+	RecommenderSyncTarget = "recommender"
+	// RecommenderSyncBatch is how many items are sent in a single request.
+	RecommenderSyncBatch   = 1000
+	RecommenderSyncTimeout = 120
+	// RecommenderSyncGrace is how many seconds before the last sync the
+	// changes are looked for again, an insert committed late keeps the
+	// `updated_at` of its statement. The items sent twice are only replaced.
+	RecommenderSyncGrace = 300
+)
+
+// SyncRecommender pushes the catalog to the recommendation service. Full sync
+// replaces everything the service knows, incremental sync sends only the items
+// changed since the last successful sync.
+func (i *Ingest) SyncRecommender(full bool) error {
+	if i.Recommender == nil {
+		return nil
+	}
+	i.syncMu.Lock()
+	defer i.syncMu.Unlock()
+
+	since := time.Unix(1, 0)
+	if !full {
+		var syncedAt *time.Time
+		err := i.DB.QueryRow(`select synced_at from sync_state where target=?`,
+			RecommenderSyncTarget).Scan(&syncedAt)
+		if err == nil && syncedAt != nil {
+			since = syncedAt.Add(-RecommenderSyncGrace * time.Second)
+		}
+	}
+
+	items, syncedAt, err := database.CatalogItems(context.Background(), i.DB, since)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 && !full {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		RecommenderSyncTimeout*time.Second)
+	defer cancel()
+	// Only the first batch may replace the catalog, the rest is appended.
+	replace := full
+	for start := 0; start < len(items) || replace; start += RecommenderSyncBatch {
+		end := min(start+RecommenderSyncBatch, len(items))
+		resp, err := i.Recommender.SyncItems(ctx, &mlclient.SyncItemsRequest{
+			Items:       items[start:end],
+			FullReplace: replace,
+		})
+		if err != nil {
+			return err
+		}
+		replace = false
+		i.Logger.Printf("Recommender synced %v items, %v in total.\n",
+			end-start, resp.ItemsTotal)
+	}
+
+	if syncedAt.IsZero() {
+		return nil
+	}
+	_, err = i.DB.Exec(`insert into sync_state(target, synced_at) values (?, ?)
+		on duplicate key update synced_at=greatest(coalesce(synced_at, 0),
+		values(synced_at))`, RecommenderSyncTarget, syncedAt)
+	return err
+}
+
+// syncRecommenderInBackground runs the sync without blocking the caller.
+func (i *Ingest) syncRecommenderInBackground(full bool) {
+	go func() {
+		if err := i.SyncRecommender(full); err != nil {
+			i.Logger.Printf("Recommender sync failed, reason: %v\n", err)
+		}
+	}()
+}
@@ -0,0 +1,126 @@
+package search
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
+)
+
+const (
+	DefaultConcertsLimit = 25
+	MaxConcertsLimit     = 100
+	// DefaultConcertsRadius is the distance, in kilometres, used with `lat`
+	// and `lon` if `radius` is missing.
+	DefaultConcertsRadius = 50.0
+)
+
+// GetConcertById fetches the concert with its artist and venue.
+func (s *SearchService) GetConcertById(id uint64) (*database.ConcertSelectable, error) {
+	var cs database.ConcertSelectable
+	if err := s.DB.QueryRow(cs.ConstructSelectQuery(), id).Scan(cs.ScanFields()...); err != nil {
+		return nil, err
+	}
+	return &cs, nil
+}
+
+// ConcertById gets concert by id
+func (s *SearchService) ConcertById(ctx *gin.Context) {
+	var uc services.UriContent[uint64]
+	uc.Content, _ = strconv.ParseUint(ctx.Param("identifier"), 10, 64)
+
+	cs, err := s.GetConcertById(uc.Content)
+	if err != nil {
+		s.Logger.Printf("could not find concert ID %v: %v\n", uc.Content, err)
+		services.NewBadContentRequest(ctx, "concert doesn't exist")
+		return
+	}
+	services.NewGoodContentRequest(ctx, cs)
+}
+
+// optionalQuery returns nil for a missing parameter, so the procedure skips
+// the filter.
+func optionalQuery(ctx *gin.Context, key string) any {
+	if v := ctx.Query(key); v != "" {
+		return v
+	}
+	return nil
+}
+
+// optionalTimeQuery parses the date parameter, nil if it is missing.
+func optionalTimeQuery(ctx *gin.Context, key string) (any, bool) {
+	v := ctx.Query(key)
+	if v == "" {
+		return nil, true
+	}
+	t, err := database.ParseConcertTime(v)
+	if err != nil {
+		return nil, false
+	}
+	return t, true
+}
+
+// Concerts lists the concerts sorted by date. Query parameters, all optional:
+// `from` and `to` (dates, `from` defaults to now), `city`, `country` (ISO
+// 3166-1 code), `artist` (part of the name), `lat`, `lon` and `radius` (in
+// kilometres) and `limit`.
+func (s *SearchService) Concerts(ctx *gin.Context) {
+	from, ok := optionalTimeQuery(ctx, "from")
+	if !ok {
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	if from == nil {
+		from = time.Now().UTC()
+	}
+	to, ok := optionalTimeQuery(ctx, "to")
+	if !ok {
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+
+	var lat, lon any
+	radius := DefaultConcertsRadius
+	if ctx.Query("lat") != "" || ctx.Query("lon") != "" {
+		latValue, latErr := strconv.ParseFloat(ctx.Query("lat"), 64)
+		lonValue, lonErr := strconv.ParseFloat(ctx.Query("lon"), 64)
+		if latErr != nil || lonErr != nil || latValue < -90 || latValue > 90 ||
+			lonValue < -180 || lonValue > 180 {
+			services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+			return
+		}
+		lat, lon = latValue, lonValue
+		if r, err := strconv.ParseFloat(ctx.Query("radius"), 64); err == nil && r > 0 {
+			radius = r
+		}
+	}
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit",
+		strconv.Itoa(DefaultConcertsLimit)))
+	if err != nil || limit <= 0 || limit > MaxConcertsLimit {
+		limit = DefaultConcertsLimit
+	}
+
+	rows, err := s.DB.Query(`call find_concerts(?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		from, to, optionalQuery(ctx, "city"), optionalQuery(ctx, "country"),
+		optionalQuery(ctx, "artist"), lat, lon, radius, limit)
+	if err != nil {
+		s.Logger.Printf("couldn't fetch the concerts, reason: %v\n", err)
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	defer rows.Close()
+
+	concerts := make([]*database.ConcertSelectable, 0, limit)
+	for rows.Next() {
+		var cs database.ConcertSelectable
+		if err := rows.Scan(cs.ScanFields()...); err != nil {
+			s.Logger.Printf("couldn't scan the concert, reason: %v\n", err)
+			continue
+		}
+		concerts = append(concerts, &cs)
+	}
+	services.NewGoodContentRequest(ctx, concerts)
+}
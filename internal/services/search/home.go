@@ -0,0 +1,311 @@
+package search
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
+)
+
+const (
+	// HomeSectionSize is how many items a single section holds.
+	HomeSectionSize = 10
+	// HomeTopGenres is how many of the user's favourite genres are used.
+	HomeTopGenres = 3
+)
+
+// HomeSection is a labelled group of items on the home page.
+type HomeSection struct {
+	Id     string                       `json:"id"`
+	Title  string                       `json:"title"`
+	Reason string                       `json:"reason"`
+	Shows  []*database.MovieSelectable  `json:"shows"`
+	Series []*database.SeriesSelectable `json:"series"`
+	Books  []*database.BookSelectable   `json:"books"`
+}
+
+func newHomeSection(id, title, reason string) *HomeSection {
+	return &HomeSection{
+		Id:     id,
+		Title:  title,
+		Reason: reason,
+		Shows:  []*database.MovieSelectable{},
+		Series: []*database.SeriesSelectable{},
+		Books:  []*database.BookSelectable{},
+	}
+}
+
+func (hs *HomeSection) isEmpty() bool {
+	return len(hs.Shows) == 0 && len(hs.Series) == 0 && len(hs.Books) == 0
+}
+
+// HomePage returns the default recommendations and, with a valid
+// `access_token`, the sections personalised for the user.
+func (s *SearchService) HomePage(ctx *gin.Context) {
+	shows := s.GetDefaultShowsRecommendations()
+	books := s.GetDefaultBooksRecommendations()
+	series, err := s.GetPopularSeries(HomeSectionSize)
+	if err != nil {
+		s.Logger.Printf("cannot query popular series, reason: %v\n", err)
+	}
+
+	popular := newHomeSection("popular", "Popular right now", "Most popular in the catalog")
+	popular.Shows = append(popular.Shows, shows...)
+	popular.Series = append(popular.Series, series...)
+	popular.Books = append(popular.Books, books...)
+	sections := []*HomeSection{popular}
+
+	personalised := false
+	token := ctx.Query("access_token")
+	if userId, err := database.FetchUserIdByToken(s.DB, token); err == nil {
+		personalised = true
+		sections = append(s.PersonalisedSections(userId, token), sections...)
+	}
+
+	content := map[string]any{
+		"shows":        shows,
+		"series":       popular.Series,
+		"books":        books,
+		"personalised": personalised,
+		"sections":     sections,
+	}
+	services.NewGoodContentRequest(ctx, content)
+}
+
+// PersonalisedSections builds the home page sections for the user, the empty
+// ones are skipped.
+func (s *SearchService) PersonalisedSections(userId uint64, token string) []*HomeSection {
+	events, err := database.FetchUserEvents(s.DB, userId)
+	if err != nil {
+		s.Logger.Printf("couldn't fetch the user's events, reason: %v\n", err)
+	}
+	collections := database.CollapseEvents(events)
+	liked := collections["like"]
+
+	candidates := []*HomeSection{
+		s.becauseYouLikedSection(liked),
+		s.trendingInGenresSection(liked),
+		s.playlistSection(collections["playlist"]),
+		s.newSinceLastVisitSection(userId, token),
+	}
+	sections := []*HomeSection{}
+	for _, hs := range candidates {
+		if hs != nil && !hs.isEmpty() {
+			sections = append(sections, hs)
+		}
+	}
+	return sections
+}
+
+// becauseYouLikedSection holds the items similar to the most recently liked one.
+func (s *SearchService) becauseYouLikedSection(liked []database.Event) *HomeSection {
+	if len(liked) == 0 {
+		return nil
+	}
+	last := liked[len(liked)-1]
+
+	switch last.ItemType {
+	case "movie":
+		ms, err := s.GetMovieById(last.ItemId)
+		if err != nil {
+			return nil
+		}
+		similar, err := s.similarItems("movie", `CALL get_similar_movies(?, ?)`, last.ItemId)
+		if err != nil {
+			s.Logger.Printf("couldn't fetch similar movies, reason: %v\n", err)
+			return nil
+		}
+		hs := newHomeSection("because_you_liked", "Because you liked "+ms.Title,
+			fmt.Sprintf("Similar to %v, which you liked", ms.Title))
+		hs.Shows = s.moviesByIds(similarIds(similar))
+		return hs
+	case "tv":
+		ss, err := s.GetSeriesById(last.ItemId)
+		if err != nil {
+			return nil
+		}
+		similar, err := s.similarItems("tv", `CALL get_similar_series(?, ?)`, last.ItemId)
+		if err != nil {
+			s.Logger.Printf("couldn't fetch similar series, reason: %v\n", err)
+			return nil
+		}
+		hs := newHomeSection("because_you_liked", "Because you liked "+ss.Title,
+			fmt.Sprintf("Similar to %v, which you liked", ss.Title))
+		hs.Series = s.seriesByIds(similarIds(similar))
+		return hs
+	case "book":
+		bs, err := s.GetBookById(last.ItemId)
+		if err != nil {
+			return nil
+		}
+		similar, err := s.similarItems("book", `CALL get_similar_books(?, ?)`, last.ItemId)
+		if err != nil {
+			s.Logger.Printf("couldn't fetch similar books, reason: %v\n", err)
+			return nil
+		}
+		hs := newHomeSection("because_you_liked", "Because you liked "+bs.Title,
+			fmt.Sprintf("Similar to %v, which you liked", bs.Title))
+		hs.Books = s.booksByIds(similarIds(similar))
+		return hs
+	}
+	return nil
+}
+
+// trendingInGenresSection holds the most popular movies in the genres the user
+// likes the most.
+func (s *SearchService) trendingInGenresSection(liked []database.Event) *HomeSection {
+	counts := map[string]int{}
+	likedIds := map[uint64]bool{}
+	for _, e := range liked {
+		if e.ItemType != "movie" {
+			continue
+		}
+		likedIds[e.ItemId] = true
+		ms := &database.MovieSelectable{}
+		ms.MovieId = e.ItemId
+		s.GetGenres(ms)
+		for _, g := range ms.Genres {
+			counts[g.Name]++
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+
+	genres := make([]string, 0, len(counts))
+	for g := range counts {
+		genres = append(genres, g)
+	}
+	sort.Slice(genres, func(i, j int) bool {
+		if counts[genres[i]] != counts[genres[j]] {
+			return counts[genres[i]] > counts[genres[j]]
+		}
+		return genres[i] < genres[j]
+	})
+	genres = genres[:min(HomeTopGenres, len(genres))]
+
+	ids, err := s.queryIds(`CALL get_popular_movies_in_genres(?, ?)`,
+		strings.Join(genres, ","), HomeSectionSize+len(likedIds))
+	if err != nil {
+		s.Logger.Printf("couldn't fetch popular movies in genres, reason: %v\n", err)
+		return nil
+	}
+	notLiked := make([]uint64, 0, len(ids))
+	for _, id := range ids {
+		if !likedIds[id] {
+			notLiked = append(notLiked, id)
+		}
+	}
+
+	hs := newHomeSection("trending_in_your_genres", "Trending in your genres",
+		"Popular in the genres you like: "+strings.Join(genres, ", "))
+	hs.Shows = s.moviesByIds(notLiked[:min(HomeSectionSize, len(notLiked))])
+	return hs
+}
+
+// playlistSection holds the items the user put on the playlist, the most
+// recent first.
+func (s *SearchService) playlistSection(playlist []database.Event) *HomeSection {
+	hs := newHomeSection("continue_your_playlist", "Continue your playlist",
+		"Still on your playlist")
+	for i := len(playlist) - 1; i >= 0 && len(hs.Shows)+len(hs.Series)+len(hs.Books) < HomeSectionSize; i-- {
+		e := playlist[i]
+		switch e.ItemType {
+		case "movie":
+			hs.Shows = append(hs.Shows, s.moviesByIds([]uint64{e.ItemId})...)
+		case "tv":
+			hs.Series = append(hs.Series, s.seriesByIds([]uint64{e.ItemId})...)
+		case "book":
+			hs.Books = append(hs.Books, s.booksByIds([]uint64{e.ItemId})...)
+		}
+	}
+	return hs
+}
+
+// newSinceLastVisitSection holds the items added to the catalog since the
+// user's previous session.
+func (s *SearchService) newSinceLastVisitSection(userId uint64, token string) *HomeSection {
+	var lastVisit time.Time
+	err := s.DB.QueryRow(`select timestamp from user_login_timestamps
+		where user_id=? and token<>? order by timestamp desc limit 1`,
+		userId, token).Scan(&lastVisit)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		s.Logger.Printf("couldn't fetch the last visit, reason: %v\n", err)
+		return nil
+	}
+
+	hs := newHomeSection("new_since_last_visit", "New since your last visit",
+		fmt.Sprintf("Added since your last visit on %v", lastVisit.Format(time.DateOnly)))
+	if ids, err := s.queryIds(`CALL get_new_movies(?, ?)`, lastVisit, HomeSectionSize); err == nil {
+		hs.Shows = s.moviesByIds(ids)
+	} else {
+		s.Logger.Printf("couldn't fetch new movies, reason: %v\n", err)
+	}
+	if ids, err := s.queryIds(`CALL get_new_books(?, ?)`, lastVisit, HomeSectionSize); err == nil {
+		hs.Books = s.booksByIds(ids)
+	} else {
+		s.Logger.Printf("couldn't fetch new books, reason: %v\n", err)
+	}
+	return hs
+}
+
+// queryIds runs a procedure returning a single column of ids.
+func (s *SearchService) queryIds(query string, args ...any) ([]uint64, error) {
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []uint64{}
+	for rows.Next() {
+		var id uint64
+		if err := rows.Scan(&id); err != nil {
+			s.Logger.Printf("couldn't scan the id, reason: %v\n", err)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *SearchService) moviesByIds(ids []uint64) []*database.MovieSelectable {
+	shows := make([]*database.MovieSelectable, 0, len(ids))
+	for _, id := range ids {
+		ms, err := s.GetMovieById(id)
+		if err != nil {
+			s.Logger.Printf("movie %v not found, reason: %v\n", id, err)
+			continue
+		}
+		shows = append(shows, ms)
+	}
+	return shows
+}
+
+func (s *SearchService) booksByIds(ids []uint64) []*database.BookSelectable {
+	books := make([]*database.BookSelectable, 0, len(ids))
+	for _, id := range ids {
+		bs, err := s.GetBookById(id)
+		if err != nil {
+			s.Logger.Printf("book %v not found, reason: %v\n", id, err)
+			continue
+		}
+		books = append(books, bs)
+	}
+	return books
+}
+
+func similarIds(similar []similarItem) []uint64 {
+	ids := make([]uint64, 0, HomeSectionSize)
+	for _, si := range similar[:min(HomeSectionSize, len(similar))] {
+		ids = append(ids, si.Id)
+	}
+	return ids
+}
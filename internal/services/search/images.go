@@ -0,0 +1,86 @@
+package search
+
+import (
+	"database/sql"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/images"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
+)
+
+func WithImages(c *images.Config) func(s *SearchService) {
+	return func(s *SearchService) {
+		s.Images = c
+	}
+}
+
+// GetMovieImages fills the poster and the backdrop URLs of the movies and the
+// logos of their companies, which are fetched by GetProductionCompanies.
+func (s *SearchService) GetMovieImages(mss ...*database.MovieSelectable) {
+	for _, ms := range mss {
+		var poster, backdrop sql.NullString
+		if err := s.DB.QueryRow(`call get_movie_images(?)`, ms.MovieId).Scan(
+			&poster, &backdrop); err != nil {
+			s.Logger.Printf("couldn't fetch the movie images, reason: %v\n", err)
+			continue
+		}
+		ms.PosterUrl = s.Images.Poster(poster.String)
+		ms.BackdropUrl = s.Images.Backdrop(backdrop.String)
+		for i, pc := range ms.ProductionCompanies {
+			ms.ProductionCompanies[i].LogoUrl = s.Images.Logo(pc.LogoPath)
+		}
+	}
+}
+
+// GetSeriesImages fills the poster and the backdrop URLs of the series.
+func (s *SearchService) GetSeriesImages(sss ...*database.SeriesSelectable) {
+	for _, ss := range sss {
+		var poster, backdrop sql.NullString
+		if err := s.DB.QueryRow(`call get_series_images(?)`, ss.SeriesId).Scan(
+			&poster, &backdrop); err != nil {
+			s.Logger.Printf("couldn't fetch the series images, reason: %v\n", err)
+			continue
+		}
+		ss.PosterUrl = s.Images.Poster(poster.String)
+		ss.BackdropUrl = s.Images.Backdrop(backdrop.String)
+	}
+}
+
+// GetBookCovers fills the cover URLs of the books.
+func (s *SearchService) GetBookCovers(bss ...*database.BookSelectable) {
+	for _, bs := range bss {
+		var cover sql.NullString
+		if err := s.DB.QueryRow(`call get_book_cover(?)`, bs.Id).Scan(&cover); err != nil {
+			s.Logger.Printf("couldn't fetch the book cover, reason: %v\n", err)
+			continue
+		}
+		bs.CoverUrl = s.Images.Cover(cover.String, bs.Isbn13, bs.Isbn)
+	}
+}
+
+// TmdbImage serves a TMDB image from the local cache.
+func (s *SearchService) TmdbImage(ctx *gin.Context) {
+	s.serveImage(ctx, "tmdb", ctx.Param("size"), ctx.Param("file"))
+}
+
+// CoverImage serves the cover of the ISBN from the local cache.
+func (s *SearchService) CoverImage(ctx *gin.Context) {
+	s.serveImage(ctx, "cover", "", ctx.Param("isbn"))
+}
+
+func (s *SearchService) serveImage(ctx *gin.Context, kind, size, name string) {
+	source, key, ok := s.Images.Source(kind, size, name)
+	if !ok {
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	path, err := s.Images.Fetch(ctx, source, key)
+	if err != nil {
+		s.Logger.Printf("couldn't fetch the image %v, reason: %v\n", source, err)
+		services.NewBadContentRequest(ctx, "image doesn't exist")
+		return
+	}
+	ctx.Header("Cache-Control", "public, max-age=604800")
+	ctx.File(path)
+}
@@ -0,0 +1,201 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/mlclient"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
+)
+
+const (
+	DefaultRecommendationsLimit = 10
+	MaxRecommendationsLimit     = 50
+	DefaultDiversity            = 0.2
+	// Source of the recommendations.
+	SourceRecommender = "recommender"
+	SourceDefault     = "default"
+)
+
+var errNoRecommender = fmt.Errorf("no recommender setup")
+
+// Recommender is either the client of the recommendation service or the
+// in-process engine, both speak the same request and response.
+type Recommender interface {
+	Recommend(ctx context.Context, req *mlclient.RecommendRequest) (*mlclient.RecommendResponse, error)
+}
+
+// Runner is implemented by the recommenders that need a background loop.
+type Runner interface {
+	Run(ctx context.Context)
+}
+
+// Recommendation wraps the recommended item with the reason it was picked.
+type Recommendation[T any] struct {
+	Score  float64 `json:"score"`
+	Reason string  `json:"reason"`
+	Item   T       `json:"item"`
+}
+
+type RecommendationsResponse struct {
+	Source   string                                        `json:"source"`
+	Shows    []Recommendation[*database.MovieSelectable]   `json:"shows"`
+	Series   []Recommendation[*database.SeriesSelectable]  `json:"series"`
+	Books    []Recommendation[*database.BookSelectable]    `json:"books"`
+	Concerts []Recommendation[*database.ConcertSelectable] `json:"concerts"`
+}
+
+// Recommendations recommends items based on the user's likes. Query
+// parameters: `access_token`, `type` (movie, tv, book or concert, all if
+// empty) and `limit`.
+// If the recommender is down, the default recommendations are returned.
+func (s *SearchService) Recommendations(ctx *gin.Context) {
+	userId, err := database.FetchUserIdByToken(s.DB, ctx.Query("access_token"))
+	if err != nil {
+		s.Logger.Println(err)
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+
+	targetType := ctx.Query("type")
+	if _, ok := database.AllowedTypes[targetType]; targetType != "" && !ok {
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit",
+		strconv.Itoa(DefaultRecommendationsLimit)))
+	if err != nil || limit <= 0 || limit > MaxRecommendationsLimit {
+		limit = DefaultRecommendationsLimit
+	}
+
+	events, err := database.FetchUserEvents(s.DB, userId)
+	if err != nil {
+		s.Logger.Printf("couldn't fetch the user's events, reason: %v\n", err)
+	}
+	liked := database.CollapseEvents(events)["like"]
+
+	content, err := s.RecommendFromService(ctx, userId, liked, targetType, limit)
+	if err != nil {
+		s.Logger.Printf("recommender unavailable, using defaults, reason: %v\n", err)
+		content = s.DefaultRecommendations(targetType)
+	}
+	services.NewStatusContentRequest(ctx, http.StatusOK, content)
+}
+
+// RecommendFromService asks the recommender for recommendations and hydrates
+// the returned ids with the catalog data.
+func (s *SearchService) RecommendFromService(ctx context.Context, userId uint64,
+	liked []database.Event, targetType string, limit int) (*RecommendationsResponse, error) {
+	if s.Recommender == nil {
+		return nil, errNoRecommender
+	}
+
+	req := &mlclient.RecommendRequest{
+		UserId:     userId,
+		LikedItems: make([]mlclient.ItemRef, 0, len(liked)),
+		TargetType: mlclient.ItemTypes[targetType],
+		Limit:      limit,
+		Diversity:  DefaultDiversity,
+	}
+	for _, e := range liked {
+		if itemType, ok := mlclient.ItemTypes[e.ItemType]; ok {
+			req.LikedItems = append(req.LikedItems, mlclient.ItemRef{Id: e.ItemId, Type: itemType})
+		}
+	}
+
+	resp, err := s.Recommender.Recommend(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	content := &RecommendationsResponse{
+		Source:   SourceRecommender,
+		Shows:    []Recommendation[*database.MovieSelectable]{},
+		Series:   []Recommendation[*database.SeriesSelectable]{},
+		Books:    []Recommendation[*database.BookSelectable]{},
+		Concerts: []Recommendation[*database.ConcertSelectable]{},
+	}
+	for _, item := range resp.Items {
+		switch item.Type {
+		case "movie":
+			ms, err := s.GetMovieById(item.Id)
+			if err != nil {
+				s.Logger.Printf("recommended movie %v not found, reason: %v\n", item.Id, err)
+				continue
+			}
+			content.Shows = append(content.Shows, Recommendation[*database.MovieSelectable]{
+				Score: item.Score, Reason: item.Reason, Item: ms,
+			})
+		case "series":
+			ss, err := s.GetSeriesById(item.Id)
+			if err != nil {
+				s.Logger.Printf("recommended series %v not found, reason: %v\n", item.Id, err)
+				continue
+			}
+			content.Series = append(content.Series, Recommendation[*database.SeriesSelectable]{
+				Score: item.Score, Reason: item.Reason, Item: ss,
+			})
+		case "book":
+			bs, err := s.GetBookById(item.Id)
+			if err != nil {
+				s.Logger.Printf("recommended book %v not found, reason: %v\n", item.Id, err)
+				continue
+			}
+			content.Books = append(content.Books, Recommendation[*database.BookSelectable]{
+				Score: item.Score, Reason: item.Reason, Item: bs,
+			})
+		case "concert":
+			cs, err := s.GetConcertById(item.Id)
+			if err != nil {
+				s.Logger.Printf("recommended concert %v not found, reason: %v\n", item.Id, err)
+				continue
+			}
+			content.Concerts = append(content.Concerts, Recommendation[*database.ConcertSelectable]{
+				Score: item.Score, Reason: item.Reason, Item: cs,
+			})
+		}
+	}
+	return content, nil
+}
+
+// DefaultRecommendations returns the same recommendations as the home page.
+func (s *SearchService) DefaultRecommendations(targetType string) *RecommendationsResponse {
+	content := &RecommendationsResponse{
+		Source:   SourceDefault,
+		Shows:    []Recommendation[*database.MovieSelectable]{},
+		Series:   []Recommendation[*database.SeriesSelectable]{},
+		Books:    []Recommendation[*database.BookSelectable]{},
+		Concerts: []Recommendation[*database.ConcertSelectable]{},
+	}
+	if targetType == "" || targetType == "movie" {
+		for _, ms := range s.GetDefaultShowsRecommendations() {
+			content.Shows = append(content.Shows, Recommendation[*database.MovieSelectable]{
+				Reason: "popular", Item: ms,
+			})
+		}
+	}
+	if targetType == "" || targetType == "tv" {
+		series, err := s.GetPopularSeries(DefaultRecommendationsLimit)
+		if err != nil {
+			s.Logger.Printf("cannot query popular series, reason: %v\n", err)
+		}
+		for _, ss := range series {
+			s.GetSeriesDetails(ss)
+			content.Series = append(content.Series, Recommendation[*database.SeriesSelectable]{
+				Reason: "popular", Item: ss,
+			})
+		}
+	}
+	if targetType == "" || targetType == "book" {
+		for _, bs := range s.GetDefaultBooksRecommendations() {
+			content.Books = append(content.Books, Recommendation[*database.BookSelectable]{
+				Reason: "popular", Item: bs,
+			})
+		}
+	}
+	return content
+}
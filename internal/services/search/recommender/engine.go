@@ -0,0 +1,456 @@
+// Package recommender is the in-process recommendation engine. It mirrors the
+// recommendation service (main.py): a TF-IDF content index blended with
+// collaborative scores from the users' likes, diversified with MMR.
+package recommender
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/mlclient"
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultRefresh       = 600
+	DefaultLimit         = 10
+	DefaultMaxCandidates = 50_000
+	DefaultMmrPool       = 500
+	DefaultMinScore      = 0.0001
+	// CollaborativeLimit is how many collaborative candidates are considered.
+	CollaborativeLimit = 2000
+	ContentWeight      = 0.45
+	CollabWeight       = 0.55
+	// SeedUserOffset keeps the anonymous seed users apart from our users.
+	SeedUserOffset uint64 = 1 << 62
+)
+
+var ErrNotReady = fmt.Errorf("recommender index is not built yet")
+
+// Config is read from the `Engine` section of the search service's config.
+type Config struct {
+	// Refresh is how often, in seconds, the index is rebuilt.
+	Refresh int `mapstructure:"refresh"`
+}
+
+// Model is an immutable snapshot of the catalog and the interactions.
+type Model struct {
+	Index   *Index
+	Graph   *Graph
+	Items   []*mlclient.Item
+	BuiltAt time.Time
+}
+
+type Engine struct {
+	DB      *sql.DB
+	Logger  *log.Logger
+	Refresh time.Duration
+	model   atomic.Pointer[Model]
+}
+
+// NewConfig reads the engine configuration, the defaults are used if the
+// section is missing.
+func NewConfig(tableName string, v *viper.Viper) *Config {
+	c := Config{Refresh: DefaultRefresh}
+	if v != nil && v.IsSet(tableName) {
+		if err := v.UnmarshalKey(tableName, &c); err != nil {
+			c.Refresh = DefaultRefresh
+		}
+	}
+	if c.Refresh <= 0 {
+		c.Refresh = DefaultRefresh
+	}
+	return &c
+}
+
+func NewEngine(db *sql.DB, l *log.Logger, c *Config) *Engine {
+	return &Engine{
+		DB:      db,
+		Logger:  l,
+		Refresh: time.Duration(c.Refresh) * time.Second,
+	}
+}
+
+// Run builds the model and rebuilds it periodically until the context is
+// cancelled.
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.Refresh)
+	defer ticker.Stop()
+	for {
+		if err := e.Rebuild(ctx); err != nil {
+			e.Logger.Printf("couldn't rebuild the recommender, reason: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Model returns the current snapshot, nil before the first build.
+func (e *Engine) Model() *Model {
+	return e.model.Load()
+}
+
+// Rebuild loads the catalog and the likes and swaps the model.
+func (e *Engine) Rebuild(ctx context.Context) error {
+	items, err := e.loadItems(ctx)
+	if err != nil {
+		return err
+	}
+	g, err := e.loadGraph(ctx)
+	if err != nil {
+		return err
+	}
+	e.model.Store(&Model{
+		Index:   NewIndex(items),
+		Graph:   g,
+		Items:   items,
+		BuiltAt: time.Now(),
+	})
+	e.Logger.Printf("Recommender index built with %v items.\n", len(items))
+	return nil
+}
+
+// loadItems loads the whole catalog, the same way ingest sends it to the
+// recommendation service.
+func (e *Engine) loadItems(ctx context.Context) ([]*mlclient.Item, error) {
+	catalog, _, err := database.CatalogItems(ctx, e.DB, time.Unix(1, 0))
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*mlclient.Item, len(catalog))
+	for idx := range catalog {
+		items[idx] = &catalog[idx]
+	}
+	return items, nil
+}
+
+// loadGraph replays the user events, only the latest like or dislike of an
+// item counts.
+func (e *Engine) loadGraph(ctx context.Context) (*Graph, error) {
+	rows, err := e.DB.QueryContext(ctx, `select ult.user_id, ue.type,
+		ue.item_id, ue.event from user_events ue join user_login_timestamps ult
+		on ult.token = ue.token where ue.event in ('like', 'dislike')
+		order by ue.timestamp, ue.ID`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type userItem struct {
+		UserId uint64
+		Key    string
+	}
+	latest := map[userItem]string{}
+	order := []userItem{}
+	for rows.Next() {
+		var userId, itemId uint64
+		var itemType, event string
+		if err := rows.Scan(&userId, &itemType, &itemId, &event); err != nil {
+			e.Logger.Printf("couldn't scan the event, reason: %v\n", err)
+			continue
+		}
+		t, ok := mlclient.ItemTypes[itemType]
+		if !ok {
+			continue
+		}
+		ui := userItem{UserId: userId, Key: ItemKey(t, itemId)}
+		if _, ok := latest[ui]; !ok {
+			order = append(order, ui)
+		}
+		latest[ui] = event
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	g := NewGraph()
+	for _, ui := range order {
+		g.AddInteraction(ui.UserId, ui.Key, latest[ui])
+	}
+	// The seed users go after ours, so ours are kept when an item has more
+	// than MaxUsersPerItem users.
+	if err := e.loadSeedInteractions(ctx, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// loadSeedInteractions adds the likes imported from the datasets, so the
+// collaborative part works before our users like anything.
+func (e *Engine) loadSeedInteractions(ctx context.Context, g *Graph) error {
+	rows, err := e.DB.QueryContext(ctx, `select seed_user, type, item_id
+		from seed_interactions where event = 'like' order by seed_user`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var seedUser, itemId uint64
+		var itemType string
+		if err := rows.Scan(&seedUser, &itemType, &itemId); err != nil {
+			e.Logger.Printf("couldn't scan the seed interaction, reason: %v\n", err)
+			continue
+		}
+		t, ok := mlclient.ItemTypes[itemType]
+		if !ok {
+			continue
+		}
+		g.AddInteraction(SeedUserOffset+seedUser, ItemKey(t, itemId), "like")
+	}
+	return rows.Err()
+}
+
+// Recommend has the same contract as the recommendation service's /recommend.
+func (e *Engine) Recommend(ctx context.Context, req *mlclient.RecommendRequest) (*mlclient.RecommendResponse, error) {
+	m := e.Model()
+	if m == nil {
+		return nil, ErrNotReady
+	}
+	return m.Recommend(req), nil
+}
+
+func (m *Model) Recommend(req *mlclient.RecommendRequest) *mlclient.RecommendResponse {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	maxCandidates := req.MaxCandidates
+	if maxCandidates <= 0 {
+		maxCandidates = DefaultMaxCandidates
+	}
+	mmrPool := req.MmrPool
+	if mmrPool <= 0 {
+		mmrPool = DefaultMmrPool
+	}
+	minScore := req.MinScore
+	if minScore <= 0.0 {
+		minScore = DefaultMinScore
+	}
+	resp := &mlclient.RecommendResponse{Items: []mlclient.RecommendedItem{}}
+	if len(m.Items) == 0 {
+		return resp
+	}
+
+	likedKeys := []string{}
+	likedDocs := []int{}
+	for _, it := range req.LikedItems {
+		k := ItemKey(it.Type, it.Id)
+		if doc, ok := m.Index.keyToDoc[k]; ok {
+			likedKeys = append(likedKeys, k)
+			likedDocs = append(likedDocs, doc)
+		}
+	}
+	if len(likedDocs) == 0 {
+		resp.Items = m.popularFallback(limit, req.TargetType, nil)
+		return resp
+	}
+
+	profile := m.Index.BuildProfile(likedDocs)
+	expanded := m.Index.ExpandGenres(profile.Genres, 2)
+	contentCandidates := m.Index.CollectCandidates(profile.TitleTokens, expanded, maxCandidates)
+	cfScores := m.Graph.CollaborativeCandidates(likedKeys, CollaborativeLimit)
+
+	isLiked := make(map[int]bool, len(likedDocs))
+	for _, d := range likedDocs {
+		isLiked[d] = true
+	}
+	candidates := []int{}
+	seen := map[int]bool{}
+	addCandidate := func(d int) {
+		if seen[d] || isLiked[d] {
+			return
+		}
+		seen[d] = true
+		if req.TargetType != "" && m.Index.docType[d] != req.TargetType {
+			return
+		}
+		candidates = append(candidates, d)
+	}
+	for _, d := range contentCandidates {
+		addCandidate(d)
+	}
+	cfKeys := make([]string, 0, len(cfScores))
+	for k := range cfScores {
+		cfKeys = append(cfKeys, k)
+	}
+	sort.Strings(cfKeys)
+	for _, k := range cfKeys {
+		if d, ok := m.Index.keyToDoc[k]; ok {
+			addCandidate(d)
+		}
+	}
+	if len(candidates) == 0 {
+		resp.Items = m.popularFallback(limit, req.TargetType, nil)
+		return resp
+	}
+
+	type scored struct {
+		Doc   int
+		Score float64
+		HasCf bool
+	}
+	contentScores := m.Index.ScoreContent(profile, candidates)
+	pool := make([]scored, 0, len(candidates))
+	for i, d := range candidates {
+		s := scored{Doc: d, Score: contentScores[i]}
+		cfRaw := cfScores[m.Index.docKey[d]]
+		if cf := cfRaw / (1.0 + cfRaw); cf > 0.0 {
+			s.Score = ContentWeight*contentScores[i] + CollabWeight*cf
+			s.HasCf = true
+		}
+		if s.Score >= minScore {
+			pool = append(pool, s)
+		}
+	}
+	if len(pool) == 0 {
+		resp.Items = m.popularFallback(limit, req.TargetType, nil)
+		return resp
+	}
+
+	sort.SliceStable(pool, func(i, j int) bool { return pool[i].Score > pool[j].Score })
+	pool = pool[:min(len(pool), max(mmrPool, limit))]
+
+	docs := make([]int, len(pool))
+	relevance := make([]float64, len(pool))
+	for i, s := range pool {
+		docs[i], relevance[i] = s.Doc, s.Score
+	}
+	picked := m.mmrSelect(docs, relevance, limit, req.Diversity)
+
+	byDoc := make(map[int]scored, len(pool))
+	for _, s := range pool {
+		byDoc[s.Doc] = s
+	}
+	chosen := map[string]bool{}
+	for _, d := range picked {
+		s := byDoc[d]
+		it := m.Items[d]
+		chosen[m.Index.docKey[d]] = true
+		resp.Items = append(resp.Items, mlclient.RecommendedItem{
+			Id:     it.Id,
+			Type:   it.Type,
+			Title:  it.Title,
+			Genres: it.Genres,
+			Score:  math.Round(s.Score*10000) / 10000,
+			Reason: m.humanReason(profile, d, s.HasCf, s.Score),
+		})
+	}
+	if len(resp.Items) < limit {
+		resp.Items = append(resp.Items,
+			m.popularFallback(limit-len(resp.Items), req.TargetType, chosen)...)
+	}
+	return resp
+}
+
+// mmrSelect picks the items one by one, trading the relevance for the
+// dissimilarity to the items already picked.
+func (m *Model) mmrSelect(docs []int, relevance []float64, limit int, diversity float64) []int {
+	lambda := 1.0 - diversity
+	selected := []int{}
+	remaining := make([]int, len(docs))
+	for i := range remaining {
+		remaining[i] = i
+	}
+	for len(selected) < limit && len(remaining) > 0 {
+		best, bestScore := -1, math.Inf(-1)
+		for pos, i := range remaining {
+			score := relevance[i]
+			if len(selected) > 0 {
+				maxSim := 0.0
+				for _, s := range selected {
+					maxSim = max(maxSim, m.Index.CosineDocs(docs[i], s))
+				}
+				score = lambda*relevance[i] - (1.0-lambda)*maxSim
+			}
+			if score > bestScore {
+				best, bestScore = pos, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+		selected = append(selected, docs[remaining[best]])
+		remaining = append(remaining[:best], remaining[best+1:]...)
+	}
+	return selected
+}
+
+// popularFallback returns the most liked items, then the rest of the catalog.
+func (m *Model) popularFallback(limit int, targetType string, exclude map[string]bool) []mlclient.RecommendedItem {
+	out := []mlclient.RecommendedItem{}
+	used := map[string]bool{}
+	add := func(k string, score float64, reason string) bool {
+		d, ok := m.Index.keyToDoc[k]
+		if !ok || used[k] || exclude[k] {
+			return len(out) < limit
+		}
+		it := m.Items[d]
+		if targetType != "" && it.Type != targetType {
+			return len(out) < limit
+		}
+		used[k] = true
+		out = append(out, mlclient.RecommendedItem{
+			Id: it.Id, Type: it.Type, Title: it.Title, Genres: it.Genres,
+			Score: score, Reason: reason,
+		})
+		return len(out) < limit
+	}
+	if limit <= 0 {
+		return out
+	}
+	for _, k := range m.Graph.MostPopular(limit * 10) {
+		if !add(k, 0.1, "Popular choice") {
+			return out
+		}
+	}
+	for _, k := range m.Index.docKey {
+		if !add(k, 0.05, "Discover something new") {
+			return out
+		}
+	}
+	return out
+}
+
+func (m *Model) humanReason(p *Profile, doc int, hasCf bool, score float64) string {
+	if score <= 0.0 {
+		return "Propozycja eksploracyjna (mało sygnału)"
+	}
+	overlapGenres := []string{}
+	for _, g := range unique(m.Index.docGenres[doc]) {
+		if p.Genres[g] && len(overlapGenres) < 3 {
+			overlapGenres = append(overlapGenres, g)
+		}
+	}
+	overlapTokens := []string{}
+	for _, t := range unique(Tokenize(m.Index.docTitle[doc])) {
+		if p.TitleTokens[t] && len(overlapTokens) < 2 {
+			overlapTokens = append(overlapTokens, t)
+		}
+	}
+
+	parts := []string{}
+	if hasCf {
+		parts = append(parts, "Użytkownicy o podobnych gustach też to lubią")
+	}
+	if len(overlapGenres) > 0 {
+		parts = append(parts, "Wspólne gatunki: "+strings.Join(overlapGenres, ", "))
+	}
+	if len(overlapTokens) > 0 {
+		parts = append(parts, "Podobne słowa w tytule: "+strings.Join(overlapTokens, ", "))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "Pasuje do Twojego profilu (gatunki/tematy)")
+	}
+	return strings.Join(parts, " • ")
+}
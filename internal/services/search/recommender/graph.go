@@ -0,0 +1,119 @@
+package recommender
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	MaxUsersPerItem = 200
+	MaxLikesPerUser = 400
+)
+
+// Graph keeps who liked what, it is the collaborative part of the engine.
+type Graph struct {
+	userLikes   map[uint64][]string
+	itemLikedBy map[string][]uint64
+	popularity  map[string]int
+	liked       map[uint64]map[string]bool
+}
+
+func NewGraph() *Graph {
+	return &Graph{
+		userLikes:   map[uint64][]string{},
+		itemLikedBy: map[string][]uint64{},
+		popularity:  map[string]int{},
+		liked:       map[uint64]map[string]bool{},
+	}
+}
+
+// AddInteraction records the event, only likes and purchases count.
+func (g *Graph) AddInteraction(userId uint64, key, event string) {
+	if event != "like" && event != "purchase" {
+		return
+	}
+	if _, ok := g.liked[userId]; !ok {
+		g.liked[userId] = map[string]bool{}
+	}
+	if g.liked[userId][key] {
+		return
+	}
+	g.liked[userId][key] = true
+	g.userLikes[userId] = append(g.userLikes[userId], key)
+	g.itemLikedBy[key] = append(g.itemLikedBy[key], userId)
+	g.popularity[key]++
+}
+
+// CollaborativeCandidates scores items liked by the users who liked the same
+// items. Both the very active users and the very popular items are damped.
+func (g *Graph) CollaborativeCandidates(likedKeys []string, limit int) map[string]float64 {
+	if len(likedKeys) == 0 {
+		return map[string]float64{}
+	}
+	likedSet := make(map[string]bool, len(likedKeys))
+	for _, k := range likedKeys {
+		likedSet[k] = true
+	}
+
+	scores := map[string]float64{}
+	for _, k := range likedKeys {
+		users := g.itemLikedBy[k]
+		users = users[:min(len(users), MaxUsersPerItem)]
+		for _, u := range users {
+			their := g.userLikes[u]
+			if len(their) == 0 {
+				continue
+			}
+			their = their[:min(len(their), MaxLikesPerUser)]
+
+			wUser := 1.0
+			if denom := math.Log(1.0 + float64(len(their))); denom > 0.0 {
+				wUser = 1.0 / denom
+			}
+			for _, candidate := range their {
+				if likedSet[candidate] {
+					continue
+				}
+				wItem := 1.0
+				if denom := math.Log(1.0 + float64(g.popularity[candidate])); denom > 0.0 {
+					wItem = 1.0 / denom
+				}
+				scores[candidate] += wUser * wItem
+			}
+		}
+	}
+	if len(scores) <= limit {
+		return scores
+	}
+
+	keys := make([]string, 0, len(scores))
+	for k := range scores {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if scores[keys[i]] != scores[keys[j]] {
+			return scores[keys[i]] > scores[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	top := make(map[string]float64, limit)
+	for _, k := range keys[:limit] {
+		top[k] = scores[k]
+	}
+	return top
+}
+
+// MostPopular returns the item keys ordered by the number of likes.
+func (g *Graph) MostPopular(limit int) []string {
+	keys := make([]string, 0, len(g.popularity))
+	for k := range g.popularity {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if g.popularity[keys[i]] != g.popularity[keys[j]] {
+			return g.popularity[keys[i]] > g.popularity[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys[:min(limit, len(keys))]
+}
@@ -0,0 +1,358 @@
+package recommender
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sadsonkeenolee/IO_projekt/pkg/mlclient"
+)
+
+var tokenRegexp = regexp.MustCompile(`(?i)[a-ząćęłńóśżź0-9]+`)
+
+type termWeight struct {
+	Term   int
+	Weight float64
+}
+
+type posting struct {
+	Doc    int
+	Weight float64
+}
+
+// Index is a sparse TF-IDF index over titles, genres and keywords. Every item
+// is a document, its terms are title tokens, title bigrams, `genre:` and `kw:`
+// tokens.
+type Index struct {
+	vocab     map[string]int
+	idf       []float64
+	docTerms  [][]termWeight
+	docNorm   []float64
+	postings  [][]posting
+	genreDocs map[string][]int
+	genreCooc map[string]map[string]int
+	docKey    []string
+	keyToDoc  map[string]int
+	docType   []string
+	docTitle  []string
+	docGenres [][]string
+}
+
+func ItemKey(itemType string, id uint64) string {
+	return fmt.Sprintf("%v:%v", itemType, id)
+}
+
+func Tokenize(text string) []string {
+	return tokenRegexp.FindAllString(strings.ToLower(text), -1)
+}
+
+func Bigrams(tokens []string) []string {
+	if len(tokens) < 2 {
+		return []string{}
+	}
+	out := make([]string, 0, len(tokens)-1)
+	for i := 0; i < len(tokens)-1; i++ {
+		out = append(out, tokens[i]+"_"+tokens[i+1])
+	}
+	return out
+}
+
+func genreToken(genre string) string {
+	return "genre:" + strings.ToLower(genre)
+}
+
+func keywordToken(keyword string) string {
+	return "kw:" + strings.ToLower(keyword)
+}
+
+// unique removes duplicates, keeps the order of the first occurrences.
+func unique(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func NewIndex(items []*mlclient.Item) *Index {
+	idx := &Index{
+		vocab:     map[string]int{},
+		genreDocs: map[string][]int{},
+		genreCooc: map[string]map[string]int{},
+		keyToDoc:  map[string]int{},
+	}
+	df := []int{}
+	docTf := make([][]termWeight, 0, len(items))
+
+	for doc, it := range items {
+		key := ItemKey(it.Type, it.Id)
+		idx.docKey = append(idx.docKey, key)
+		idx.keyToDoc[key] = doc
+		idx.docType = append(idx.docType, it.Type)
+		idx.docTitle = append(idx.docTitle, it.Title)
+		idx.docGenres = append(idx.docGenres, it.Genres)
+
+		titleTokens := Tokenize(it.Title)
+		titleTokens = append(titleTokens, Bigrams(titleTokens)...)
+
+		genres := unique(it.Genres)
+		for _, g := range genres {
+			idx.genreDocs[g] = append(idx.genreDocs[g], doc)
+		}
+		for _, a := range genres {
+			for _, b := range genres {
+				if a == b {
+					continue
+				}
+				if _, ok := idx.genreCooc[a]; !ok {
+					idx.genreCooc[a] = map[string]int{}
+				}
+				idx.genreCooc[a][b]++
+			}
+		}
+
+		tf := map[string]int{}
+		for _, t := range titleTokens {
+			tf[t]++
+		}
+		for _, g := range genres {
+			tf[genreToken(g)]++
+		}
+		for _, k := range unique(it.Keywords) {
+			tf[keywordToken(k)]++
+		}
+
+		terms := make([]termWeight, 0, len(tf))
+		for term, freq := range tf {
+			tid, ok := idx.vocab[term]
+			if !ok {
+				tid = len(idx.vocab)
+				idx.vocab[term] = tid
+				df = append(df, 0)
+			}
+			df[tid]++
+			terms = append(terms, termWeight{Term: tid, Weight: float64(freq)})
+		}
+		sort.Slice(terms, func(i, j int) bool { return terms[i].Term < terms[j].Term })
+		docTf = append(docTf, terms)
+	}
+
+	n := float64(len(items))
+	idx.idf = make([]float64, len(df))
+	for tid, d := range df {
+		idx.idf[tid] = math.Log((n+1.0)/(float64(d)+1.0)) + 1.0
+	}
+
+	idx.postings = make([][]posting, len(df))
+	idx.docTerms = docTf
+	idx.docNorm = make([]float64, len(items))
+	for doc, terms := range docTf {
+		norm2 := 0.0
+		for i, t := range terms {
+			w := (1.0 + math.Log(1.0+t.Weight)) * idx.idf[t.Term]
+			terms[i].Weight = w
+			norm2 += w * w
+			idx.postings[t.Term] = append(idx.postings[t.Term], posting{Doc: doc, Weight: w})
+		}
+		idx.docNorm[doc] = math.Sqrt(norm2)
+	}
+	return idx
+}
+
+// ExpandGenres adds the genres that most often go together with the given ones.
+func (idx *Index) ExpandGenres(base map[string]bool, topK int) map[string]bool {
+	out := make(map[string]bool, len(base))
+	for g := range base {
+		out[g] = true
+	}
+	for g := range base {
+		rel, ok := idx.genreCooc[g]
+		if !ok {
+			continue
+		}
+		related := make([]string, 0, len(rel))
+		for ng := range rel {
+			related = append(related, ng)
+		}
+		sort.Slice(related, func(i, j int) bool {
+			if rel[related[i]] != rel[related[j]] {
+				return rel[related[i]] > rel[related[j]]
+			}
+			return related[i] < related[j]
+		})
+		for _, ng := range related[:min(topK, len(related))] {
+			out[ng] = true
+		}
+	}
+	return out
+}
+
+// Profile is the sum of the liked documents' vectors.
+type Profile struct {
+	Weights     map[int]float64
+	Norm        float64
+	TitleTokens map[string]bool
+	Genres      map[string]bool
+}
+
+func (idx *Index) BuildProfile(likedDocs []int) *Profile {
+	p := &Profile{
+		Weights:     map[int]float64{},
+		TitleTokens: map[string]bool{},
+		Genres:      map[string]bool{},
+	}
+	for _, doc := range likedDocs {
+		tokens := Tokenize(idx.docTitle[doc])
+		for _, t := range append(tokens, Bigrams(tokens)...) {
+			p.TitleTokens[t] = true
+		}
+		for _, g := range idx.docGenres[doc] {
+			p.Genres[g] = true
+		}
+		for _, t := range idx.docTerms[doc] {
+			p.Weights[t.Term] += t.Weight
+		}
+	}
+	norm2 := 0.0
+	for _, w := range p.Weights {
+		norm2 += w * w
+	}
+	p.Norm = math.Sqrt(norm2)
+	return p
+}
+
+// CollectCandidates returns documents sharing a genre or a title token with
+// the profile, genres first.
+func (idx *Index) CollectCandidates(tokens, genres map[string]bool, maxCandidates int) []int {
+	visited := make(map[int]bool)
+	out := []int{}
+	add := func(docs []int) bool {
+		for _, d := range docs {
+			if visited[d] {
+				continue
+			}
+			visited[d] = true
+			out = append(out, d)
+			if len(out) >= maxCandidates {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, g := range sortedKeys(genres) {
+		if !add(idx.genreDocs[g]) {
+			return out
+		}
+	}
+	for _, t := range sortedKeys(tokens) {
+		tid, ok := idx.vocab[t]
+		if !ok {
+			continue
+		}
+		docs := make([]int, 0, len(idx.postings[tid]))
+		for _, p := range idx.postings[tid] {
+			docs = append(docs, p.Doc)
+		}
+		if !add(docs) {
+			return out
+		}
+	}
+	return out
+}
+
+// ScoreContent returns the cosine similarity between the profile and every
+// candidate.
+func (idx *Index) ScoreContent(p *Profile, candidates []int) []float64 {
+	scores := make([]float64, len(candidates))
+	if p.Norm <= 0.0 || len(candidates) == 0 {
+		return scores
+	}
+	position := make(map[int]int, len(candidates))
+	for i, d := range candidates {
+		position[d] = i
+	}
+	for tid, qw := range p.Weights {
+		for _, post := range idx.postings[tid] {
+			if i, ok := position[post.Doc]; ok {
+				scores[i] += qw * post.Weight
+			}
+		}
+	}
+	for i, d := range candidates {
+		denom := p.Norm * idx.docNorm[d]
+		if denom > 0.0 {
+			scores[i] /= denom
+		} else {
+			scores[i] = 0.0
+		}
+	}
+	return scores
+}
+
+// CosineDocs is the cosine similarity between two documents.
+func (idx *Index) CosineDocs(a, b int) float64 {
+	na, nb := idx.docNorm[a], idx.docNorm[b]
+	if na <= 0.0 || nb <= 0.0 {
+		return 0.0
+	}
+	ta, tb := idx.docTerms[a], idx.docTerms[b]
+	dot := 0.0
+	for i, j := 0, 0; i < len(ta) && j < len(tb); {
+		switch {
+		case ta[i].Term == tb[j].Term:
+			dot += ta[i].Weight * tb[j].Weight
+			i++
+			j++
+		case ta[i].Term < tb[j].Term:
+			i++
+		default:
+			j++
+		}
+	}
+	return dot / (na * nb)
+}
+
+// Similar returns the documents most similar to the given one.
+func (idx *Index) Similar(doc, limit int) []int {
+	p := &Profile{Weights: map[int]float64{}, Norm: idx.docNorm[doc]}
+	for _, t := range idx.docTerms[doc] {
+		p.Weights[t.Term] = t.Weight
+	}
+	candidates := []int{}
+	seen := map[int]bool{doc: true}
+	for _, t := range idx.docTerms[doc] {
+		for _, post := range idx.postings[t.Term] {
+			if !seen[post.Doc] {
+				seen[post.Doc] = true
+				candidates = append(candidates, post.Doc)
+			}
+		}
+	}
+	scores := idx.ScoreContent(p, candidates)
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	out := make([]int, 0, limit)
+	for _, i := range order[:min(limit, len(order))] {
+		out = append(out, candidates[i])
+	}
+	return out
+}
+
+func sortedKeys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
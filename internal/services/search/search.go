@@ -2,6 +2,7 @@
 package search
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -14,12 +15,20 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/images"
 	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
 	"github.com/spf13/viper"
 )
 
 type SearchService struct {
 	services.Service
+	// Recommender is optional, without it the default recommendations are used.
+	Recommender Recommender
+	Similar     *SimilarCache
+	// TrendingJob is optional, without it the trending scores are never refreshed.
+	TrendingJob *TrendingJob
+	// Images builds the image URLs and, if configured, caches the images.
+	Images *images.Config
 }
 
 var GlobalSearchLogger *log.Logger = log.New(os.Stderr, "", log.LstdFlags|log.Lmsgprefix|log.Llongfile)
@@ -54,6 +63,24 @@ func WithDatabase(db *sql.DB) func(s *SearchService) {
 	}
 }
 
+func WithRecommender(r Recommender) func(s *SearchService) {
+	return func(s *SearchService) {
+		s.Recommender = r
+	}
+}
+
+func WithTrendingJob(tj *TrendingJob) func(s *SearchService) {
+	return func(s *SearchService) {
+		s.TrendingJob = tj
+	}
+}
+
+func WithSimilarCache(sc *SimilarCache) func(s *SearchService) {
+	return func(s *SearchService) {
+		s.Similar = sc
+	}
+}
+
 func (s *SearchService) GetSpokenLanguages(mss ...*database.MovieSelectable) {
 	for _, ms := range mss {
 		rows, err := s.DB.Query(`call get_languages(?)`, ms.MovieId)
@@ -88,10 +115,12 @@ func (s *SearchService) GetProductionCompanies(mss ...*database.MovieSelectable)
 		ms.ProductionCompanies = make([]database.ProductionCompaniesInsertable, 0, 16)
 		for rows.Next() {
 			var pci database.ProductionCompaniesInsertable
-			if err := rows.Scan(&pci.IdName.Id, &pci.IdName.Name); err != nil {
+			var logo sql.NullString
+			if err := rows.Scan(&pci.IdName.Id, &pci.IdName.Name, &logo); err != nil {
 				s.Logger.Printf("couldn't scan the genre, reason: %v\n", err)
 				continue
 			}
+			pci.LogoPath = logo.String
 			ms.ProductionCompanies = append(ms.ProductionCompanies, pci)
 		}
 	}
@@ -139,10 +168,45 @@ func (s *SearchService) GetGenres(mss ...*database.MovieSelectable) {
 	}
 }
 
+// GetMovieById fetches the movie with all its details.
+func (s *SearchService) GetMovieById(id uint64) (*database.MovieSelectable, error) {
+	var ms database.MovieSelectable
+	if err := s.DB.QueryRow("CALL get_movie_by_id(?)", id).Scan(
+		&ms.Id, &ms.Budget, &ms.MovieId, &ms.OriginalLanguage,
+		&ms.Title, &ms.Overview, &ms.Popularity, &ms.ReleaseDate,
+		&ms.Revenue, &ms.Runtime, &ms.Status, &ms.Tagline, &ms.AverageScore,
+		&ms.TotalScore,
+	); err != nil {
+		return nil, err
+	}
+	s.GetGenres(&ms)
+	s.GetKeywords(&ms)
+	s.GetProductionCompanies(&ms)
+	s.GetSpokenLanguages(&ms)
+	s.GetMovieImages(&ms)
+	return &ms, nil
+}
+
+// GetBookById fetches the book.
+func (s *SearchService) GetBookById(id uint64) (*database.BookSelectable, error) {
+	var bs database.BookSelectable
+	if err := s.DB.QueryRow("CALL get_book_by_id(?)", id).Scan(
+		&bs.Id, &bs.Title, &bs.Isbn, &bs.Isbn13, &bs.Language,
+		&bs.Pages, &bs.ReleaseDate, &bs.Publisher, &bs.Rating, &bs.TotalRating,
+	); err != nil {
+		return nil, err
+	}
+	s.GetBookCovers(&bs)
+	return &bs, nil
+}
+
 func (s *SearchService) GetTop100Shows(ctx *gin.Context) {
-	rows, err := s.DB.Query(`select * from top_100_shows`)
+	rows, err := s.DB.Query(`select ID, budget, tmdb_id, language, title, overview,
+		popularity, release_date, revenue, runtime, status, tagline, rating,
+		total_ratings from top_100_shows order by position`)
 	if err != nil {
 		s.Logger.Printf("cannot query top 100 shows, reason: %v\n", err)
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
 		return
 	}
 	defer rows.Close()
@@ -161,13 +225,17 @@ func (s *SearchService) GetTop100Shows(ctx *gin.Context) {
 		}
 		shows = append(shows, &ms)
 	}
+	s.GetMovieImages(shows...)
 	services.NewGoodContentRequest(ctx, shows)
 }
 
 func (s *SearchService) GetTop100Books(ctx *gin.Context) {
-	rows, err := s.DB.Query(`select * from top_100_books`)
+	rows, err := s.DB.Query(`select ID, title, isbn, isbn13, language, pages,
+		release_date, publisher, rating, total_ratings from top_100_books
+		order by position`)
 	if err != nil {
 		s.Logger.Printf("cannot query top 100 books, reason: %v\n", err)
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
 		return
 	}
 	defer rows.Close()
@@ -184,12 +252,16 @@ func (s *SearchService) GetTop100Books(ctx *gin.Context) {
 		}
 		books = append(books, &bs)
 	}
+	s.GetBookCovers(books...)
 	services.NewGoodContentRequest(ctx, books)
 }
 
 func (s *SearchService) GetDefaultShowsRecommendations() []*database.MovieSelectable {
-	rows, err := s.DB.Query(`select * from default_shows_recommendation`)
+	rows, err := s.DB.Query(`select ID, budget, tmdb_id, language, title, overview,
+		popularity, release_date, revenue, runtime, status, tagline, rating,
+		total_ratings from default_shows_recommendation order by position`)
 	if err != nil {
+		s.Logger.Printf("cannot query default shows, reason: %v\n", err)
 		return nil
 	}
 	defer rows.Close()
@@ -210,14 +282,18 @@ func (s *SearchService) GetDefaultShowsRecommendations() []*database.MovieSelect
 		s.GetKeywords(&ms)
 		s.GetProductionCompanies(&ms)
 		s.GetSpokenLanguages(&ms)
+		s.GetMovieImages(&ms)
 		shows = append(shows, &ms)
 	}
 	return shows
 }
 
 func (s *SearchService) GetDefaultBooksRecommendations() []*database.BookSelectable {
-	rows, err := s.DB.Query(`select * from default_books_recommendation`)
+	rows, err := s.DB.Query(`select ID, title, isbn, isbn13, language, pages,
+		release_date, publisher, rating, total_ratings from default_books_recommendation
+		order by position`)
 	if err != nil {
+		s.Logger.Printf("cannot query default books, reason: %v\n", err)
 		return nil
 	}
 	defer rows.Close()
@@ -234,19 +310,10 @@ func (s *SearchService) GetDefaultBooksRecommendations() []*database.BookSelecta
 		}
 		books = append(books, &bs)
 	}
+	s.GetBookCovers(books...)
 	return books
 }
 
-func (s *SearchService) HomePage(ctx *gin.Context) {
-	shows := s.GetDefaultShowsRecommendations()
-	books := s.GetDefaultBooksRecommendations()
-	content := map[string]any{
-		"shows": shows,
-		"books": books,
-	}
-	services.NewGoodContentRequest(ctx, content)
-}
-
 // SearchBuilder implements builder constructor for the search service.
 func SearchBuilder(opts ...func(*SearchService)) services.IService {
 	f := &SearchService{}
@@ -260,16 +327,38 @@ func (s *SearchService) Start() error {
 	if err := s.HealthCheck(); err != nil {
 		GlobalSearchLogger.Fatalf("HealthCheck failed, reason: %v\n", err)
 	}
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	if r, ok := s.Recommender.(Runner); ok {
+		go r.Run(jobsCtx)
+	}
+	if s.TrendingJob != nil {
+		go s.TrendingJob.Run(jobsCtx)
+	}
 	// v1 of api.
 	{
 		v1 := s.Router.Group("/v1")
 		v1.GET("api/home/", s.HomePage)
-		v1.GET("api/tv/id/:identifier/", s.TvById)
-		v1.GET("api/tv/title/:identifier/", s.TvByTitle)
-		v1.GET("api/tv/top100/", s.GetTop100Shows)
+		v1.GET("api/recommendations", s.Recommendations)
+		v1.GET("api/trending", s.Trending)
+		v1.GET("api/movie/id/:identifier/", s.MovieById)
+		v1.GET("api/movie/id/:identifier/similar", s.MovieSimilar)
+		v1.GET("api/movie/title/:identifier/", s.MovieByTitle)
+		v1.GET("api/movie/top100/", s.GetTop100Shows)
+		v1.GET("api/tv/id/:identifier/", s.SeriesById)
+		v1.GET("api/tv/id/:identifier/similar", s.SeriesSimilar)
+		v1.GET("api/tv/title/:identifier/", s.SeriesByTitle)
+		v1.GET("api/tv/top100/", s.GetTop100Series)
 		v1.GET("api/book/id/:identifier/", s.BookById)
+		v1.GET("api/book/id/:identifier/similar", s.BookSimilar)
 		v1.GET("api/book/title/:identifier/", s.BookByTitle)
 		v1.GET("api/book/top100/", s.GetTop100Books)
+		v1.GET("api/concert/", s.Concerts)
+		v1.GET("api/concert/id/:identifier/", s.ConcertById)
+		if s.Images.Cache != "" {
+			v1.GET("api/images/tmdb/:size/:file", s.TmdbImage)
+			v1.GET("api/images/cover/:isbn", s.CoverImage)
+		}
 	}
 	go func() {
 		if err := s.Router.Run(":9997"); err != nil && err != http.ErrServerClosed {
@@ -280,6 +369,7 @@ func (s *SearchService) Start() error {
 	signal.Notify(kill, syscall.SIGINT, syscall.SIGTERM)
 	sig := <-kill
 	s.Logger.Printf("Gracefully shutting down the server: %v\n.", sig)
+	stopJobs()
 	s.State = services.StateDown
 	s.DB.Close()
 	return fmt.Errorf("server closed")
@@ -306,11 +396,20 @@ func (s *SearchService) HealthCheck() error {
 		return fmt.Errorf("No config setup")
 	}
 
+	if s.Similar == nil {
+		return fmt.Errorf("No similar items cache setup")
+	}
+
+	if s.Images == nil {
+		return fmt.Errorf("No images config setup")
+	}
+
 	return nil
 }
 
-// TvByTitle gets tv by the title
-func (s *SearchService) TvByTitle(ctx *gin.Context) {
+// MovieByTitle gets movie by the title, a missing one is fetched by the
+// ingest service first.
+func (s *SearchService) MovieByTitle(ctx *gin.Context) {
 	var uc services.UriContent[string]
 	uc.Content = ctx.Param("identifier")
 
@@ -325,8 +424,11 @@ func (s *SearchService) TvByTitle(ctx *gin.Context) {
 		s.Logger.Printf("no id for title %v\n", uc.Content)
 		// call Ingest and then try to select from database
 		req, _ := http.NewRequest("POST",
-			fmt.Sprintf("http://localhost:9998/v1/api/ingest/%s", uc.Content), nil)
-		http.DefaultClient.Do(req)
+			fmt.Sprintf("http://localhost:9998/v1/api/ingest/movie/%s", uc.Content), nil)
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+		s.DB.QueryRow(`call find_movie_id(?)`, uc.Content).Scan(&id)
 	}
 
 	var ms database.MovieSelectable
@@ -346,11 +448,12 @@ func (s *SearchService) TvByTitle(ctx *gin.Context) {
 	s.GetKeywords(&ms)
 	s.GetProductionCompanies(&ms)
 	s.GetSpokenLanguages(&ms)
+	s.GetMovieImages(&ms)
 	services.NewGoodContentRequest(ctx, ms)
 }
 
-// TvById gets tv by id
-func (s *SearchService) TvById(ctx *gin.Context) {
+// MovieById gets movie by id
+func (s *SearchService) MovieById(ctx *gin.Context) {
 	var uc services.UriContent[uint64]
 	uc.Content, _ = strconv.ParseUint(ctx.Param("identifier"), 10, 64)
 
@@ -373,6 +476,7 @@ func (s *SearchService) TvById(ctx *gin.Context) {
 	s.GetKeywords(&ms)
 	s.GetProductionCompanies(&ms)
 	s.GetSpokenLanguages(&ms)
+	s.GetMovieImages(&ms)
 	services.NewGoodContentRequest(ctx, ms)
 }
 
@@ -392,6 +496,7 @@ func (s *SearchService) BookById(ctx *gin.Context) {
 		services.NewBadContentRequest(ctx, "book doesn't exist")
 		return
 	}
+	s.GetBookCovers(&bs)
 
 	services.NewGoodContentRequest(ctx, bs)
 }
@@ -419,6 +524,7 @@ func (s *SearchService) BookByTitle(ctx *gin.Context) {
 		services.NewBadContentRequest(ctx, "error fetching book details")
 		return
 	}
+	s.GetBookCovers(&bs)
 
 	services.NewGoodContentRequest(ctx, bs)
 }
@@ -0,0 +1,207 @@
+package search
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
+)
+
+// GetSeriesById fetches the series with its genres, networks, seasons and
+// images.
+func (s *SearchService) GetSeriesById(id uint64) (*database.SeriesSelectable, error) {
+	ss, err := database.ScanSeries(s.DB.QueryRow("CALL get_series_by_id(?)", id))
+	if err != nil {
+		return nil, err
+	}
+	s.GetSeriesDetails(ss)
+	s.GetSeriesImages(ss)
+	return ss, nil
+}
+
+// GetSeriesDetails fills the genres, networks and seasons of the series.
+func (s *SearchService) GetSeriesDetails(ss *database.SeriesSelectable) {
+	ss.Genres = make([]database.Genre, 0, 4)
+	if rows, err := s.DB.Query(`call get_series_genres(?)`, ss.SeriesId); err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var g database.Genre
+			if err := rows.Scan(&g.IdName.Id, &g.IdName.Name); err != nil {
+				s.Logger.Printf("couldn't scan the genre, reason: %v\n", err)
+				continue
+			}
+			ss.Genres = append(ss.Genres, g)
+		}
+	} else {
+		s.Logger.Printf("couldn't fetch series genres, reason: %v\n", err)
+	}
+
+	ss.Networks = make([]database.NetworkInsertable, 0, 2)
+	if rows, err := s.DB.Query(`call get_series_networks(?)`, ss.SeriesId); err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var n database.NetworkInsertable
+			var country *string
+			if err := rows.Scan(&n.Id, &n.Name, &country); err != nil {
+				s.Logger.Printf("couldn't scan the network, reason: %v\n", err)
+				continue
+			}
+			if country != nil {
+				n.Country = *country
+			}
+			ss.Networks = append(ss.Networks, n)
+		}
+	} else {
+		s.Logger.Printf("couldn't fetch series networks, reason: %v\n", err)
+	}
+
+	ss.Seasons = make([]database.SeasonInsertable, 0, ss.NumberOfSeasons)
+	if rows, err := s.DB.Query(`call get_series_seasons(?)`, ss.SeriesId); err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var si database.SeasonInsertable
+			var overview *string
+			if err := rows.Scan(&si.SeasonNumber, &si.Name, &overview, &si.AirDate,
+				&si.EpisodeCount); err != nil {
+				s.Logger.Printf("couldn't scan the season, reason: %v\n", err)
+				continue
+			}
+			if overview != nil {
+				si.Overview = *overview
+			}
+			ss.Seasons = append(ss.Seasons, si)
+		}
+	} else {
+		s.Logger.Printf("couldn't fetch series seasons, reason: %v\n", err)
+	}
+}
+
+// SeriesById gets series by id
+func (s *SearchService) SeriesById(ctx *gin.Context) {
+	var uc services.UriContent[uint64]
+	uc.Content, _ = strconv.ParseUint(ctx.Param("identifier"), 10, 64)
+
+	ss, err := s.GetSeriesById(uc.Content)
+	if err != nil {
+		s.Logger.Printf("Lookup failed for ID %v: %v\n", uc.Content, err)
+		services.NewBadContentRequest(ctx, "series doesn't exist")
+		return
+	}
+	services.NewGoodContentRequest(ctx, ss)
+}
+
+// SeriesByTitle gets series by the title, a missing one is fetched by the
+// ingest service first. Query parameters: `year`, `tmdb_id`.
+func (s *SearchService) SeriesByTitle(ctx *gin.Context) {
+	var uc services.UriContent[string]
+	uc.Content = ctx.Param("identifier")
+
+	if uc.Content == "" {
+		s.Logger.Println("couldn't parse title")
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+
+	var id uint64
+	if err := s.DB.QueryRow(`call find_series_id(?)`, uc.Content).Scan(&id); err != nil {
+		s.Logger.Printf("no id for title %v\n", uc.Content)
+		// call Ingest and then try to select from database
+		// `year` and `tmdb_id` are passed on to pick the right series
+		req, _ := http.NewRequest("POST",
+			fmt.Sprintf("http://localhost:9998/v1/api/ingest/tv/%s?%s", uc.Content,
+				ctx.Request.URL.RawQuery), nil)
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+		s.DB.QueryRow(`call find_series_id(?)`, uc.Content).Scan(&id)
+	}
+
+	ss, err := s.GetSeriesById(id)
+	if err != nil {
+		s.Logger.Printf("Lookup failed for ID %v: %v\n", id, err)
+		services.NewBadContentRequest(ctx, "series doesn't exist")
+		return
+	}
+	services.NewGoodContentRequest(ctx, ss)
+}
+
+// SeriesSimilar returns series sharing genres, networks and language with the
+// given one. Query parameters: `limit`.
+func (s *SearchService) SeriesSimilar(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("identifier"), 10, 64)
+	if err != nil {
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	similar, err := s.similarItems("tv", `CALL get_similar_series(?, ?)`, id)
+	if err != nil {
+		s.Logger.Printf("couldn't fetch similar series, reason: %v\n", err)
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+
+	series := make([]Recommendation[*database.SeriesSelectable], 0, len(similar))
+	for _, si := range similar[:min(similarLimit(ctx), len(similar))] {
+		ss, err := s.GetSeriesById(si.Id)
+		if err != nil {
+			s.Logger.Printf("similar series %v not found, reason: %v\n", si.Id, err)
+			continue
+		}
+		series = append(series, Recommendation[*database.SeriesSelectable]{
+			Score: si.Score, Reason: si.Shared, Item: ss,
+		})
+	}
+	services.NewGoodContentRequest(ctx, series)
+}
+
+// GetTop100Series returns the most popular series.
+func (s *SearchService) GetTop100Series(ctx *gin.Context) {
+	series, err := s.GetPopularSeries(100)
+	if err != nil {
+		s.Logger.Printf("cannot query top 100 series, reason: %v\n", err)
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	services.NewGoodContentRequest(ctx, series)
+}
+
+// GetPopularSeries returns the most popular series with their images, but
+// without their details.
+func (s *SearchService) GetPopularSeries(limit int) ([]*database.SeriesSelectable, error) {
+	rows, err := s.DB.Query(`select ID, tmdb_id, language, title, original_title,
+		overview, popularity, first_air_date, last_air_date, number_of_seasons,
+		number_of_episodes, episode_runtime, status, in_production, tagline,
+		rating, total_ratings from series order by popularity desc limit ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	series := make([]*database.SeriesSelectable, 0, limit)
+
+	for rows.Next() {
+		ss, err := database.ScanSeries(rows)
+		if err != nil {
+			s.Logger.Println(err)
+			continue
+		}
+		series = append(series, ss)
+	}
+	s.GetSeriesImages(series...)
+	return series, rows.Err()
+}
+
+func (s *SearchService) seriesByIds(ids []uint64) []*database.SeriesSelectable {
+	series := make([]*database.SeriesSelectable, 0, len(ids))
+	for _, id := range ids {
+		ss, err := s.GetSeriesById(id)
+		if err != nil {
+			s.Logger.Printf("series %v not found, reason: %v\n", id, err)
+			continue
+		}
+		series = append(series, ss)
+	}
+	return series
+}
@@ -0,0 +1,186 @@
+package search
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
+)
+
+const (
+	DefaultSimilarLimit = 10
+	// MaxSimilarLimit is also how many similar items are cached per item.
+	MaxSimilarLimit = 50
+	// SimilarCacheTtl is how long, in seconds, the similar items are cached.
+	SimilarCacheTtl = 3600
+	// SimilarCacheSize is how many items' similar items are cached at most.
+	SimilarCacheSize = 10000
+)
+
+// similarItem is a single row of `get_similar_movies`, `get_similar_series`
+// or `get_similar_books`.
+type similarItem struct {
+	Id     uint64
+	Score  float64
+	Shared string
+}
+
+type similarEntry struct {
+	Items     []similarItem
+	ExpiresAt time.Time
+}
+
+// SimilarCache keeps the similar items of every requested item, computing
+// them is a few self joins over the largest tables. It holds at most `size`
+// entries, the expired ones are deleted when they're read or the cache is full.
+type SimilarCache struct {
+	mu      sync.Mutex
+	entries map[string]similarEntry
+	ttl     time.Duration
+	size    int
+}
+
+func NewSimilarCache(ttl time.Duration, size int) *SimilarCache {
+	return &SimilarCache{
+		entries: map[string]similarEntry{},
+		ttl:     ttl,
+		size:    size,
+	}
+}
+
+func (sc *SimilarCache) Get(key string) ([]similarItem, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	e, ok := sc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.ExpiresAt) {
+		delete(sc.entries, key)
+		return nil, false
+	}
+	return e.Items, true
+}
+
+// Put caches the items. If the cache is full, the expired entries are deleted
+// and, if none was, the one closest to expiring.
+func (sc *SimilarCache) Put(key string, items []similarItem) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	now := time.Now()
+	if _, ok := sc.entries[key]; !ok && len(sc.entries) >= sc.size {
+		var oldestKey string
+		var oldest time.Time
+		for k, e := range sc.entries {
+			if now.After(e.ExpiresAt) {
+				delete(sc.entries, k)
+			} else if oldestKey == "" || e.ExpiresAt.Before(oldest) {
+				oldestKey, oldest = k, e.ExpiresAt
+			}
+		}
+		if len(sc.entries) >= sc.size {
+			delete(sc.entries, oldestKey)
+		}
+	}
+	sc.entries[key] = similarEntry{Items: items, ExpiresAt: now.Add(sc.ttl)}
+}
+
+// MovieSimilar returns movies sharing genres, keywords, production companies
+// and spoken languages with the given one. Query parameters: `limit`.
+func (s *SearchService) MovieSimilar(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("identifier"), 10, 64)
+	if err != nil {
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	similar, err := s.similarItems("movie", `CALL get_similar_movies(?, ?)`, id)
+	if err != nil {
+		s.Logger.Printf("couldn't fetch similar movies, reason: %v\n", err)
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+
+	shows := make([]Recommendation[*database.MovieSelectable], 0, len(similar))
+	for _, si := range similar[:min(similarLimit(ctx), len(similar))] {
+		ms, err := s.GetMovieById(si.Id)
+		if err != nil {
+			s.Logger.Printf("similar movie %v not found, reason: %v\n", si.Id, err)
+			continue
+		}
+		shows = append(shows, Recommendation[*database.MovieSelectable]{
+			Score: si.Score, Reason: si.Shared, Item: ms,
+		})
+	}
+	services.NewGoodContentRequest(ctx, shows)
+}
+
+// BookSimilar returns books sharing authors, publisher and language with the
+// given one. Query parameters: `limit`.
+func (s *SearchService) BookSimilar(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("identifier"), 10, 64)
+	if err != nil {
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	similar, err := s.similarItems("book", `CALL get_similar_books(?, ?)`, id)
+	if err != nil {
+		s.Logger.Printf("couldn't fetch similar books, reason: %v\n", err)
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+
+	books := make([]Recommendation[*database.BookSelectable], 0, len(similar))
+	for _, si := range similar[:min(similarLimit(ctx), len(similar))] {
+		bs, err := s.GetBookById(si.Id)
+		if err != nil {
+			s.Logger.Printf("similar book %v not found, reason: %v\n", si.Id, err)
+			continue
+		}
+		books = append(books, Recommendation[*database.BookSelectable]{
+			Score: si.Score, Reason: si.Shared, Item: bs,
+		})
+	}
+	services.NewGoodContentRequest(ctx, books)
+}
+
+// similarItems returns the cached similar items or calls the procedure.
+func (s *SearchService) similarItems(itemType, query string, id uint64) ([]similarItem, error) {
+	key := itemType + ":" + strconv.FormatUint(id, 10)
+	if items, ok := s.Similar.Get(key); ok {
+		return items, nil
+	}
+
+	rows, err := s.DB.Query(query, id, MaxSimilarLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := make([]similarItem, 0, MaxSimilarLimit)
+	for rows.Next() {
+		var si similarItem
+		if err := rows.Scan(&si.Id, &si.Score, &si.Shared); err != nil {
+			s.Logger.Printf("couldn't scan the similar item, reason: %v\n", err)
+			continue
+		}
+		si.Shared = strings.ReplaceAll(si.Shared, ",", ", ")
+		items = append(items, si)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	s.Similar.Put(key, items)
+	return items, nil
+}
+
+func similarLimit(ctx *gin.Context) int {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit",
+		strconv.Itoa(DefaultSimilarLimit)))
+	if err != nil || limit <= 0 || limit > MaxSimilarLimit {
+		return DefaultSimilarLimit
+	}
+	return limit
+}
@@ -0,0 +1,218 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/services"
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultTrendingInterval = 300
+	DefaultTrendingWindow   = "7d"
+	DefaultTrendingLimit    = 25
+	MaxTrendingLimit        = 100
+)
+
+// TrendingWindows are the windows computed by `refresh_trending`.
+var TrendingWindows map[string]bool = map[string]bool{
+	"24h": true,
+	"7d":  true,
+	"30d": true,
+}
+
+// TrendingConfig is read from the `Trending` section of the service's config.
+type TrendingConfig struct {
+	// Interval is how often, in seconds, the scores are recomputed.
+	Interval int `mapstructure:"interval"`
+}
+
+// TrendingJob periodically recomputes the trending scores from user events.
+type TrendingJob struct {
+	DB       *sql.DB
+	Logger   *log.Logger
+	Interval time.Duration
+}
+
+// trendingItem is a single row of `get_trending`.
+type trendingItem struct {
+	Id         uint64
+	Score      float64
+	Events     int
+	ComputedAt time.Time
+}
+
+func (ti *trendingItem) reason(window string) string {
+	return fmt.Sprintf("%v interactions in the last %v", ti.Events, window)
+}
+
+type TrendingResponse struct {
+	Window     string                                        `json:"window"`
+	ComputedAt *time.Time                                    `json:"computed_at"`
+	Shows      []Recommendation[*database.MovieSelectable]   `json:"shows"`
+	Series     []Recommendation[*database.SeriesSelectable]  `json:"series"`
+	Books      []Recommendation[*database.BookSelectable]    `json:"books"`
+	Concerts   []Recommendation[*database.ConcertSelectable] `json:"concerts"`
+}
+
+// NewTrendingConfig reads the job configuration, the defaults are used if the
+// section is missing.
+func NewTrendingConfig(tableName string, v *viper.Viper) *TrendingConfig {
+	c := TrendingConfig{Interval: DefaultTrendingInterval}
+	if v != nil && v.IsSet(tableName) {
+		if err := v.UnmarshalKey(tableName, &c); err != nil {
+			GlobalSearchLogger.Printf("Got error while unmarshalling: %v\n", err)
+		}
+	}
+	if c.Interval <= 0 {
+		c.Interval = DefaultTrendingInterval
+	}
+	return &c
+}
+
+func NewTrendingJob(db *sql.DB, l *log.Logger, c *TrendingConfig) *TrendingJob {
+	return &TrendingJob{
+		DB:       db,
+		Logger:   l,
+		Interval: time.Duration(c.Interval) * time.Second,
+	}
+}
+
+// Run refreshes the scores until the context is cancelled.
+func (tj *TrendingJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(tj.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := tj.DB.ExecContext(ctx, `call refresh_trending()`); err != nil {
+			tj.Logger.Printf("couldn't refresh trending, reason: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Trending returns the items with the most user activity. Query parameters:
+// `type` (movie, tv, book or concert, all if empty), `window` (24h, 7d or 30d) and `limit`.
+func (s *SearchService) Trending(ctx *gin.Context) {
+	targetType := ctx.Query("type")
+	if _, ok := database.AllowedTypes[targetType]; targetType != "" && !ok {
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	window := ctx.DefaultQuery("window", DefaultTrendingWindow)
+	if !TrendingWindows[window] {
+		services.NewBadContentRequest(ctx, services.InvalidRequestMessage)
+		return
+	}
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit",
+		strconv.Itoa(DefaultTrendingLimit)))
+	if err != nil || limit <= 0 || limit > MaxTrendingLimit {
+		limit = DefaultTrendingLimit
+	}
+
+	content := &TrendingResponse{
+		Window:   window,
+		Shows:    []Recommendation[*database.MovieSelectable]{},
+		Series:   []Recommendation[*database.SeriesSelectable]{},
+		Books:    []Recommendation[*database.BookSelectable]{},
+		Concerts: []Recommendation[*database.ConcertSelectable]{},
+	}
+	if targetType == "" || targetType == "movie" {
+		rows, err := s.trendingRows("movie", window, limit)
+		if err != nil {
+			s.Logger.Printf("couldn't fetch trending shows, reason: %v\n", err)
+		}
+		for _, r := range rows {
+			ms, err := s.GetMovieById(r.Id)
+			if err != nil {
+				s.Logger.Printf("trending movie %v not found, reason: %v\n", r.Id, err)
+				continue
+			}
+			content.ComputedAt = &r.ComputedAt
+			content.Shows = append(content.Shows, Recommendation[*database.MovieSelectable]{
+				Score: r.Score, Reason: r.reason(window), Item: ms,
+			})
+		}
+	}
+	if targetType == "" || targetType == "tv" {
+		rows, err := s.trendingRows("tv", window, limit)
+		if err != nil {
+			s.Logger.Printf("couldn't fetch trending series, reason: %v\n", err)
+		}
+		for _, r := range rows {
+			ss, err := s.GetSeriesById(r.Id)
+			if err != nil {
+				s.Logger.Printf("trending series %v not found, reason: %v\n", r.Id, err)
+				continue
+			}
+			content.ComputedAt = &r.ComputedAt
+			content.Series = append(content.Series, Recommendation[*database.SeriesSelectable]{
+				Score: r.Score, Reason: r.reason(window), Item: ss,
+			})
+		}
+	}
+	if targetType == "" || targetType == "book" {
+		rows, err := s.trendingRows("book", window, limit)
+		if err != nil {
+			s.Logger.Printf("couldn't fetch trending books, reason: %v\n", err)
+		}
+		for _, r := range rows {
+			bs, err := s.GetBookById(r.Id)
+			if err != nil {
+				s.Logger.Printf("trending book %v not found, reason: %v\n", r.Id, err)
+				continue
+			}
+			content.ComputedAt = &r.ComputedAt
+			content.Books = append(content.Books, Recommendation[*database.BookSelectable]{
+				Score: r.Score, Reason: r.reason(window), Item: bs,
+			})
+		}
+	}
+	if targetType == "" || targetType == "concert" {
+		rows, err := s.trendingRows("concert", window, limit)
+		if err != nil {
+			s.Logger.Printf("couldn't fetch trending concerts, reason: %v\n", err)
+		}
+		for _, r := range rows {
+			cs, err := s.GetConcertById(r.Id)
+			if err != nil {
+				s.Logger.Printf("trending concert %v not found, reason: %v\n", r.Id, err)
+				continue
+			}
+			content.ComputedAt = &r.ComputedAt
+			content.Concerts = append(content.Concerts, Recommendation[*database.ConcertSelectable]{
+				Score: r.Score, Reason: r.reason(window), Item: cs,
+			})
+		}
+	}
+	services.NewGoodContentRequest(ctx, content)
+}
+
+func (s *SearchService) trendingRows(itemType, window string, limit int) ([]trendingItem, error) {
+	rows, err := s.DB.Query(`call get_trending(?, ?, ?)`, itemType, window, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []trendingItem{}
+	for rows.Next() {
+		var ti trendingItem
+		if err := rows.Scan(&ti.Id, &ti.Score, &ti.Events, &ti.ComputedAt); err != nil {
+			s.Logger.Printf("couldn't scan the trending item, reason: %v\n", err)
+			continue
+		}
+		items = append(items, ti)
+	}
+	return items, rows.Err()
+}
@@ -39,7 +39,7 @@ def startup_event():
         print(f"Błąd DB: {e}")
         print("Serwis działa w trybie pustym (/sync).")
 
-ItemType = Literal["movie", "book", "series"]
+ItemType = Literal["movie", "book", "series", "concert"]
 _TOKEN_RE = re.compile(r"[a-ząćęłńóśżź0-9]+", re.IGNORECASE)
 
 
@@ -52,6 +52,8 @@ class ItemPayload(BaseModel):
     type: ItemType
     title: str
     genres: List[str]
+    keywords: List[str] = []
+    overview: str = ""
 
 
 class ItemsSyncRequest(BaseModel):
@@ -132,6 +134,10 @@ class SparseTfidfIndex:
     def genre_token(genre: str) -> str:
         return f"genre:{genre.lower()}"
 
+    @staticmethod
+    def keyword_token(keyword: str) -> str:
+        return f"kw:{keyword.lower()}"
+
     def _get_tid(self, term: str, df_list: List[int]) -> int:
         tid = self.vocab.get(term)
         if tid is None:
@@ -171,6 +177,8 @@ class SparseTfidfIndex:
             tf = Counter(title_tokens)
             for g in genres:
                 tf[self.genre_token(g)] += 1
+            for kw in dict.fromkeys(it.get("keywords", [])):
+                tf[self.keyword_token(kw)] += 1
 
             terms_for_doc: List[Tuple[int, int]] = []
             for term, freq in tf.items():
@@ -565,7 +573,14 @@ def sync_items(req: ItemsSyncRequest):
 
     for it in req.items:
         k = item_key(it.type, it.id)
-        store.items_db[k] = {"id": it.id, "type": it.type, "title": it.title, "genres": it.genres}
+        store.items_db[k] = {
+            "id": it.id,
+            "type": it.type,
+            "title": it.title,
+            "genres": it.genres,
+            "keywords": it.keywords,
+            "overview": it.overview,
+        }
 
     rebuild_index()
 
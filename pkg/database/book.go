@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"slices"
 	"strconv"
@@ -42,6 +43,9 @@ type BookInsertable struct {
 	TotalRating int64     `json:"total_rating"`
 	ReleaseDate time.Time `json:"release_date"`
 	Publisher   string    `json:"publisher"`
+	// CoverUrl is given by some datasets, the others get the cover of the
+	// ISBN when the book is selected.
+	CoverUrl string `json:"cover_url,omitempty"`
 }
 
 type AuthorInsertable struct {
@@ -155,6 +159,7 @@ func InsertIntoAuthorsChunked(db *sql.DB, chunkSize *int) func(data *Insertable)
 		defer close(c)
 		c <- true
 
+		var loadErr error
 		var wg sync.WaitGroup
 		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
 			wg.Go(
@@ -176,18 +181,22 @@ func InsertIntoAuthorsChunked(db *sql.DB, chunkSize *int) func(data *Insertable)
 						}
 					}
 
+					if len(queryFields) == 0 {
+						return
+					}
 					// here put insert statements
 					<-c
 					stmt := fmt.Sprintf("%v%v", query, strings.Join(queryFields, ","))
 					err := InsertStmt(db, &stmt, &argFields)
 					if err != nil {
 						DatabaseLogger.Println(err)
+						loadErr = errors.Join(loadErr, err)
 					}
 					c <- true
 				})
 		}
 		wg.Wait()
-		return nil
+		return loadErr
 	}
 }
 
@@ -206,6 +215,7 @@ func InsertIntoBooksChunked(db *sql.DB, chunkSize *int) func(data *Insertable) e
 		defer close(c)
 		c <- true
 
+		var loadErr error
 		var wg sync.WaitGroup
 		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
 			wg.Go(
@@ -241,17 +251,23 @@ func InsertIntoBooksChunked(db *sql.DB, chunkSize *int) func(data *Insertable) e
 						argFields = append(argFields, bi.Publisher)
 					}
 
+					if len(queryFields) == 0 {
+						return
+					}
 					// here put insert statements
 					<-c
-					stmt := fmt.Sprintf("%v%v", query, strings.Join(queryFields, ","))
+					// re-ingested books overwrite the old values
+					stmt := fmt.Sprintf("%v%v%v", query, strings.Join(queryFields, ","),
+						UpsertSuffix(t, "ID"))
 					err := InsertStmt(db, &stmt, &argFields)
 					if err != nil {
 						DatabaseLogger.Println(err)
+						loadErr = errors.Join(loadErr, err)
 					}
 					c <- true
 				})
 		}
 		wg.Wait()
-		return nil
+		return loadErr
 	}
 }
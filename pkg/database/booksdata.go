@@ -0,0 +1,212 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Extractor and loader of the books dataset (books-data). The books have no
+// Goodreads id, so they are merged with the existing ones by ISBN, or by the
+// title and an author if the file has no ISBN.
+
+var authorsSeparator *regexp.Regexp = regexp.MustCompile(`\s*(?:,|;|&|\band\b)\s*`)
+
+// BooksDataFromStream returns the extractor of a books-data CSV.
+func BooksDataFromStream(header []string) (func(stream *[]string, data *Insertable) error, error) {
+	col, err := headerColumns(header, "title", "authors")
+	if err != nil {
+		return nil, err
+	}
+	return func(stream *[]string, data *Insertable) error {
+		s := *stream
+		if slices.Equal(s, header) {
+			return ErrHeaderRow
+		}
+		if col(s, "title") == "" {
+			return fmt.Errorf("book has no title")
+		}
+
+		target := &BookInsertable{}
+		target.Title = Truncate(col(s, "title"), 128)
+		target.Authors = parseAuthors(col(s, "authors"))
+		target.Isbn = strings.ReplaceAll(col(s, "isbn"), "-", "")
+		target.Isbn13 = strings.ReplaceAll(col(s, "isbn13"), "-", "")
+		if len(target.Isbn) != 10 {
+			target.Isbn = ""
+		}
+		if len(target.Isbn13) != 13 {
+			target.Isbn13 = ""
+		}
+		target.Language = Truncate(col(s, "language"), 3)
+		target.Pages, _ = strconv.ParseInt(col(s, "pages"), 10, 64)
+		target.Rating, _ = strconv.ParseFloat(col(s, "rating"), 64)
+		target.Publisher = Truncate(col(s, "publisher"), 128)
+		target.ReleaseDate = parsePublishDate(col(s, "publish date"),
+			col(s, "publish date (month)"), col(s, "publish date (year)"))
+		for _, column := range []string{"cover", "image_url", "image"} {
+			if url := col(s, column); strings.HasPrefix(url, "http") && len(url) <= 512 {
+				target.CoverUrl = url
+				break
+			}
+		}
+		*data = target
+		return nil
+	}, nil
+}
+
+// parseAuthors splits e.g. "By John Smith, Jane Doe and Bob Roe".
+func parseAuthors(s string) []string {
+	s = strings.TrimSpace(s)
+	if len(s) > 3 && strings.EqualFold(s[:3], "by ") {
+		s = s[3:]
+	}
+	authors := []string{}
+	for _, author := range authorsSeparator.Split(s, -1) {
+		if author = strings.TrimSpace(author); author != "" {
+			authors = append(authors, Truncate(author, 128))
+		}
+	}
+	return authors
+}
+
+// parsePublishDate accepts the full date, e.g. "Friday, January 1, 1993", or
+// the month and the year columns.
+func parsePublishDate(full, month, year string) time.Time {
+	if t, err := time.Parse("Monday, January 2, 2006", full); err == nil {
+		return t
+	}
+	if t, err := time.Parse("January 2006", month+" "+year); err == nil {
+		return t
+	}
+	if t, err := time.Parse("2006", year); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+func nullableTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// findBook returns the id of the book matching the ISBN, or the title and one
+// of the authors. Zero if there is no such book.
+func findBook(tx *sql.Tx, bi *BookInsertable) (uint64, error) {
+	var id uint64
+	var err error
+	switch {
+	case bi.Isbn13 != "":
+		err = tx.QueryRow(`select ID from books where isbn13=? limit 1`,
+			bi.Isbn13).Scan(&id)
+	case bi.Isbn != "":
+		err = tx.QueryRow(`select ID from books where isbn=? limit 1`,
+			bi.Isbn).Scan(&id)
+	case len(bi.Authors) > 0:
+		err = tx.QueryRow(`select b.ID from books b join authors a
+			on a.book_id=b.ID where b.title=? and a.author=? limit 1`,
+			bi.Title, bi.Authors[0]).Scan(&id)
+	default:
+		err = tx.QueryRow(`select ID from books where title=? limit 1`,
+			bi.Title).Scan(&id)
+	}
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// mergeBook fills the missing fields of an existing book, or inserts a new
+// one, together with its authors.
+func mergeBook(tx *sql.Tx, bi *BookInsertable) error {
+	id, err := findBook(tx, bi)
+	if err != nil {
+		return err
+	}
+
+	if id != 0 {
+		if _, err := tx.Exec(`update books set
+			isbn=if(isbn='', ?, isbn), isbn13=if(isbn13='', ?, isbn13),
+			language=coalesce(nullif(language, ''), ?),
+			pages=coalesce(nullif(pages, 0), ?),
+			release_date=coalesce(release_date, ?),
+			publisher=coalesce(nullif(publisher, ''), ?),
+			cover_url=coalesce(cover_url, ?)
+			where ID=?`, bi.Isbn, bi.Isbn13, bi.Language, bi.Pages,
+			nullableTime(bi.ReleaseDate), bi.Publisher,
+			nullableString(bi.CoverUrl), id); err != nil {
+			return err
+		}
+	} else {
+		res, err := tx.Exec(`insert into books(title, rating, isbn, isbn13,
+			language, pages, total_ratings, release_date, publisher, cover_url)
+			values (?, ?, ?, ?, ?, ?, 0, ?, ?, ?)`, bi.Title, bi.Rating, bi.Isbn,
+			bi.Isbn13, bi.Language, bi.Pages, nullableTime(bi.ReleaseDate),
+			bi.Publisher, nullableString(bi.CoverUrl))
+		if err != nil {
+			return err
+		}
+		lastId, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		id = uint64(lastId)
+	}
+
+	for _, author := range bi.Authors {
+		if _, err := tx.Exec(`insert into authors(book_id, author)
+			select ?, ? from dual where not exists
+			(select 1 from authors where book_id=? and author=?)`,
+			id, author, id, author); err != nil {
+			return err
+		}
+	}
+	bi.BookId = id
+	return nil
+}
+
+// MergeIntoBooks merges the books one by one, every chunk is a transaction.
+// A failed chunk is rolled back, the others are kept.
+func MergeIntoBooks(db *sql.DB, chunkSize *int) func(data *Insertable) error {
+	return func(i *Insertable) error {
+		ip, ok := (*i).(*InsertPipeline)
+		if !ok {
+			return fmt.Errorf("invalid interface (not a InsertPipeline)")
+		}
+
+		var loadErr error
+		for start := 0; start < len(*ip.Data); start += *chunkSize {
+			chunk := (*ip.Data)[start:min(start+*chunkSize, len(*ip.Data))]
+			if err := mergeBooksChunk(db, chunk); err != nil {
+				DatabaseLogger.Println(err)
+				loadErr = errors.Join(loadErr, err)
+			}
+		}
+		return loadErr
+	}
+}
+
+func mergeBooksChunk(db *sql.DB, chunk []*Insertable) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, item := range chunk {
+		bi, ok := (*item).(*BookInsertable)
+		if !ok {
+			continue
+		}
+		if err := mergeBook(tx, bi); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("couldn't merge %q: %v", bi.Title, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/sadsonkeenolee/IO_projekt/pkg/mlclient"
+)
+
+// CatalogItems returns movies, series, books and concerts changed since the
+// given time, in the form the recommendation services expect, together with
+// the latest change among them. The rows that can't be scanned are skipped.
+func CatalogItems(ctx context.Context, db *sql.DB, since time.Time) ([]mlclient.Item, time.Time, error) {
+	items := []mlclient.Item{}
+	var latest, updatedAt time.Time
+	add := func(item mlclient.Item) {
+		items = append(items, item)
+		if updatedAt.After(latest) {
+			latest = updatedAt
+		}
+	}
+
+	movieRows, err := db.QueryContext(ctx, `call get_changed_movies(?)`, since)
+	if err != nil {
+		return nil, latest, err
+	}
+	defer movieRows.Close()
+	for movieRows.Next() {
+		var genres, keywords string
+		item := mlclient.Item{Type: "movie"}
+		if err := movieRows.Scan(&item.Id, &item.Title, &item.Overview,
+			&genres, &keywords, &updatedAt); err != nil {
+			DatabaseLogger.Printf("couldn't scan the movie, reason: %v\n", err)
+			continue
+		}
+		item.Genres = splitNonEmpty(genres)
+		item.Keywords = splitNonEmpty(keywords)
+		add(item)
+	}
+
+	// The networks are used as keywords.
+	seriesRows, err := db.QueryContext(ctx, `call get_changed_series(?)`, since)
+	if err != nil {
+		return nil, latest, err
+	}
+	defer seriesRows.Close()
+	for seriesRows.Next() {
+		var genres, networks string
+		item := mlclient.Item{Type: "series"}
+		if err := seriesRows.Scan(&item.Id, &item.Title, &item.Overview,
+			&genres, &networks, &updatedAt); err != nil {
+			DatabaseLogger.Printf("couldn't scan the series, reason: %v\n", err)
+			continue
+		}
+		item.Genres = splitNonEmpty(genres)
+		item.Keywords = splitNonEmpty(networks)
+		add(item)
+	}
+
+	// Books have no genres nor description, the authors, the publisher and
+	// the language are used as keywords.
+	bookRows, err := db.QueryContext(ctx, `call get_changed_books(?)`, since)
+	if err != nil {
+		return nil, latest, err
+	}
+	defer bookRows.Close()
+	for bookRows.Next() {
+		var authors, publisher, language string
+		item := mlclient.Item{Type: "book", Genres: []string{}}
+		if err := bookRows.Scan(&item.Id, &item.Title, &authors, &publisher,
+			&language, &updatedAt); err != nil {
+			DatabaseLogger.Printf("couldn't scan the book, reason: %v\n", err)
+			continue
+		}
+		item.Keywords = splitNonEmpty(authors)
+		for _, kw := range []string{publisher, language} {
+			if kw != "" {
+				item.Keywords = append(item.Keywords, kw)
+			}
+		}
+		add(item)
+	}
+
+	// Concerts have no overview, the artist and the city are used as keywords.
+	concertRows, err := db.QueryContext(ctx, `select e.ID, e.title,
+		coalesce(a.genre, ''), a.name, v.city, e.updated_at from events e
+		join artists a on a.ID = e.artist_id join venues v on v.ID = e.venue_id
+		where e.updated_at >= ? order by e.ID`, since)
+	if err != nil {
+		return nil, latest, err
+	}
+	defer concertRows.Close()
+	for concertRows.Next() {
+		var genre, artist, city string
+		item := mlclient.Item{Type: "concert"}
+		if err := concertRows.Scan(&item.Id, &item.Title, &genre, &artist, &city,
+			&updatedAt); err != nil {
+			DatabaseLogger.Printf("couldn't scan the concert, reason: %v\n", err)
+			continue
+		}
+		item.Genres = splitNonEmpty(genre)
+		item.Keywords = []string{artist, city}
+		add(item)
+	}
+	return items, latest, nil
+}
+
+func splitNonEmpty(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, "|")
+}
@@ -0,0 +1,315 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConcertStatuses are the values of `events.status`.
+var ConcertStatuses map[string]bool = map[string]bool{
+	"scheduled": true,
+	"postponed": true,
+	"cancelled": true,
+	"sold_out":  true,
+}
+
+// concertTimeLayouts are tried in order while parsing `starts_at`.
+var concertTimeLayouts []string = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+type ArtistInsertable struct {
+	Name    string `json:"name"`
+	Genre   string `json:"genre"`
+	Country string `json:"country"`
+}
+
+type VenueInsertable struct {
+	Name      string   `json:"name"`
+	City      string   `json:"city"`
+	Country   string   `json:"country"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+}
+
+// ConcertInsertable is a single event, the artist and the venue are created
+// on the fly.
+type ConcertInsertable struct {
+	ExternalId string           `json:"external_id"`
+	Title      string           `json:"title"`
+	Artist     ArtistInsertable `json:"artist"`
+	Venue      VenueInsertable  `json:"venue"`
+	StartsAt   time.Time        `json:"starts_at"`
+	Status     string           `json:"status"`
+	TicketUrl  string           `json:"ticket_url"`
+}
+
+func (ci *ConcertInsertable) IsInsertable() (*Table, bool) {
+	return NewTable(
+		"events",
+		[]string{"external_id", "title", "artist_id", "venue_id", "starts_at",
+			"status", "ticket_url"},
+	), true
+}
+
+func (ci *ConcertInsertable) ConstructInsertQuery() string {
+	t, ok := ci.IsInsertable()
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("INSERT INTO %v%v VALUES ", t.Name, JoinTableFields(t))
+}
+
+type ConcertSelectable struct {
+	Id uint64 `json:"id"`
+	ConcertInsertable
+}
+
+func (cs *ConcertSelectable) IsSelectable() (*Table, bool) {
+	return NewTable(
+		"events",
+		[]string{"ID", "external_id", "title", "starts_at", "status",
+			"ticket_url"},
+	), true
+}
+
+func (cs *ConcertSelectable) ConstructSelectQuery() string {
+	_, ok := cs.IsSelectable()
+	if !ok {
+		return ""
+	}
+	return "call get_concert_by_id(?)"
+}
+
+// ScanFields returns the destinations of the `get_concert_by_id` and
+// `find_concerts` columns.
+func (cs *ConcertSelectable) ScanFields() []any {
+	return []any{&cs.Id, &cs.ExternalId, &cs.Title, &cs.StartsAt, &cs.Status,
+		&cs.TicketUrl, &cs.Artist.Name, &cs.Artist.Genre, &cs.Artist.Country,
+		&cs.Venue.Name, &cs.Venue.City, &cs.Venue.Country, &cs.Venue.Latitude,
+		&cs.Venue.Longitude}
+}
+
+// ParseConcertTime accepts RFC 3339 and the common date and time layouts.
+func ParseConcertTime(s string) (time.Time, error) {
+	for _, layout := range concertTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%v is incorrect date", s)
+}
+
+// normalize checks the required fields and fits the rest into the columns.
+func (ci *ConcertInsertable) normalize() error {
+	ci.Artist.Name = Truncate(strings.TrimSpace(ci.Artist.Name), 256)
+	ci.Venue.Name = Truncate(strings.TrimSpace(ci.Venue.Name), 256)
+	ci.Venue.City = Truncate(strings.TrimSpace(ci.Venue.City), 128)
+	switch {
+	case ci.Artist.Name == "":
+		return fmt.Errorf("concert has no artist")
+	case ci.Venue.Name == "" || ci.Venue.City == "":
+		return fmt.Errorf("concert of %v has no venue", ci.Artist.Name)
+	case ci.StartsAt.IsZero():
+		return fmt.Errorf("concert of %v has no date", ci.Artist.Name)
+	}
+	if ci.Title == "" {
+		ci.Title = ci.Artist.Name
+	}
+	ci.Title = Truncate(ci.Title, 256)
+	// without an id the event is identified by who plays where and when
+	if ci.ExternalId == "" {
+		ci.ExternalId = fmt.Sprintf("%v|%v|%v", ci.Artist.Name, ci.Venue.Name,
+			ci.StartsAt.Format(time.RFC3339))
+	}
+	ci.ExternalId = Truncate(ci.ExternalId, 128)
+	ci.Status = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(ci.Status)), " ", "_")
+	if !ConcertStatuses[ci.Status] {
+		ci.Status = "scheduled"
+	}
+	if len(ci.Artist.Country) != 2 {
+		ci.Artist.Country = ""
+	}
+	if len(ci.Venue.Country) != 2 {
+		ci.Venue.Country = ""
+	}
+	ci.Artist.Country = strings.ToUpper(ci.Artist.Country)
+	ci.Venue.Country = strings.ToUpper(ci.Venue.Country)
+	ci.Artist.Genre = Truncate(ci.Artist.Genre, 64)
+	ci.TicketUrl = Truncate(ci.TicketUrl, 512)
+	return nil
+}
+
+// ConcertFromStream returns the extractor of a concerts CSV. The columns are
+// `id`, `title`, `artist`, `genre`, `artist_country`, `venue`, `city`,
+// `country`, `latitude`, `longitude`, `starts_at`, `status` and `ticket_url`.
+func ConcertFromStream(header []string) (func(stream *[]string, data *Insertable) error, error) {
+	col, err := headerColumns(header, "artist", "venue", "city", "starts_at")
+	if err != nil {
+		return nil, err
+	}
+	return func(stream *[]string, data *Insertable) error {
+		s := *stream
+		if slices.Equal(s, header) {
+			return ErrHeaderRow
+		}
+		startsAt, err := ParseConcertTime(col(s, "starts_at"))
+		if err != nil {
+			return err
+		}
+		target := &ConcertInsertable{
+			ExternalId: col(s, "id"),
+			Title:      col(s, "title"),
+			Artist: ArtistInsertable{
+				Name:    col(s, "artist"),
+				Genre:   col(s, "genre"),
+				Country: col(s, "artist_country"),
+			},
+			Venue: VenueInsertable{
+				Name:    col(s, "venue"),
+				City:    col(s, "city"),
+				Country: col(s, "country"),
+			},
+			StartsAt:  startsAt,
+			Status:    col(s, "status"),
+			TicketUrl: col(s, "ticket_url"),
+		}
+		if lat, err := strconv.ParseFloat(col(s, "latitude"), 64); err == nil {
+			target.Venue.Latitude = &lat
+		}
+		if lon, err := strconv.ParseFloat(col(s, "longitude"), 64); err == nil {
+			target.Venue.Longitude = &lon
+		}
+		if err := target.normalize(); err != nil {
+			return err
+		}
+		*data = target
+		return nil
+	}, nil
+}
+
+// ConcertFromJsonStream extracts a concert from a JSON object, the stream holds
+// the whole object in its only field. The fields are those of
+// ConcertInsertable, `starts_at` may be in any of the layouts accepted by
+// ParseConcertTime.
+func ConcertFromJsonStream(stream *[]string, data *Insertable) error {
+	if len(*stream) != 1 {
+		return fmt.Errorf("invalid length (%v): expected (1)\n", len(*stream))
+	}
+	var raw struct {
+		ConcertInsertable
+		Id       string `json:"id"`
+		StartsAt string `json:"starts_at"`
+	}
+	if err := json.Unmarshal([]byte((*stream)[0]), &raw); err != nil {
+		return err
+	}
+	target := &raw.ConcertInsertable
+	if target.ExternalId == "" {
+		target.ExternalId = raw.Id
+	}
+	startsAt, err := ParseConcertTime(raw.StartsAt)
+	if err != nil {
+		return err
+	}
+	target.StartsAt = startsAt
+	if err := target.normalize(); err != nil {
+		return err
+	}
+	*data = target
+	return nil
+}
+
+func nullableString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// mergeConcert creates or updates the artist and the venue, then the event.
+func mergeConcert(tx *sql.Tx, ci *ConcertInsertable) error {
+	// last_insert_id(ID) makes the id of an existing row available as well
+	res, err := tx.Exec(`insert into artists(name, genre, country)
+		values (?, ?, ?) on duplicate key update ID=last_insert_id(ID),
+		genre=coalesce(values(genre), genre),
+		country=coalesce(values(country), country)`, ci.Artist.Name,
+		nullableString(ci.Artist.Genre), nullableString(ci.Artist.Country))
+	if err != nil {
+		return err
+	}
+	artistId, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	res, err = tx.Exec(`insert into venues(name, city, country, latitude,
+		longitude) values (?, ?, ?, ?, ?) on duplicate key update
+		ID=last_insert_id(ID), country=coalesce(values(country), country),
+		latitude=coalesce(values(latitude), latitude),
+		longitude=coalesce(values(longitude), longitude)`, ci.Venue.Name,
+		ci.Venue.City, nullableString(ci.Venue.Country), ci.Venue.Latitude,
+		ci.Venue.Longitude)
+	if err != nil {
+		return err
+	}
+	venueId, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	t, _ := ci.IsInsertable()
+	stmt := fmt.Sprintf("%v%v%v", ci.ConstructInsertQuery(), t.QueryField,
+		UpsertSuffix(t, "external_id"))
+	_, err = tx.Exec(stmt, ci.ExternalId, ci.Title, artistId, venueId,
+		ci.StartsAt, ci.Status, nullableString(ci.TicketUrl))
+	return err
+}
+
+// MergeIntoConcerts loads the concerts one by one, every chunk is a
+// transaction. A failed chunk is rolled back, the others are kept.
+func MergeIntoConcerts(db *sql.DB, chunkSize *int) func(data *Insertable) error {
+	return func(i *Insertable) error {
+		ip, ok := (*i).(*InsertPipeline)
+		if !ok {
+			return fmt.Errorf("invalid interface (not a InsertPipeline)")
+		}
+
+		var loadErr error
+		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
+			if err := mergeConcertsChunk(db, chunk); err != nil {
+				DatabaseLogger.Println(err)
+				loadErr = errors.Join(loadErr, err)
+			}
+		}
+		return loadErr
+	}
+}
+
+func mergeConcertsChunk(db *sql.DB, chunk []*Insertable) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, item := range chunk {
+		ci, ok := (*item).(*ConcertInsertable)
+		if !ok {
+			continue
+		}
+		if err := mergeConcert(tx, ci); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("couldn't merge %q: %v", ci.ExternalId, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	_ "database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -17,6 +18,39 @@ const (
 	InvalidPipeline string = "invalid interface (no InsertPipeline)"
 )
 
+// UnknownRejectReason groups the rows rejected by the extractors without a
+// RejectError.
+const UnknownRejectReason = "extraction failed"
+
+// RejectError is returned by the extractors for the rows that can't be loaded,
+// the rejected rows are counted by the reason.
+type RejectError struct {
+	Reason string
+	Err    error
+}
+
+func (e *RejectError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Reason, e.Err)
+}
+
+func (e *RejectError) Unwrap() error {
+	return e.Err
+}
+
+// Reject returns the RejectError with the formatted details.
+func Reject(reason string, format string, args ...any) error {
+	return &RejectError{Reason: reason, Err: fmt.Errorf(format, args...)}
+}
+
+// RejectReason returns the reason the row was rejected for.
+func RejectReason(err error) string {
+	var re *RejectError
+	if errors.As(err, &re) {
+		return re.Reason
+	}
+	return UnknownRejectReason
+}
+
 type DatasetFileMetadata struct {
 	Directory string
 	Type      string
@@ -107,6 +141,19 @@ func JoinTableFields(t *Table) string {
 
 }
 
+// UpsertSuffix turns an insert into an upsert, every field except the keys is
+// overwritten with the new value.
+func UpsertSuffix(t *Table, keys ...string) string {
+	updates := make([]string, 0, len(t.Fields))
+	for _, f := range t.Fields {
+		if slices.Contains(keys, f) {
+			continue
+		}
+		updates = append(updates, fmt.Sprintf("%v=values(%v)", f, f))
+	}
+	return fmt.Sprintf(" ON DUPLICATE KEY UPDATE %v", strings.Join(updates, ","))
+}
+
 func RebuildTable(db *sql.DB, table, engine string) error {
 	DatabaseLogger.Printf("Currently rebuilding table: %v\n", table)
 	_, err := db.Exec(fmt.Sprintf("ALTER TABLE %v ENGINE = %v", table, engine))
@@ -1,5 +1,12 @@
 package database
 
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
 var (
 	AllowedEvents map[string]bool = map[string]bool{
 		"like":       true,
@@ -8,9 +15,10 @@ var (
 		"unplaylist": true,
 	}
 	AllowedTypes map[string]bool = map[string]bool{
-		"book":  true,
-		"tv":    true,
-		"movie": true,
+		"book":    true,
+		"tv":      true,
+		"movie":   true,
+		"concert": true,
 	}
 	OppositeEvents map[string]string = map[string]string{
 		"like":       "dislike",
@@ -57,3 +65,87 @@ func (u *UserEventPushRequest) ValidateFields() bool {
 	}
 	return true
 }
+
+// UserLibrary is the portable form of the user's library. Events hold the full
+// history, Collections hold the items that are currently liked or playlisted.
+type UserLibrary struct {
+	Events      []Event            `json:"events"`
+	Collections map[string][]Event `json:"collections"`
+}
+
+// UnmatchedRow describes an imported row that couldn't be mapped to the catalog.
+type UnmatchedRow struct {
+	Line   int    `json:"line"`
+	Title  string `json:"title"`
+	Reason string `json:"reason"`
+}
+
+type UserLibraryImportResponse struct {
+	Imported  int            `json:"imported"`
+	Unmatched []UnmatchedRow `json:"unmatched"`
+}
+
+// CollapseEvents returns the current state of the library: for every item the
+// latest of the opposite events wins. Events must be sorted by timestamp.
+func CollapseEvents(events []Event) map[string][]Event {
+	latest := map[string]Event{}
+	for _, e := range events {
+		positive := e.Name
+		if e.Name == "dislike" || e.Name == "unplaylist" {
+			positive = OppositeEvents[e.Name]
+		}
+		latest[fmt.Sprintf("%v:%v:%v", positive, e.ItemType, e.ItemId)] = e
+	}
+
+	collections := map[string][]Event{"like": {}, "playlist": {}}
+	for _, e := range latest {
+		if _, ok := collections[e.Name]; ok {
+			collections[e.Name] = append(collections[e.Name], e)
+		}
+	}
+	for _, items := range collections {
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].Timestamp < items[j].Timestamp
+		})
+	}
+	return collections
+}
+
+// FetchUserIdByToken returns the owner of the session token, if the session is
+// still valid.
+func FetchUserIdByToken(db *sql.DB, token string) (uint64, error) {
+	var userId uint64
+	var isSessionValid bool
+	if err := db.QueryRow(`select user_id, check_if_session_is_valid(token)
+		from user_login_timestamps where token=?`, token).Scan(&userId,
+		&isSessionValid); err != nil {
+		return 0, fmt.Errorf("session not found, reason: %v", err)
+	}
+	if !isSessionValid {
+		return 0, fmt.Errorf("session expired")
+	}
+	return userId, nil
+}
+
+// FetchUserEvents returns the full event history of the user, from all the
+// sessions, sorted by time.
+func FetchUserEvents(db *sql.DB, userId uint64) ([]Event, error) {
+	rows, err := db.Query(`call pull_user_events(?)`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var event Event
+		var timestamp time.Time
+		if err := rows.Scan(&event.ItemId, &event.Name, &event.ItemType, &timestamp); err != nil {
+			DatabaseLogger.Printf("couldn't scan the event, reason: %v\n", err)
+			continue
+		}
+		event.Timestamp = timestamp.Unix()
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+)
+
+// UpdateImagesForMovies stores the posters and the backdrops of the movies
+// and the logos of their companies. Only the known images are written, the
+// datasets without them don't erase the ones fetched from TMDB.
+func UpdateImagesForMovies(db *sql.DB, chunkSize *int) func(data *Insertable) error {
+	return func(i *Insertable) error {
+		ip, ok := (*i).(*InsertPipeline)
+		if !ok {
+			return fmt.Errorf("invalid interface (not a InsertPipeline)")
+		}
+		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
+			if err := updateImagesChunk(db, chunk); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func updateImagesChunk(db *sql.DB, chunk []*Insertable) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, item := range chunk {
+		mi, ok := (*item).(*MovieInsertable)
+		if !ok {
+			continue
+		}
+		if mi.PosterPath != "" || mi.BackdropPath != "" {
+			if _, err := tx.Exec(`update movies set
+				poster_path=coalesce(?, poster_path),
+				backdrop_path=coalesce(?, backdrop_path), updated_at=updated_at
+				where tmdb_id=?`, nullableString(mi.PosterPath),
+				nullableString(mi.BackdropPath), mi.MovieId); err != nil {
+				return err
+			}
+		}
+		for _, pc := range mi.ProductionCompanies {
+			if pc.LogoPath == "" {
+				continue
+			}
+			if _, err := tx.Exec(`update companies set logo_path=? where ID=?`,
+				pc.LogoPath, pc.Id); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
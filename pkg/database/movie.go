@@ -3,7 +3,9 @@ package database
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"slices"
 	"strconv"
 	"strings"
@@ -145,6 +147,8 @@ func (k *Keywords) ConstructInsertQuery() string {
 
 type ProductionCompaniesInsertable struct {
 	IdName
+	LogoPath string `json:"-"`
+	LogoUrl  string `json:"logo_url,omitempty"`
 }
 
 func (pc *ProductionCompaniesInsertable) IsInsertable() (*Table, bool) {
@@ -324,6 +328,9 @@ type MovieInsertable struct {
 	TotalScore          uint64                          `json:"total_ratings"`
 	Cast                []CastMember                    `json:"cast"`
 	Crew                []CrewMember                    `json:"crew"`
+	// The TMDB image paths, see UpdateImagesForMovies.
+	PosterPath   string `json:"-"`
+	BackdropPath string `json:"-"`
 }
 
 func (mi *MovieInsertable) IsInsertable() (*Table, bool) {
@@ -347,6 +354,8 @@ func (mi *MovieInsertable) ConstructInsertQuery() string {
 type MovieSelectable struct {
 	Id uint64 `json:"id"`
 	MovieInsertable
+	PosterUrl   string `json:"poster_url,omitempty"`
+	BackdropUrl string `json:"backdrop_url,omitempty"`
 }
 
 func (mq *MovieSelectable) IsSelectable() (*Table, bool) {
@@ -457,6 +466,7 @@ func InsertIntoMoviesChunked(db *sql.DB, chunkSize *int) func(data *Insertable)
 		defer close(c)
 		c <- true
 
+		var loadErr error
 		var wg sync.WaitGroup
 		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
 			wg.Go(
@@ -494,18 +504,24 @@ func InsertIntoMoviesChunked(db *sql.DB, chunkSize *int) func(data *Insertable)
 						argFields = append(argFields, mi.TotalScore)
 					}
 
+					if len(queryFields) == 0 {
+						return
+					}
 					// here put insert statements
 					<-c
-					stmt := fmt.Sprintf("%v%v", query, strings.Join(queryFields, ","))
+					// re-ingested movies overwrite the old values
+					stmt := fmt.Sprintf("%v%v%v", query, strings.Join(queryFields, ","),
+						UpsertSuffix(t, "tmdb_id"))
 					err := InsertStmt(db, &stmt, &argFields)
 					if err != nil {
 						DatabaseLogger.Println(err)
+						loadErr = errors.Join(loadErr, err)
 					}
 					c <- true
 				})
 		}
 		wg.Wait()
-		return nil
+		return loadErr
 	}
 }
 
@@ -524,6 +540,7 @@ func InsertIntoLanguagesChunked(db *sql.DB, chunkSize *int) func(data *Insertabl
 		c := make(chan bool, 1)
 		defer close(c)
 		c <- true
+		var loadErr error
 		var wg sync.WaitGroup
 		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
 			wg.Go(
@@ -551,17 +568,21 @@ func InsertIntoLanguagesChunked(db *sql.DB, chunkSize *int) func(data *Insertabl
 							argFields = append(argFields, sl.Name)
 						}
 					}
+					if len(queryFields) == 0 {
+						return
+					}
 					<-c
 					stmt := fmt.Sprintf("%v%v", query, strings.Join(queryFields, ","))
 					err := InsertStmt(db, &stmt, &argFields)
 					if err != nil {
 						DatabaseLogger.Println(err)
+						loadErr = errors.Join(loadErr, err)
 					}
 					c <- true
 				})
 		}
 		wg.Wait()
-		return nil
+		return loadErr
 	}
 }
 
@@ -580,6 +601,7 @@ func InsertIntoKeywordsChunked(db *sql.DB, chunkSize *int) func(data *Insertable
 		c := make(chan bool, 1)
 		defer close(c)
 		c <- true
+		var loadErr error
 		var wg sync.WaitGroup
 		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
 			wg.Go(
@@ -609,17 +631,21 @@ func InsertIntoKeywordsChunked(db *sql.DB, chunkSize *int) func(data *Insertable
 						}
 					}
 
+					if len(queryFields) == 0 {
+						return
+					}
 					<-c
 					stmt := fmt.Sprintf("%v%v", query, strings.Join(queryFields, ","))
 					err := InsertStmt(db, &stmt, &argFields)
 					if err != nil {
 						DatabaseLogger.Println(err)
+						loadErr = errors.Join(loadErr, err)
 					}
 					c <- true
 				})
 		}
 		wg.Wait()
-		return nil
+		return loadErr
 	}
 }
 
@@ -637,6 +663,7 @@ func InsertIntoGenresChunked(db *sql.DB, chunkSize *int) func(data *Insertable)
 		c := make(chan bool, 1)
 		defer close(c)
 		c <- true
+		var loadErr error
 		var wg sync.WaitGroup
 
 		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
@@ -668,18 +695,22 @@ func InsertIntoGenresChunked(db *sql.DB, chunkSize *int) func(data *Insertable)
 						}
 					}
 
+					if len(queryFields) == 0 {
+						return
+					}
 					<-c
 					stmt := fmt.Sprintf("%v%v", query, strings.Join(queryFields, ","))
 					err := InsertStmt(db, &stmt, &argFields)
 					if err != nil {
 						DatabaseLogger.Println(err)
+						loadErr = errors.Join(loadErr, err)
 					}
 					c <- true
 
 				})
 		}
 		wg.Wait()
-		return nil
+		return loadErr
 	}
 }
 
@@ -697,6 +728,7 @@ func InsertIntoCountriesChunked(db *sql.DB, chunkSize *int) func(data *Insertabl
 		c := make(chan bool, 1)
 		defer close(c)
 		c <- true
+		var loadErr error
 		var wg sync.WaitGroup
 		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
 			wg.Go(
@@ -726,17 +758,21 @@ func InsertIntoCountriesChunked(db *sql.DB, chunkSize *int) func(data *Insertabl
 						}
 					}
 
+					if len(queryFields) == 0 {
+						return
+					}
 					<-c
 					stmt := fmt.Sprintf("%v%v", query, strings.Join(queryFields, ","))
 					err := InsertStmt(db, &stmt, &argFields)
 					if err != nil {
 						DatabaseLogger.Println(err)
+						loadErr = errors.Join(loadErr, err)
 					}
 					c <- true
 				})
 		}
 		wg.Wait()
-		return nil
+		return loadErr
 	}
 }
 
@@ -755,6 +791,7 @@ func InsertIntoCompaniesChunked(db *sql.DB, chunkSize *int) func(data *Insertabl
 		c := make(chan bool, 1)
 		defer close(c)
 		c <- true
+		var loadErr error
 		var wg sync.WaitGroup
 		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
 			wg.Go(
@@ -783,18 +820,22 @@ func InsertIntoCompaniesChunked(db *sql.DB, chunkSize *int) func(data *Insertabl
 							argFields = append(argFields, pc.Name)
 						}
 					}
+					if len(queryFields) == 0 {
+						return
+					}
 					<-c
 					stmt := fmt.Sprintf("%v%v", query, strings.Join(queryFields, ","))
 					err := InsertStmt(db, &stmt, &argFields)
 					if err != nil {
 						DatabaseLogger.Println(err)
+						loadErr = errors.Join(loadErr, err)
 					}
 					c <- true
 
 				})
 		}
 		wg.Wait()
-		return nil
+		return loadErr
 	}
 }
 
@@ -808,6 +849,7 @@ func InsertIntoMovie2LanguagesChunked(db *sql.DB, chunkSize *int) func(data *Ins
 		c := make(chan bool, 1)
 		defer close(c)
 		c <- true
+		var loadErr error
 		var wg sync.WaitGroup
 		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
 			wg.Go(
@@ -828,17 +870,21 @@ func InsertIntoMovie2LanguagesChunked(db *sql.DB, chunkSize *int) func(data *Ins
 							argFields = append(argFields, sl.Encoding)
 						}
 					}
+					if len(queryFields) == 0 {
+						return
+					}
 					<-c
 					stmt := fmt.Sprintf("%v%v", query, strings.Join(queryFields, ","))
 					err := InsertStmt(db, &stmt, &argFields)
 					if err != nil {
 						DatabaseLogger.Println(err)
+						loadErr = errors.Join(loadErr, err)
 					}
 					c <- true
 				})
 		}
 		wg.Wait()
-		return nil
+		return loadErr
 	}
 }
 
@@ -853,6 +899,7 @@ func InsertIntoMovie2KeywordsChunked(db *sql.DB, chunkSize *int) func(data *Inse
 		defer close(c)
 		c <- true
 
+		var loadErr error
 		var wg sync.WaitGroup
 		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
 			wg.Go(
@@ -873,17 +920,21 @@ func InsertIntoMovie2KeywordsChunked(db *sql.DB, chunkSize *int) func(data *Inse
 							argFields = append(argFields, k.Id)
 						}
 					}
+					if len(queryFields) == 0 {
+						return
+					}
 					<-c
 					stmt := fmt.Sprintf("%v%v", query, strings.Join(queryFields, ","))
 					err := InsertStmt(db, &stmt, &argFields)
 					if err != nil {
 						DatabaseLogger.Println(err)
+						loadErr = errors.Join(loadErr, err)
 					}
 					c <- true
 				})
 		}
 		wg.Wait()
-		return nil
+		return loadErr
 	}
 }
 
@@ -897,6 +948,7 @@ func InsertIntoMovie2GenresChunked(db *sql.DB, chunkSize *int) func(data *Insert
 		c := make(chan bool, 1)
 		defer close(c)
 		c <- true
+		var loadErr error
 		var wg sync.WaitGroup
 		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
 			wg.Go(
@@ -917,17 +969,21 @@ func InsertIntoMovie2GenresChunked(db *sql.DB, chunkSize *int) func(data *Insert
 							argFields = append(argFields, g.Id)
 						}
 					}
+					if len(queryFields) == 0 {
+						return
+					}
 					<-c
 					stmt := fmt.Sprintf("%v%v", query, strings.Join(queryFields, ","))
 					err := InsertStmt(db, &stmt, &argFields)
 					if err != nil {
 						DatabaseLogger.Println(err)
+						loadErr = errors.Join(loadErr, err)
 					}
 					c <- true
 				})
 		}
 		wg.Wait()
-		return nil
+		return loadErr
 	}
 }
 
@@ -942,6 +998,7 @@ func InsertIntoMovie2CountriesChunked(db *sql.DB, chunkSize *int) func(data *Ins
 		c := make(chan bool, 1)
 		defer close(c)
 		c <- true
+		var loadErr error
 		var wg sync.WaitGroup
 		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
 			wg.Go(
@@ -962,17 +1019,21 @@ func InsertIntoMovie2CountriesChunked(db *sql.DB, chunkSize *int) func(data *Ins
 							argFields = append(argFields, pc.Encoding)
 						}
 					}
+					if len(queryFields) == 0 {
+						return
+					}
 					<-c
 					stmt := fmt.Sprintf("%v%v", query, strings.Join(queryFields, ","))
 					err := InsertStmt(db, &stmt, &argFields)
 					if err != nil {
 						DatabaseLogger.Println(err)
+						loadErr = errors.Join(loadErr, err)
 					}
 					c <- true
 				})
 		}
 		wg.Wait()
-		return nil
+		return loadErr
 	}
 }
 
@@ -987,6 +1048,7 @@ func InsertIntoMovie2CompaniesChunked(db *sql.DB, chunkSize *int) func(data *Ins
 		c := make(chan bool, 1)
 		defer close(c)
 		c <- true
+		var loadErr error
 		var wg sync.WaitGroup
 		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
 			wg.Go(
@@ -1007,17 +1069,21 @@ func InsertIntoMovie2CompaniesChunked(db *sql.DB, chunkSize *int) func(data *Ins
 							argFields = append(argFields, pc.Id)
 						}
 					}
+					if len(queryFields) == 0 {
+						return
+					}
 					<-c
 					stmt := fmt.Sprintf("%v%v", query, strings.Join(queryFields, ","))
 					err := InsertStmt(db, &stmt, &argFields)
 					if err != nil {
 						DatabaseLogger.Println(err)
+						loadErr = errors.Join(loadErr, err)
 					}
 					c <- true
 				})
 		}
 		wg.Wait()
-		return nil
+		return loadErr
 	}
 }
 
@@ -1032,6 +1098,7 @@ func UpdateLanguageForMovies(db *sql.DB, chunkSize *int) func(data *Insertable)
 		c := make(chan bool, 1)
 		defer close(c)
 		c <- true
+		var loadErr error
 		var wg sync.WaitGroup
 		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
 			wg.Go(
@@ -1052,76 +1119,158 @@ func UpdateLanguageForMovies(db *sql.DB, chunkSize *int) func(data *Insertable)
 							argFields = append(argFields, pc.Id)
 						}
 					}
+					if len(queryFields) == 0 {
+						return
+					}
 					<-c
 					stmt := fmt.Sprintf("%v%v", query, strings.Join(queryFields, ","))
 					err := InsertStmt(db, &stmt, &argFields)
 					if err != nil {
 						DatabaseLogger.Println(err)
+						loadErr = errors.Join(loadErr, err)
 					}
 					c <- true
 				})
 		}
 		wg.Wait()
-		return nil
+		return loadErr
 	}
 }
 
 func TmdbMapFromStream(stream *[]string, data *Insertable) error {
 	if len(*stream) != TmdbDataLength {
-		return fmt.Errorf("invalid length (%v): expected (%v)\n",
-			len(*stream), TmdbDataLength)
+		return Reject("invalid length", "%v fields, expected %v", len(*stream),
+			TmdbDataLength)
 	}
 
 	s := *stream
+	if s[StreamTmdbIndices["MovieId"]] == "id" {
+		return ErrHeaderRow
+	}
 	target := &MovieInsertable{}
 
 	if len(s[StreamTmdbIndices["Title"]]) <= 0 {
-		return fmt.Errorf("%v is incorrect title", s[6])
+		return Reject("missing title", "movie %v has no title", s[StreamTmdbIndices["MovieId"]])
 	}
 
 	if len(s[StreamTmdbIndices["OriginalLanguage"]]) != 2 {
-		return fmt.Errorf("%v is incorrect language", s[5])
+		return Reject("invalid language", "%v is incorrect language",
+			s[StreamTmdbIndices["OriginalLanguage"]])
 	}
 
-	target.Budget, _ = strconv.ParseUint(s[StreamTmdbIndices["Budget"]], 10, 64)
-	_ = json.Unmarshal([]byte(s[StreamTmdbIndices["Genre"]]), &target.Genres)
-	target.MovieId, _ = strconv.ParseUint(s[StreamTmdbIndices["MovieId"]], 10, 64)
-	_ = json.Unmarshal([]byte(s[StreamTmdbIndices["Keywords"]]), &target.Keywords)
+	var err error
+	if target.MovieId, err = strconv.ParseUint(s[StreamTmdbIndices["MovieId"]], 10, 64); err != nil {
+		return Reject("invalid id", "%v is incorrect id", s[StreamTmdbIndices["MovieId"]])
+	}
 	target.OriginalLanguage = s[StreamTmdbIndices["OriginalLanguage"]]
 	target.Title = s[StreamTmdbIndices["Title"]]
 	target.Overview = s[StreamTmdbIndices["Overview"]]
-	target.Popularity, _ = strconv.ParseFloat(s[StreamTmdbIndices["Popularity"]], 64)
-	_ = json.Unmarshal([]byte(s[StreamTmdbIndices["ProductionCompanies"]]), &target.ProductionCompanies)
-	_ = json.Unmarshal([]byte(s[StreamTmdbIndices["ProductionCountries"]]), &target.ProductionCountries)
-	target.ReleaseDate, _ = time.Parse("2006-01-02", s[StreamTmdbIndices["ReleaseDate"]])
-	target.Revenue, _ = strconv.ParseInt(s[StreamTmdbIndices["Revenue"]], 10, 64)
-	target.Runtime, _ = strconv.ParseInt(s[StreamTmdbIndices["Runtime"]], 10, 64)
-	_ = json.Unmarshal([]byte(s[StreamTmdbIndices["SpokenLanguages"]]), &target.SpokenLanguages)
 	target.Status = s[StreamTmdbIndices["Status"]]
 	target.Tagline = s[StreamTmdbIndices["Tagline"]]
-	target.AverageScore, _ = strconv.ParseFloat(s[StreamTmdbIndices["AverageScore"]], 64)
-	target.TotalScore, _ = strconv.ParseUint(s[StreamTmdbIndices["TotalScore"]], 10, 64)
+	// the empty fields are left zero, the malformed ones reject the row
+	if err := errors.Join(
+		parseField("budget", s[StreamTmdbIndices["Budget"]], &target.Budget, parseUint),
+		parseField("popularity", s[StreamTmdbIndices["Popularity"]], &target.Popularity, parseFloat),
+		parseField("release_date", s[StreamTmdbIndices["ReleaseDate"]], &target.ReleaseDate, parseDate),
+		parseField("revenue", s[StreamTmdbIndices["Revenue"]], &target.Revenue, parseInt),
+		parseField("runtime", s[StreamTmdbIndices["Runtime"]], &target.Runtime, parseInt),
+		parseField("vote_average", s[StreamTmdbIndices["AverageScore"]], &target.AverageScore, parseFloat),
+		parseField("vote_count", s[StreamTmdbIndices["TotalScore"]], &target.TotalScore, parseUint),
+		jsonField("genres", s[StreamTmdbIndices["Genre"]], &target.Genres),
+		jsonField("keywords", s[StreamTmdbIndices["Keywords"]], &target.Keywords),
+		jsonField("production_companies", s[StreamTmdbIndices["ProductionCompanies"]], &target.ProductionCompanies),
+		jsonField("production_countries", s[StreamTmdbIndices["ProductionCountries"]], &target.ProductionCountries),
+		jsonField("spoken_languages", s[StreamTmdbIndices["SpokenLanguages"]], &target.SpokenLanguages),
+	); err != nil {
+		return err
+	}
 	*data = target
 	return nil
 }
 
 func TmdbMapCreditsFromStream(stream *[]string, data *Insertable) error {
 	if len(*stream) != TmdbCreditsDataLength {
-		return fmt.Errorf("invalid length (%v): expected (%v)\n",
-			len(*stream), TmdbCreditsDataLength)
+		return Reject("invalid length", "%v fields, expected %v", len(*stream),
+			TmdbCreditsDataLength)
 	}
 
 	tgt := &CastCrewMetadata{}
 	s := *stream
+	if s[TmdbCreditsIndices["MovieId"]] == "movie_id" {
+		return ErrHeaderRow
+	}
 
-	tgt.MovieId, _ = strconv.ParseUint(s[TmdbCreditsIndices["MovieId"]], 10, 64)
-	json.Unmarshal([]byte(s[TmdbCreditsIndices["Cast"]]), &tgt.Cast)
-	json.Unmarshal([]byte(s[TmdbCreditsIndices["Crew"]]), &tgt.Crew)
+	var err error
+	if tgt.MovieId, err = strconv.ParseUint(s[TmdbCreditsIndices["MovieId"]], 10, 64); err != nil {
+		return Reject("invalid id", "%v is incorrect id", s[TmdbCreditsIndices["MovieId"]])
+	}
+	if err := errors.Join(
+		jsonField("cast", s[TmdbCreditsIndices["Cast"]], &tgt.Cast),
+		jsonField("crew", s[TmdbCreditsIndices["Crew"]], &tgt.Crew),
+	); err != nil {
+		return err
+	}
 
 	*data = tgt
 	return nil
 }
 
+// parseField parses the field into the target, unless it is empty.
+func parseField[T any](name, field string, target *T, parse func(string) (T, error)) error {
+	if field == "" {
+		return nil
+	}
+	v, err := parse(field)
+	if err != nil {
+		return Reject("invalid "+name, "%q is incorrect %v", Truncate(field, 64), name)
+	}
+	*target = v
+	return nil
+}
+
+// jsonField unmarshals the field into the target, unless it is empty.
+func jsonField(name, field string, target any) error {
+	if field == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(field), target); err != nil {
+		return Reject("invalid "+name, "%v", err)
+	}
+	return nil
+}
+
+// parseUint also accepts the numbers written as floats, e.g. 81.0.
+func parseUint(s string) (uint64, error) {
+	if v, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return v, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, fmt.Errorf("%v is not a whole number", s)
+	}
+	return uint64(f), nil
+}
+
+// parseInt also accepts the numbers written as floats, e.g. 81.0.
+func parseInt(s string) (int64, error) {
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, fmt.Errorf("%v is not a whole number", s)
+	}
+	return int64(f), nil
+}
+
+func parseFloat(s string) (float64, error) {
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseDate(s string) (time.Time, error) {
+	return time.Parse("2006-01-02", s)
+}
+
 func TmdbJoinBoth(tmdb, tmdbCredits, transformed *[]*Insertable) error {
 	mappedIds := map[uint64]*CastCrewMetadata{}
 
@@ -1138,8 +1287,10 @@ func TmdbJoinBoth(tmdb, tmdbCredits, transformed *[]*Insertable) error {
 		if !ok {
 			continue
 		}
-		source.Cast = mappedIds[source.MovieId].Cast
-		source.Crew = mappedIds[source.MovieId].Crew
+		if ccm, ok := mappedIds[source.MovieId]; ok {
+			source.Cast = ccm.Cast
+			source.Crew = ccm.Crew
+		}
 		*mme = source
 		*transformed = append(*transformed, mme)
 	}
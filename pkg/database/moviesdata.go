@@ -0,0 +1,366 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Extractors for The Movies Dataset (movies-data). Its files are wider than
+// the TMDB 5000 ones and the nested columns are Python literals, not JSON, so
+// the columns are looked up by the header.
+
+// ErrHeaderRow is returned by the header driven extractors for the header.
+var ErrHeaderRow error = errors.New("header row")
+
+// MovieStatuses are the values of `movies.status`.
+var MovieStatuses map[string]bool = map[string]bool{
+	"Released":        true,
+	"Rumored":         true,
+	"Post Production": true,
+}
+
+// MovieKeywordsMetadata is a row of keywords.csv, it is joined into the movies.
+type MovieKeywordsMetadata struct {
+	MovieId  uint64
+	Keywords []Keywords
+}
+
+func (mkm *MovieKeywordsMetadata) IsInsertable() (*Table, bool) {
+	return nil, false
+}
+
+func (mkm *MovieKeywordsMetadata) ConstructInsertQuery() string {
+	return ""
+}
+
+// LinkInsertable is a row of links.csv, it maps a MovieLens movie to TMDB.
+type LinkInsertable struct {
+	MovieLensId uint64
+	ImdbId      string
+	TmdbId      uint64
+}
+
+func (li *LinkInsertable) IsInsertable() (*Table, bool) {
+	return nil, false
+}
+
+func (li *LinkInsertable) ConstructInsertQuery() string {
+	return ""
+}
+
+// RatingInsertable is a row of ratings.csv, MovieLens ids are not mapped yet.
+type RatingInsertable struct {
+	MovieLensUserId uint64
+	MovieLensId     uint64
+	Rating          float64
+	RatedAt         time.Time
+}
+
+func (ri *RatingInsertable) IsInsertable() (*Table, bool) {
+	return nil, false
+}
+
+func (ri *RatingInsertable) ConstructInsertQuery() string {
+	return ""
+}
+
+// HeaderIndex maps the lower-cased column names to their positions.
+func HeaderIndex(header []string) map[string]int {
+	index := make(map[string]int, len(header))
+	for i, column := range header {
+		index[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	return index
+}
+
+// headerColumns returns a getter of the named columns, the columns missing in
+// the header or in the row are empty.
+func headerColumns(header []string, required ...string) (func(s []string, column string) string, error) {
+	index := HeaderIndex(header)
+	for _, column := range required {
+		if _, ok := index[column]; !ok {
+			return nil, fmt.Errorf("missing column %v", column)
+		}
+	}
+	return func(s []string, column string) string {
+		i, ok := index[column]
+		if !ok || i >= len(s) {
+			return ""
+		}
+		return strings.TrimSpace(s[i])
+	}, nil
+}
+
+// imagePath returns the TMDB image path, e.g. `/abc.jpg`, if it fits the
+// column.
+func imagePath(s string) string {
+	if !strings.HasPrefix(s, "/") || len(s) > 64 {
+		return ""
+	}
+	return s
+}
+
+// Truncate cuts the string to n characters, so it fits the column.
+func Truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+// PyLiteralToJson converts a Python literal, as written by `repr`, into JSON.
+func PyLiteralToJson(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '\'' || ch == '"':
+			b.WriteByte('"')
+			for i++; i < len(s) && s[i] != ch; i++ {
+				switch {
+				case s[i] == '\\' && i+1 < len(s):
+					i++
+					switch s[i] {
+					case '\'':
+						b.WriteByte('\'')
+					case 'x':
+						b.WriteString(`\u00`)
+					default:
+						b.WriteByte('\\')
+						b.WriteByte(s[i])
+					}
+				case s[i] == '"':
+					b.WriteString(`\"`)
+				default:
+					b.WriteByte(s[i])
+				}
+			}
+			b.WriteByte('"')
+		case strings.HasPrefix(s[i:], "True"):
+			b.WriteString("true")
+			i += len("True") - 1
+		case strings.HasPrefix(s[i:], "False"):
+			b.WriteString("false")
+			i += len("False") - 1
+		case strings.HasPrefix(s[i:], "None"):
+			b.WriteString("null")
+			i += len("None") - 1
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+func unmarshalPyLiteral(s string, v any) error {
+	if s == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(PyLiteralToJson(s)), v)
+}
+
+// pyLiteralField is jsonField for the Python literals.
+func pyLiteralField(name, field string, target any) error {
+	if err := unmarshalPyLiteral(field, target); err != nil {
+		return Reject("invalid "+name, "%v", err)
+	}
+	return nil
+}
+
+// MoviesDataFromStream returns the extractor of movies_metadata.csv.
+func MoviesDataFromStream(header []string) (func(stream *[]string, data *Insertable) error, error) {
+	col, err := headerColumns(header, "id", "title")
+	if err != nil {
+		return nil, err
+	}
+	return func(stream *[]string, data *Insertable) error {
+		s := *stream
+		if slices.Equal(s, header) {
+			return ErrHeaderRow
+		}
+		movieId, err := strconv.ParseUint(col(s, "id"), 10, 64)
+		if err != nil {
+			return Reject("invalid id", "%v is incorrect id", col(s, "id"))
+		}
+		if col(s, "title") == "" {
+			return Reject("missing title", "movie %v has no title", movieId)
+		}
+		if col(s, "adult") == "True" {
+			return Reject("adult only", "movie %v is for adults only", movieId)
+		}
+
+		target := &MovieInsertable{MovieId: movieId}
+		target.Title = Truncate(col(s, "title"), 256)
+		if language := col(s, "original_language"); len(language) == 2 {
+			target.OriginalLanguage = language
+		}
+		target.Overview = Truncate(col(s, "overview"), 2048)
+		target.Status = col(s, "status")
+		if !MovieStatuses[target.Status] {
+			target.Status = "N/A"
+		}
+		target.Tagline = Truncate(col(s, "tagline"), 128)
+		target.PosterPath = imagePath(col(s, "poster_path"))
+		// the empty fields are left zero, the malformed ones reject the row
+		if err := errors.Join(
+			parseField("budget", col(s, "budget"), &target.Budget, parseUint),
+			parseField("popularity", col(s, "popularity"), &target.Popularity, parseFloat),
+			parseField("release_date", col(s, "release_date"), &target.ReleaseDate, parseDate),
+			parseField("revenue", col(s, "revenue"), &target.Revenue, parseInt),
+			parseField("runtime", col(s, "runtime"), &target.Runtime, parseInt),
+			parseField("vote_average", col(s, "vote_average"), &target.AverageScore, parseFloat),
+			parseField("vote_count", col(s, "vote_count"), &target.TotalScore, parseUint),
+			pyLiteralField("genres", col(s, "genres"), &target.Genres),
+			pyLiteralField("production_companies", col(s, "production_companies"), &target.ProductionCompanies),
+			pyLiteralField("production_countries", col(s, "production_countries"), &target.ProductionCountries),
+			pyLiteralField("spoken_languages", col(s, "spoken_languages"), &target.SpokenLanguages),
+		); err != nil {
+			return err
+		}
+		*data = target
+		return nil
+	}, nil
+}
+
+// MoviesDataKeywordsFromStream returns the extractor of keywords.csv.
+func MoviesDataKeywordsFromStream(header []string) (func(stream *[]string, data *Insertable) error, error) {
+	col, err := headerColumns(header, "id", "keywords")
+	if err != nil {
+		return nil, err
+	}
+	return func(stream *[]string, data *Insertable) error {
+		var err error
+		s := *stream
+		if slices.Equal(s, header) {
+			return ErrHeaderRow
+		}
+		tgt := &MovieKeywordsMetadata{}
+		tgt.MovieId, err = strconv.ParseUint(col(s, "id"), 10, 64)
+		if err != nil {
+			return Reject("invalid id", "%v is incorrect id", col(s, "id"))
+		}
+		if err := pyLiteralField("keywords", col(s, "keywords"), &tgt.Keywords); err != nil {
+			return err
+		}
+		*data = tgt
+		return nil
+	}, nil
+}
+
+// MoviesDataCreditsFromStream returns the extractor of credits.csv, the result
+// is joined with TmdbJoinBoth.
+func MoviesDataCreditsFromStream(header []string) (func(stream *[]string, data *Insertable) error, error) {
+	col, err := headerColumns(header, "id", "cast", "crew")
+	if err != nil {
+		return nil, err
+	}
+	return func(stream *[]string, data *Insertable) error {
+		var err error
+		s := *stream
+		if slices.Equal(s, header) {
+			return ErrHeaderRow
+		}
+		tgt := &CastCrewMetadata{}
+		tgt.MovieId, err = strconv.ParseUint(col(s, "id"), 10, 64)
+		if err != nil {
+			return Reject("invalid id", "%v is incorrect id", col(s, "id"))
+		}
+		if err := errors.Join(
+			pyLiteralField("cast", col(s, "cast"), &tgt.Cast),
+			pyLiteralField("crew", col(s, "crew"), &tgt.Crew),
+		); err != nil {
+			return err
+		}
+		*data = tgt
+		return nil
+	}, nil
+}
+
+// LinksFromStream returns the extractor of links.csv, rows without a TMDB id
+// are rejected.
+func LinksFromStream(header []string) (func(stream *[]string, data *Insertable) error, error) {
+	col, err := headerColumns(header, "movieid", "tmdbid")
+	if err != nil {
+		return nil, err
+	}
+	return func(stream *[]string, data *Insertable) error {
+		var err error
+		s := *stream
+		if slices.Equal(s, header) {
+			return ErrHeaderRow
+		}
+		tgt := &LinkInsertable{ImdbId: col(s, "imdbid")}
+		if tgt.MovieLensId, err = strconv.ParseUint(col(s, "movieid"), 10, 64); err != nil {
+			return fmt.Errorf("%v is incorrect movieId", col(s, "movieid"))
+		}
+		// some ids are written as floats, e.g. 862.0
+		tmdbId, err := strconv.ParseFloat(col(s, "tmdbid"), 64)
+		if err != nil || tmdbId <= 0 {
+			return fmt.Errorf("movie %v has no tmdbId", tgt.MovieLensId)
+		}
+		tgt.TmdbId = uint64(tmdbId)
+		*data = tgt
+		return nil
+	}, nil
+}
+
+// RatingsFromStream returns the extractor of ratings.csv.
+func RatingsFromStream(header []string) (func(stream *[]string, data *Insertable) error, error) {
+	col, err := headerColumns(header, "userid", "movieid", "rating")
+	if err != nil {
+		return nil, err
+	}
+	return func(stream *[]string, data *Insertable) error {
+		var err error
+		s := *stream
+		if slices.Equal(s, header) {
+			return ErrHeaderRow
+		}
+		tgt := &RatingInsertable{}
+		if tgt.MovieLensUserId, err = strconv.ParseUint(col(s, "userid"), 10, 64); err != nil {
+			return fmt.Errorf("%v is incorrect userId", col(s, "userid"))
+		}
+		if tgt.MovieLensId, err = strconv.ParseUint(col(s, "movieid"), 10, 64); err != nil {
+			return fmt.Errorf("%v is incorrect movieId", col(s, "movieid"))
+		}
+		if tgt.Rating, err = strconv.ParseFloat(col(s, "rating"), 64); err != nil {
+			return fmt.Errorf("%v is incorrect rating", col(s, "rating"))
+		}
+		if ts, err := strconv.ParseInt(col(s, "timestamp"), 10, 64); err == nil {
+			tgt.RatedAt = time.Unix(ts, 0).UTC()
+		}
+		*data = tgt
+		return nil
+	}, nil
+}
+
+// MoviesDataJoinKeywords puts the keywords into the movies.
+func MoviesDataJoinKeywords(movies, keywords, transformed *[]*Insertable) error {
+	mappedIds := map[uint64][]Keywords{}
+	for _, mkm := range *keywords {
+		target, ok := (*mkm).(*MovieKeywordsMetadata)
+		if !ok {
+			continue
+		}
+		mappedIds[target.MovieId] = target.Keywords
+	}
+
+	for _, mme := range *movies {
+		source, ok := (*mme).(*MovieInsertable)
+		if !ok {
+			continue
+		}
+		if kws, ok := mappedIds[source.MovieId]; ok {
+			source.Keywords = kws
+		}
+		*transformed = append(*transformed, mme)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	NSeedInteractionFields int = 6
+)
+
+// SeedInteractionInsertable is an anonymous interaction imported from a
+// dataset, e.g. a MovieLens rating mapped to a TMDB movie.
+type SeedInteractionInsertable struct {
+	SeedUser  uint64
+	Event     string
+	Type      string
+	ItemId    uint64
+	Rating    float64
+	Timestamp time.Time
+}
+
+func (sii *SeedInteractionInsertable) IsInsertable() (*Table, bool) {
+	return NewTable(
+		"seed_interactions",
+		[]string{"seed_user", "event", "type", "item_id", "rating", "timestamp"},
+	), true
+}
+
+func (sii *SeedInteractionInsertable) ConstructInsertQuery() string {
+	t, ok := sii.IsInsertable()
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("INSERT INTO %v%v VALUES ", t.Name, JoinTableFields(t))
+}
+
+// MapRatingsThroughLinks turns the ratings into seed interactions with TMDB
+// ids. A rating of at least `like` is a like, at most `dislike` a dislike, the
+// ones in between and the unlinked movies are dropped.
+func MapRatingsThroughLinks(like, dislike float64) func(ratings, links, transformed *[]*Insertable) error {
+	return func(ratings, links, transformed *[]*Insertable) error {
+		mappedIds := map[uint64]uint64{}
+		for _, li := range *links {
+			target, ok := (*li).(*LinkInsertable)
+			if !ok {
+				continue
+			}
+			mappedIds[target.MovieLensId] = target.TmdbId
+		}
+
+		for _, ri := range *ratings {
+			source, ok := (*ri).(*RatingInsertable)
+			if !ok {
+				continue
+			}
+			tmdbId, ok := mappedIds[source.MovieLensId]
+			if !ok {
+				continue
+			}
+			var event string
+			switch {
+			case source.Rating >= like:
+				event = "like"
+			case source.Rating <= dislike:
+				event = "dislike"
+			default:
+				continue
+			}
+			var target Insertable = &SeedInteractionInsertable{
+				SeedUser:  source.MovieLensUserId,
+				Event:     event,
+				Type:      "movie",
+				ItemId:    tmdbId,
+				Rating:    source.Rating,
+				Timestamp: source.RatedAt,
+			}
+			*transformed = append(*transformed, &target)
+		}
+		return nil
+	}
+}
+
+func InsertIntoSeedInteractionsChunked(db *sql.DB, chunkSize *int) func(data *Insertable) error {
+	return func(i *Insertable) error {
+		ip, ok := (*i).(*InsertPipeline)
+		if !ok {
+			return fmt.Errorf("invalid interface (not a InsertPipeline)")
+		}
+		// prevent deadlocks
+		c := make(chan bool, 1)
+		defer close(c)
+		c <- true
+
+		var loadErr error
+		var wg sync.WaitGroup
+		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
+			wg.Go(
+				func() {
+					template := SeedInteractionInsertable{}
+					t, _ := template.IsInsertable()
+					query := template.ConstructInsertQuery()
+					var queryFields []string = make([]string, 0, *chunkSize)
+					var argFields []any = make([]any, 0, NSeedInteractionFields*(*chunkSize))
+					for _, item := range chunk {
+						sii, ok := (*item).(*SeedInteractionInsertable)
+						if !ok {
+							continue
+						}
+						queryFields = append(queryFields, t.QueryField)
+						argFields = append(argFields, sii.SeedUser)
+						argFields = append(argFields, sii.Event)
+						argFields = append(argFields, sii.Type)
+						argFields = append(argFields, sii.ItemId)
+						argFields = append(argFields, sii.Rating)
+						argFields = append(argFields, nullableTime(sii.Timestamp))
+					}
+
+					if len(queryFields) == 0 {
+						return
+					}
+					<-c
+					// a user rated a movie again, the latest rating wins
+					stmt := fmt.Sprintf("%v%v%v", query, strings.Join(queryFields, ","),
+						UpsertSuffix(t, "seed_user", "type", "item_id"))
+					err := InsertStmt(db, &stmt, &argFields)
+					if err != nil {
+						DatabaseLogger.Println(err)
+						loadErr = errors.Join(loadErr, err)
+					}
+					c <- true
+				})
+		}
+		wg.Wait()
+		return loadErr
+	}
+}
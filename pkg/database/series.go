@@ -0,0 +1,260 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// SeriesStatuses are the values of `series.status`.
+var SeriesStatuses map[string]bool = map[string]bool{
+	"Returning Series": true,
+	"Planned":          true,
+	"In Production":    true,
+	"Ended":            true,
+	"Canceled":         true,
+	"Pilot":            true,
+}
+
+type NetworkInsertable struct {
+	IdName
+	Country string `json:"country"`
+}
+
+type SeasonInsertable struct {
+	SeasonNumber uint64     `json:"season_number"`
+	Name         string     `json:"name"`
+	Overview     string     `json:"overview"`
+	AirDate      *time.Time `json:"air_date"`
+	EpisodeCount uint64     `json:"episode_count"`
+}
+
+// SeriesInsertable is a TV series with its seasons, networks and genres.
+type SeriesInsertable struct {
+	SeriesId         uint64              `json:"series_id"`
+	OriginalLanguage string              `json:"original_language"`
+	Title            string              `json:"title"`
+	OriginalTitle    string              `json:"original_title"`
+	Overview         string              `json:"overview"`
+	Popularity       float64             `json:"popularity"`
+	FirstAirDate     *time.Time          `json:"first_air_date"`
+	LastAirDate      *time.Time          `json:"last_air_date"`
+	NumberOfSeasons  uint64              `json:"number_of_seasons"`
+	NumberOfEpisodes uint64              `json:"number_of_episodes"`
+	EpisodeRuntime   *int64              `json:"episode_runtime"`
+	Status           string              `json:"status"`
+	InProduction     bool                `json:"in_production"`
+	Tagline          string              `json:"tagline"`
+	AverageScore     float64             `json:"rating"`
+	TotalScore       uint64              `json:"total_ratings"`
+	Genres           []Genre             `json:"genres"`
+	Networks         []NetworkInsertable `json:"networks"`
+	Seasons          []SeasonInsertable  `json:"seasons"`
+	PosterPath       string              `json:"-"`
+	BackdropPath     string              `json:"-"`
+}
+
+func (si *SeriesInsertable) IsInsertable() (*Table, bool) {
+	return NewTable(
+		"series",
+		[]string{"tmdb_id", "language", "title", "original_title", "overview",
+			"popularity", "first_air_date", "last_air_date", "number_of_seasons",
+			"number_of_episodes", "episode_runtime", "status", "in_production",
+			"tagline", "rating", "total_ratings", "poster_path", "backdrop_path"},
+	), true
+}
+
+func (si *SeriesInsertable) ConstructInsertQuery() string {
+	t, ok := si.IsInsertable()
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("INSERT INTO %v%v VALUES ", t.Name, JoinTableFields(t))
+}
+
+type SeriesSelectable struct {
+	Id uint64 `json:"id"`
+	SeriesInsertable
+	PosterUrl   string `json:"poster_url,omitempty"`
+	BackdropUrl string `json:"backdrop_url,omitempty"`
+}
+
+func (ss *SeriesSelectable) IsSelectable() (*Table, bool) {
+	return NewTable(
+		"series",
+		[]string{"ID", "tmdb_id", "language", "title", "original_title",
+			"overview", "popularity", "first_air_date", "last_air_date",
+			"number_of_seasons", "number_of_episodes", "episode_runtime", "status",
+			"in_production", "tagline", "rating", "total_ratings"},
+	), true
+}
+
+func (ss *SeriesSelectable) ConstructSelectQuery() string {
+	_, ok := ss.IsSelectable()
+	if !ok {
+		return ""
+	}
+	return "call get_series_by_id(?)"
+}
+
+// seriesColumns are the nullable columns of `get_series_by_id`.
+type seriesColumns struct {
+	Language      sql.NullString
+	OriginalTitle sql.NullString
+	Overview      sql.NullString
+	Popularity    sql.NullFloat64
+	Tagline       sql.NullString
+}
+
+// ScanSeries scans a row of `get_series_by_id`.
+func ScanSeries(row interface{ Scan(...any) error }) (*SeriesSelectable, error) {
+	var ss SeriesSelectable
+	var c seriesColumns
+	if err := row.Scan(&ss.Id, &ss.SeriesId, &c.Language, &ss.Title,
+		&c.OriginalTitle, &c.Overview, &c.Popularity, &ss.FirstAirDate,
+		&ss.LastAirDate, &ss.NumberOfSeasons, &ss.NumberOfEpisodes,
+		&ss.EpisodeRuntime, &ss.Status, &ss.InProduction, &c.Tagline,
+		&ss.AverageScore, &ss.TotalScore); err != nil {
+		return nil, err
+	}
+	ss.OriginalLanguage = c.Language.String
+	ss.OriginalTitle = c.OriginalTitle.String
+	ss.Overview = c.Overview.String
+	ss.Popularity = c.Popularity.Float64
+	ss.Tagline = c.Tagline.String
+	return &ss, nil
+}
+
+// normalize checks the required fields and fits the rest into the columns.
+func (si *SeriesInsertable) normalize() error {
+	if si.SeriesId == 0 {
+		return fmt.Errorf("series %q has no id", si.Title)
+	}
+	if si.Title == "" {
+		si.Title = si.OriginalTitle
+	}
+	if si.Title == "" {
+		return fmt.Errorf("series %v has no title", si.SeriesId)
+	}
+	si.Title = Truncate(si.Title, 256)
+	si.OriginalTitle = Truncate(si.OriginalTitle, 256)
+	si.Overview = Truncate(si.Overview, 2048)
+	si.Tagline = Truncate(si.Tagline, 128)
+	if !SeriesStatuses[si.Status] {
+		si.Status = "N/A"
+	}
+	if len(si.OriginalLanguage) != 2 {
+		si.OriginalLanguage = ""
+	}
+	for i := range si.Seasons {
+		si.Seasons[i].Name = Truncate(si.Seasons[i].Name, 256)
+		si.Seasons[i].Overview = Truncate(si.Seasons[i].Overview, 2048)
+	}
+	for i := range si.Networks {
+		si.Networks[i].Name = Truncate(si.Networks[i].Name, 128)
+		if len(si.Networks[i].Country) != 2 {
+			si.Networks[i].Country = ""
+		}
+	}
+	return nil
+}
+
+// mergeSeries creates or updates the series, its genres, networks and seasons.
+func mergeSeries(tx *sql.Tx, si *SeriesInsertable) error {
+	t, _ := si.IsInsertable()
+	stmt := fmt.Sprintf("%v%v%v", si.ConstructInsertQuery(), t.QueryField,
+		UpsertSuffix(t, "tmdb_id"))
+	if _, err := tx.Exec(stmt, si.SeriesId, nullableString(si.OriginalLanguage),
+		si.Title, nullableString(si.OriginalTitle), nullableString(si.Overview),
+		si.Popularity, si.FirstAirDate, si.LastAirDate, si.NumberOfSeasons,
+		si.NumberOfEpisodes, si.EpisodeRuntime, si.Status, si.InProduction,
+		nullableString(si.Tagline), si.AverageScore, si.TotalScore,
+		nullableString(si.PosterPath), nullableString(si.BackdropPath)); err != nil {
+		return err
+	}
+
+	for _, g := range si.Genres {
+		if g.Name == "" {
+			continue
+		}
+		if _, err := tx.Exec(`insert ignore into genres(ID, genre) values (?, ?)`,
+			g.Id, g.Name); err != nil {
+			return err
+		}
+		// the genre may already exist under the id of the movie genre
+		if _, err := tx.Exec(`insert ignore into series2genres(series_id, genre_id)
+			select ?, ID from genres where ID = ? or genre = ? limit 1`,
+			si.SeriesId, g.Id, g.Name); err != nil {
+			return err
+		}
+	}
+
+	for _, n := range si.Networks {
+		if _, err := tx.Exec(`insert into networks(ID, name, country)
+			values (?, ?, ?) on duplicate key update name=values(name),
+			country=coalesce(values(country), country)`, n.Id, n.Name,
+			nullableString(n.Country)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`insert ignore into series2networks(series_id,
+			network_id) values (?, ?)`, si.SeriesId, n.Id); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range si.Seasons {
+		if _, err := tx.Exec(`insert into seasons(series_id, season_number,
+			name, overview, air_date, episode_count) values (?, ?, ?, ?, ?, ?)
+			on duplicate key update name=values(name), overview=values(overview),
+			air_date=values(air_date), episode_count=values(episode_count)`,
+			si.SeriesId, s.SeasonNumber, s.Name, nullableString(s.Overview),
+			s.AirDate, s.EpisodeCount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergeIntoSeries loads the series one by one, every chunk is a transaction.
+// A failed chunk is rolled back, the others are kept.
+func MergeIntoSeries(db *sql.DB, chunkSize *int) func(data *Insertable) error {
+	return func(i *Insertable) error {
+		ip, ok := (*i).(*InsertPipeline)
+		if !ok {
+			return fmt.Errorf("invalid interface (not a InsertPipeline)")
+		}
+
+		var loadErr error
+		for chunk := range slices.Chunk(*ip.Data, *chunkSize) {
+			if err := mergeSeriesChunk(db, chunk); err != nil {
+				DatabaseLogger.Println(err)
+				loadErr = errors.Join(loadErr, err)
+			}
+		}
+		return loadErr
+	}
+}
+
+func mergeSeriesChunk(db *sql.DB, chunk []*Insertable) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, item := range chunk {
+		si, ok := (*item).(*SeriesInsertable)
+		if !ok {
+			continue
+		}
+		if err := si.normalize(); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := mergeSeries(tx, si); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("couldn't merge series %v: %v", si.SeriesId, err)
+		}
+	}
+	return tx.Commit()
+}
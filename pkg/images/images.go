@@ -0,0 +1,193 @@
+// Package images turns the stored image references into absolute URLs and
+// optionally caches the images locally.
+package images
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultTmdbUrl      = "https://image.tmdb.org/t/p"
+	DefaultPosterSize   = "w500"
+	DefaultBackdropSize = "w1280"
+	DefaultLogoSize     = "w300"
+	// DefaultCoverUrl is the Open Library cover of an ISBN.
+	DefaultCoverUrl  = "https://covers.openlibrary.org/b/isbn/%s-L.jpg"
+	DefaultPublicUrl = "http://localhost:9997"
+	// MaxImageSize limits, in bytes, the cached images.
+	MaxImageSize = 10 << 20
+	// CachePath is where the service serves the cached images.
+	CachePath = "/v1/api/images"
+)
+
+var (
+	// tmdbSizes are the sizes TMDB serves the images in.
+	tmdbSizes = map[string]bool{
+		"w45": true, "w92": true, "w154": true, "w185": true, "w300": true,
+		"w342": true, "w500": true, "w780": true, "w1280": true, "original": true,
+	}
+	tmdbFile = regexp.MustCompile(`^[A-Za-z0-9_-]+\.(jpg|jpeg|png|svg)$`)
+	isbnRe   = regexp.MustCompile(`^[0-9]{9}[0-9X]$|^[0-9]{13}$`)
+)
+
+// Config is read from the `Images` section of the service's config.
+type Config struct {
+	TmdbUrl      string `mapstructure:"tmdb_url"`
+	PosterSize   string `mapstructure:"poster_size"`
+	BackdropSize string `mapstructure:"backdrop_size"`
+	LogoSize     string `mapstructure:"logo_size"`
+	// CoverUrl is the template of a book cover, `%s` is the ISBN.
+	CoverUrl string `mapstructure:"cover_url"`
+	// Cache is the directory of the local cache, empty disables it. With the
+	// cache the URLs point at the service, reachable under PublicUrl.
+	Cache     string `mapstructure:"cache"`
+	PublicUrl string `mapstructure:"public_url"`
+}
+
+// NewConfig reads the images configuration, the defaults are used if the
+// section is missing.
+func NewConfig(tableName string, v *viper.Viper) *Config {
+	c := Config{}
+	if v != nil && v.IsSet(tableName) {
+		if err := v.UnmarshalKey(tableName, &c); err != nil {
+			c = Config{}
+		}
+	}
+	if c.TmdbUrl == "" {
+		c.TmdbUrl = DefaultTmdbUrl
+	}
+	if !tmdbSizes[c.PosterSize] {
+		c.PosterSize = DefaultPosterSize
+	}
+	if !tmdbSizes[c.BackdropSize] {
+		c.BackdropSize = DefaultBackdropSize
+	}
+	if !tmdbSizes[c.LogoSize] {
+		c.LogoSize = DefaultLogoSize
+	}
+	if strings.Count(c.CoverUrl, "%s") != 1 {
+		c.CoverUrl = DefaultCoverUrl
+	}
+	if c.PublicUrl == "" {
+		c.PublicUrl = DefaultPublicUrl
+	}
+	c.TmdbUrl = strings.TrimSuffix(c.TmdbUrl, "/")
+	c.PublicUrl = strings.TrimSuffix(c.PublicUrl, "/")
+	return &c
+}
+
+func (c *Config) Poster(path string) string {
+	return c.tmdb(c.PosterSize, path)
+}
+
+func (c *Config) Backdrop(path string) string {
+	return c.tmdb(c.BackdropSize, path)
+}
+
+func (c *Config) Logo(path string) string {
+	return c.tmdb(c.LogoSize, path)
+}
+
+// Cover returns the stored cover URL if there is one, otherwise the cover of
+// the ISBN. Empty if the book has neither.
+func (c *Config) Cover(coverUrl, isbn13, isbn string) string {
+	if coverUrl != "" {
+		return coverUrl
+	}
+	for _, number := range []string{isbn13, isbn} {
+		if !isbnRe.MatchString(number) {
+			continue
+		}
+		if c.Cache != "" {
+			return c.PublicUrl + CachePath + "/cover/" + number
+		}
+		return fmt.Sprintf(c.CoverUrl, number)
+	}
+	return ""
+}
+
+func (c *Config) tmdb(size, path string) string {
+	file := strings.TrimPrefix(path, "/")
+	if !tmdbFile.MatchString(file) {
+		return ""
+	}
+	if c.Cache != "" {
+		return c.PublicUrl + CachePath + "/tmdb/" + size + "/" + file
+	}
+	return c.TmdbUrl + "/" + size + "/" + file
+}
+
+// Source returns the original URL and the cache key of a cached image, false
+// if the parameters don't name a valid image.
+func (c *Config) Source(kind, size, name string) (string, string, bool) {
+	switch kind {
+	case "tmdb":
+		if !tmdbSizes[size] || !tmdbFile.MatchString(name) {
+			return "", "", false
+		}
+		return c.TmdbUrl + "/" + size + "/" + name, filepath.Join("tmdb", size, name), true
+	case "cover":
+		if !isbnRe.MatchString(name) {
+			return "", "", false
+		}
+		return fmt.Sprintf(c.CoverUrl, name), filepath.Join("cover", name+".jpg"), true
+	}
+	return "", "", false
+}
+
+// Fetch returns the path of the cached image, it is downloaded first if it
+// isn't cached yet.
+func (c *Config) Fetch(ctx context.Context, source, key string) (string, error) {
+	path := filepath.Join(c.Cache, key)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", source, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%v returned status %v", source, resp.StatusCode)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "image/") {
+		return "", fmt.Errorf("%v is not an image", source)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	n, err := io.Copy(f, io.LimitReader(resp.Body, MaxImageSize+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if n > MaxImageSize {
+		return "", fmt.Errorf("%v is bigger than %v bytes", source, MaxImageSize)
+	}
+	return path, os.Rename(f.Name(), path)
+}
@@ -0,0 +1,224 @@
+// Package mlclient implements a client for the recommendation service
+// (main.py).
+package mlclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultTimeout = 5
+)
+
+// ItemTypes maps our item types into the types the service understands.
+var ItemTypes map[string]string = map[string]string{
+	"tv":      "series",
+	"movie":   "movie",
+	"book":    "book",
+	"concert": "concert",
+}
+
+// Config is read from the `Recommender` section of the service's config.
+type Config struct {
+	Url     string `mapstructure:"url"`
+	Timeout int    `mapstructure:"timeout"`
+}
+
+type Client struct {
+	BaseUrl string
+	Http    *http.Client
+}
+
+type Item struct {
+	Id       uint64   `json:"id"`
+	Type     string   `json:"type"`
+	Title    string   `json:"title"`
+	Genres   []string `json:"genres"`
+	Keywords []string `json:"keywords,omitempty"`
+	Overview string   `json:"overview,omitempty"`
+}
+
+type SyncItemsRequest struct {
+	Items       []Item `json:"items"`
+	FullReplace bool   `json:"full_replace"`
+}
+
+type SyncItemsResponse struct {
+	Status     string `json:"status"`
+	ItemsTotal int    `json:"items_total"`
+	IndexReady bool   `json:"index_ready"`
+}
+
+type Interaction struct {
+	UserId   uint64 `json:"user_id"`
+	ItemId   uint64 `json:"item_id"`
+	ItemType string `json:"item_type"`
+	Event    string `json:"event"`
+	Ts       int64  `json:"ts,omitempty"`
+}
+
+type SyncInteractionsRequest struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+type SyncInteractionsResponse struct {
+	Status   string `json:"status"`
+	Ingested int    `json:"ingested"`
+	Skipped  int    `json:"skipped"`
+}
+
+type ItemRef struct {
+	Id   uint64 `json:"id"`
+	Type string `json:"type"`
+}
+
+type RecommendRequest struct {
+	UserId     uint64    `json:"user_id,omitempty"`
+	LikedItems []ItemRef `json:"liked_items"`
+	TargetType string    `json:"target_type,omitempty"`
+	Limit      int       `json:"limit"`
+	Diversity  float64   `json:"diversity"`
+	// Optional tuning, the service's defaults are used when zero.
+	MaxCandidates int     `json:"max_candidates,omitempty"`
+	MmrPool       int     `json:"mmr_pool,omitempty"`
+	MinScore      float64 `json:"min_score,omitempty"`
+}
+
+type RecommendedItem struct {
+	Id     uint64   `json:"id"`
+	Type   string   `json:"type"`
+	Title  string   `json:"title"`
+	Genres []string `json:"genres"`
+	Score  float64  `json:"score"`
+	Reason string   `json:"reason"`
+}
+
+type RecommendResponse struct {
+	Items []RecommendedItem `json:"items"`
+}
+
+type FeedbackResponse struct {
+	Status        string `json:"status"`
+	NewPopularity int    `json:"new_popularity"`
+}
+
+type HealthResponse struct {
+	Ok          bool `json:"ok"`
+	ItemsLoaded int  `json:"items_loaded"`
+	IndexReady  bool `json:"index_ready"`
+}
+
+// StatusError is returned when the service answered with a non 2xx status.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("recommender returned status %v: %v", se.Code, se.Body)
+}
+
+// NewConfig reads the client configuration, returns nil if the section is
+// missing.
+func NewConfig(tableName string, v *viper.Viper) *Config {
+	if v == nil || !v.IsSet(tableName) {
+		return nil
+	}
+	var c Config
+	if err := v.UnmarshalKey(tableName, &c); err != nil || c.Url == "" {
+		return nil
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	return &c
+}
+
+func NewClient(c *Config) *Client {
+	return &Client{
+		BaseUrl: strings.TrimSuffix(c.Url, "/"),
+		Http:    &http.Client{Timeout: time.Duration(c.Timeout) * time.Second},
+	}
+}
+
+// Health checks if the service is up.
+func (c *Client) Health(ctx context.Context) (*HealthResponse, error) {
+	var resp HealthResponse
+	if err := c.do(ctx, "GET", "/health", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SyncItems feeds the service with the catalog. With full replace the
+// service forgets every item that is not in the request.
+func (c *Client) SyncItems(ctx context.Context, req *SyncItemsRequest) (*SyncItemsResponse, error) {
+	var resp SyncItemsResponse
+	if err := c.do(ctx, "POST", "/sync/items", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) SyncInteractions(ctx context.Context, req *SyncInteractionsRequest) (*SyncInteractionsResponse, error) {
+	var resp SyncInteractionsResponse
+	if err := c.do(ctx, "POST", "/sync/interactions", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Recommend(ctx context.Context, req *RecommendRequest) (*RecommendResponse, error) {
+	var resp RecommendResponse
+	if err := c.do(ctx, "POST", "/recommend", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Feedback(ctx context.Context, req *Interaction) (*FeedbackResponse, error) {
+	var resp FeedbackResponse
+	if err := c.do(ctx, "POST", "/feedback", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, payload, out any) error {
+	var body io.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseUrl+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("accept", "application/json")
+	if payload != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	resp, err := c.Http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &StatusError{Code: resp.StatusCode, Body: string(respBody)}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
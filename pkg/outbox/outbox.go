@@ -0,0 +1,314 @@
+// Package outbox delivers the user events, written to the transactional
+// outbox table together with each event, to the downstream sinks.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sadsonkeenolee/IO_projekt/pkg/utils"
+	"github.com/spf13/viper"
+)
+
+var OutboxLogger *log.Logger = log.New(os.Stderr, "", log.LstdFlags|log.Lmsgprefix|log.Llongfile)
+
+const (
+	DefaultInterval   = 5
+	DefaultBatchSize  = 100
+	MaxBackoffSeconds = 3600
+	MaxErrorLength    = 512
+	// GracePeriod is how long, in seconds, a row may take to commit after it
+	// got its ID. The cursor doesn't pass the younger rows, a row committed
+	// out of order is still delivered.
+	GracePeriod = 300
+	// DefaultRetention is how long, in seconds, the delivered rows are kept.
+	DefaultRetention = 7 * 24 * 3600
+	// PruneInterval is how often, in seconds, the delivered rows are deleted.
+	PruneInterval = 600
+	// PruneBatchSize limits the rows deleted by a single statement.
+	PruneBatchSize = 1000
+)
+
+// Message is a single outbox row.
+type Message struct {
+	Id        uint64 `json:"id"`
+	EventId   uint64 `json:"event_id"`
+	UserId    uint64 `json:"user_id"`
+	EventName string `json:"event"`
+	ItemType  string `json:"type"`
+	ItemId    uint64 `json:"item_id"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Sink receives the messages from the relay. Deliver must be idempotent, the
+// relay guarantees at-least-once delivery, so a batch might be sent again
+// after a failure.
+type Sink interface {
+	// Name identifies the sink, the delivery progress is stored under it.
+	Name() string
+	// Deliver sends the messages, in order. On error the whole batch is retried.
+	Deliver(ctx context.Context, msgs []Message) error
+}
+
+// Config is read from the `Outbox` section of the service's config.
+type Config struct {
+	Webhook   string `mapstructure:"webhook"`
+	Feedback  string `mapstructure:"feedback"`
+	File      string `mapstructure:"file"`
+	Interval  int    `mapstructure:"interval"`
+	BatchSize int    `mapstructure:"batch_size"`
+	// Retention is how long, in seconds, the rows delivered to every sink are
+	// kept, it's never shorter than GracePeriod.
+	Retention int `mapstructure:"retention"`
+}
+
+// Relay polls the outbox and delivers new rows to every sink. Every sink keeps
+// its own cursor and deliveries, so a failing sink doesn't hold back the
+// others.
+type Relay struct {
+	DB        *sql.DB
+	Logger    *log.Logger
+	Sinks     []Sink
+	Interval  time.Duration
+	BatchSize int
+	Retention time.Duration
+	wake      chan struct{}
+}
+
+// NewConfig reads the outbox configuration, returns nil if the section is
+// missing.
+func NewConfig(tableName string, v *viper.Viper) *Config {
+	if v == nil || !v.IsSet(tableName) {
+		return nil
+	}
+	var c Config
+	if err := v.UnmarshalKey(tableName, &c); err != nil {
+		OutboxLogger.Printf("Got error while unmarshalling: %v\n", err)
+		return nil
+	}
+	if c.Interval <= 0 {
+		c.Interval = DefaultInterval
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.Retention <= 0 {
+		c.Retention = DefaultRetention
+	}
+	c.Retention = max(c.Retention, GracePeriod)
+	return &c
+}
+
+// NewSinks creates every sink that has been configured.
+func NewSinks(c *Config) []Sink {
+	sinks := []Sink{}
+	if c.Webhook != "" {
+		sinks = append(sinks, NewWebhookSink(c.Webhook))
+	}
+	if c.Feedback != "" {
+		sinks = append(sinks, NewFeedbackSink(c.Feedback))
+	}
+	if c.File != "" {
+		sinks = append(sinks, NewFileSink(c.File))
+	}
+	return sinks
+}
+
+func NewRelay(db *sql.DB, l *log.Logger, c *Config, sinks ...Sink) *Relay {
+	return &Relay{
+		DB:        db,
+		Logger:    l,
+		Sinks:     sinks,
+		Interval:  time.Duration(c.Interval) * time.Second,
+		BatchSize: c.BatchSize,
+		Retention: time.Duration(c.Retention) * time.Second,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes the relay up before the next tick, it never blocks.
+func (r *Relay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers the messages until the context is cancelled, every
+// PruneInterval the delivered rows past the retention are deleted.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	var prunedAt time.Time
+	for {
+		for _, sink := range r.Sinks {
+			if err := r.deliver(ctx, sink); err != nil {
+				r.Logger.Printf("outbox delivery to `%v` failed, reason: %v\n", sink.Name(), err)
+			}
+		}
+		if time.Since(prunedAt) >= PruneInterval*time.Second {
+			if err := r.prune(ctx); err != nil {
+				r.Logger.Printf("couldn't prune the outbox, reason: %v\n", err)
+			}
+			prunedAt = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// deliver sends every pending batch to the sink, stops on the first failure.
+func (r *Relay) deliver(ctx context.Context, sink Sink) error {
+	if _, err := r.DB.ExecContext(ctx, `insert ignore into
+		event_outbox_cursors(sink) values (?)`, sink.Name()); err != nil {
+		return err
+	}
+
+	for {
+		var lastId uint64
+		var attempts uint
+		var isDue bool
+		if err := r.DB.QueryRowContext(ctx, `select last_id, attempts,
+			next_attempt_at <= current_timestamp from event_outbox_cursors
+			where sink=?`, sink.Name()).Scan(&lastId, &attempts, &isDue); err != nil {
+			return err
+		}
+		if !isDue {
+			return nil
+		}
+
+		msgs, err := r.fetch(ctx, sink, lastId)
+		if err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			return nil
+		}
+
+		if err := sink.Deliver(ctx, msgs); err != nil {
+			r.backoff(ctx, sink, attempts+1, err)
+			return err
+		}
+		if err := r.markDelivered(ctx, sink, msgs); err != nil {
+			return err
+		}
+	}
+}
+
+// fetch returns the rows above the cursor not delivered to the sink yet.
+func (r *Relay) fetch(ctx context.Context, sink Sink, lastId uint64) ([]Message, error) {
+	rows, err := r.DB.QueryContext(ctx, `select o.ID, o.event_id, o.user_id,
+		o.event, o.type, o.item_id, o.created_at from event_outbox o
+		where o.ID > ? and not exists (select 1 from event_outbox_deliveries d
+		where d.sink=? and d.outbox_id=o.ID) order by o.ID limit ?`, lastId,
+		sink.Name(), r.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := make([]Message, 0, r.BatchSize)
+	for rows.Next() {
+		var m Message
+		var createdAt time.Time
+		if err := rows.Scan(&m.Id, &m.EventId, &m.UserId, &m.EventName,
+			&m.ItemType, &m.ItemId, &createdAt); err != nil {
+			return nil, err
+		}
+		m.Timestamp = createdAt.Unix()
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
+
+// markDelivered saves the delivered rows and moves the cursor up to the first
+// row not delivered yet, but not past the rows younger than GracePeriod, as an
+// older ID might still commit. The deliveries below the cursor are dropped.
+func (r *Relay) markDelivered(ctx context.Context, sink Sink, msgs []Message) error {
+	args := make([]any, 0, 2*len(msgs))
+	for _, m := range msgs {
+		args = append(args, sink.Name(), m.Id)
+	}
+	if _, err := r.DB.ExecContext(ctx, `insert ignore into
+		event_outbox_deliveries(sink, outbox_id) values `+
+		strings.TrimSuffix(strings.Repeat("(?, ?), ", len(msgs)), ", "),
+		args...); err != nil {
+		return err
+	}
+
+	if _, err := r.DB.ExecContext(ctx, `update event_outbox_cursors c set
+		c.last_id=greatest(c.last_id, coalesce((select max(o.ID) from event_outbox o
+			where o.ID > c.last_id
+			and o.created_at < timestampadd(second, -?, current_timestamp)
+			and o.ID < coalesce((select min(u.ID) from event_outbox u
+				where u.ID > c.last_id and not exists (select 1
+				from event_outbox_deliveries d where d.sink=c.sink
+				and d.outbox_id=u.ID)), ~0)), 0)),
+		c.attempts=0, c.last_error=null, c.next_attempt_at=current_timestamp
+		where c.sink=?`, GracePeriod, sink.Name()); err != nil {
+		return err
+	}
+	_, err := r.DB.ExecContext(ctx, `delete d from event_outbox_deliveries d
+		join event_outbox_cursors c on c.sink=d.sink
+		where d.sink=? and d.outbox_id <= c.last_id`, sink.Name())
+	return err
+}
+
+// prune deletes the rows every sink's cursor has passed and that are older
+// than the retention. Nothing is deleted until every sink has a cursor.
+func (r *Relay) prune(ctx context.Context) error {
+	if len(r.Sinks) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(r.Sinks))
+	for _, sink := range r.Sinks {
+		args = append(args, sink.Name())
+	}
+	var cursors int
+	var lowest uint64
+	if err := r.DB.QueryRowContext(ctx, `select count(*), coalesce(min(last_id), 0)
+		from event_outbox_cursors where sink in (`+
+		strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")+`)`,
+		args...).Scan(&cursors, &lowest); err != nil {
+		return err
+	}
+	if cursors < len(r.Sinks) || lowest == 0 {
+		return nil
+	}
+
+	retention := int64(r.Retention / time.Second)
+	for {
+		res, err := r.DB.ExecContext(ctx, `delete from event_outbox where ID <= ?
+			and created_at < timestampadd(second, -?, current_timestamp)
+			order by ID limit ?`, lowest, retention, PruneBatchSize)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n < PruneBatchSize {
+			return err
+		}
+	}
+}
+
+// backoff postpones the next attempt exponentially, up to MaxBackoffSeconds.
+func (r *Relay) backoff(ctx context.Context, sink Sink, attempts uint, cause error) {
+	delay := MaxBackoffSeconds
+	if attempts < 12 {
+		delay = min(1<<attempts, MaxBackoffSeconds)
+	}
+	reason := utils.TruncateUtf8(cause.Error(), MaxErrorLength)
+	if _, err := r.DB.ExecContext(ctx, `update event_outbox_cursors set
+		attempts=?, last_error=?, next_attempt_at=timestampadd(second, ?,
+		current_timestamp) where sink=?`, attempts, reason, delay,
+		sink.Name()); err != nil {
+		r.Logger.Printf("couldn't update the cursor, reason: %v\n", err)
+	}
+}
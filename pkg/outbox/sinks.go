@@ -0,0 +1,147 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sadsonkeenolee/IO_projekt/pkg/mlclient"
+)
+
+const (
+	DefaultSinkTimeout = 10
+)
+
+// WebhookSink posts every batch as a JSON array to the given url.
+type WebhookSink struct {
+	Url    string
+	Client *http.Client
+}
+
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{
+		Url:    url,
+		Client: &http.Client{Timeout: DefaultSinkTimeout * time.Second},
+	}
+}
+
+func (ws *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (ws *WebhookSink) Deliver(ctx context.Context, msgs []Message) error {
+	return postJson(ctx, ws.Client, ws.Url, msgs)
+}
+
+// FeedbackSink forwards the likes to the ML service's `/feedback` endpoint.
+// Events the service doesn't know about are skipped.
+type FeedbackSink struct {
+	Client *mlclient.Client
+}
+
+func NewFeedbackSink(url string) *FeedbackSink {
+	return &FeedbackSink{
+		Client: mlclient.NewClient(&mlclient.Config{
+			Url:     url,
+			Timeout: DefaultSinkTimeout,
+		}),
+	}
+}
+
+func (fs *FeedbackSink) Name() string {
+	return "feedback"
+}
+
+func (fs *FeedbackSink) Deliver(ctx context.Context, msgs []Message) error {
+	for _, m := range msgs {
+		itemType, ok := mlclient.ItemTypes[m.ItemType]
+		if !ok || m.EventName != "like" {
+			continue
+		}
+		_, err := fs.Client.Feedback(ctx, &mlclient.Interaction{
+			UserId:   m.UserId,
+			ItemId:   m.ItemId,
+			ItemType: itemType,
+			Event:    m.EventName,
+			Ts:       m.Timestamp,
+		})
+		// The service doesn't know the item, retrying won't change it.
+		if se, ok := err.(*mlclient.StatusError); ok && se.Code == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileSink appends every message as a JSON line to the file.
+type FileSink struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func NewFileSink(path string) *FileSink {
+	return &FileSink{Path: path}
+}
+
+func (fs *FileSink) Name() string {
+	return "file"
+}
+
+func (fs *FileSink) Deliver(ctx context.Context, msgs []Message) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fd, err := os.OpenFile(fs.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	enc := json.NewEncoder(fd)
+	for _, m := range msgs {
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	return fd.Sync()
+}
+
+// StatusError is returned when the sink answered with a non 2xx status.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %v: %v", se.Code, se.Body)
+}
+
+func postJson(ctx context.Context, client *http.Client, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &StatusError{Code: resp.StatusCode, Body: string(respBody)}
+	}
+	return nil
+}
@@ -82,6 +82,16 @@ func NewBadContentRequest(ctx *gin.Context, message string) {
 		})
 }
 
+// NewStatusContentRequest replies with the content and the given status.
+func NewStatusContentRequest(ctx *gin.Context, status int, content any) {
+	ctx.JSON(
+		status,
+		ContentRequestReponse{
+			Timestamp: time.Now().Unix(),
+			Content:   content,
+		})
+}
+
 // NewBadCredentialsCoreResponse defines a basic error message to reduce
 // boilerplate.
 func NewBadCredentialsCoreResponse(ctx *gin.Context, message string) {
@@ -0,0 +1,77 @@
+package tmdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrUnauthorized = errors.New("tmdb: invalid api key")
+	ErrNotFound     = errors.New("tmdb: resource not found")
+	ErrRateLimited  = errors.New("tmdb: rate limited")
+	ErrUnavailable  = errors.New("tmdb: service unavailable")
+)
+
+// Error is returned when TMDB answered with a non 2xx status. It matches one
+// of the sentinel errors with errors.Is.
+type Error struct {
+	Path   string
+	Status int
+	// Code and Message are TMDB's `status_code` and `status_message`.
+	Code    int
+	Message string
+	// RetryAfter is the delay requested by TMDB, zero if none.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("tmdb: %v returned status %v: %v", e.Path, e.Status, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	switch {
+	case e.Status == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.Status == http.StatusNotFound:
+		return ErrNotFound
+	case e.Status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.Status >= 500:
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// DecodeError is returned when the response is not the expected JSON.
+type DecodeError struct {
+	Path string
+	Err  error
+}
+
+func (de *DecodeError) Error() string {
+	return fmt.Sprintf("tmdb: couldn't decode %v: %v", de.Path, de.Err)
+}
+
+func (de *DecodeError) Unwrap() error {
+	return de.Err
+}
+
+// isRetryable reports if the request might succeed when repeated, that is it
+// was rate limited, TMDB failed or the connection did.
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var de *DecodeError
+	if errors.As(err, &de) {
+		return false
+	}
+	var te *Error
+	if errors.As(err, &te) {
+		return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrUnavailable)
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package tmdb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/sadsonkeenolee/IO_projekt/pkg/utils"
+)
+
+const (
+	// DefaultExportsUrl hosts the daily id exports, they don't need the key.
+	DefaultExportsUrl = "https://files.tmdb.org/p/exports"
+)
+
+// exportNames maps the catalog types to the names of the exports.
+var exportNames map[string]string = map[string]string{
+	"movie": "movie_ids",
+	"tv":    "tv_series_ids",
+}
+
+// ExportEntry is a single line of a daily id export.
+type ExportEntry struct {
+	Id            uint64  `json:"id"`
+	Adult         bool    `json:"adult"`
+	OriginalTitle string  `json:"original_title"`
+	OriginalName  string  `json:"original_name"`
+	Popularity    float64 `json:"popularity"`
+	Video         bool    `json:"video"`
+}
+
+// ExportName returns the file name of the export of the day, e.g.
+// `movie_ids_10_18_2026.json.gz`.
+func ExportName(itemType string, day time.Time) (string, error) {
+	name, ok := exportNames[itemType]
+	if !ok {
+		return "", fmt.Errorf("tmdb: no export of type %v", itemType)
+	}
+	return name + "_" + day.UTC().Format("01_02_2006") + ".json.gz", nil
+}
+
+// DownloadExport writes the export of the day into w. The exports of the day
+// are published in the morning (UTC), yesterday's one is always there.
+func (c *Client) DownloadExport(ctx context.Context, itemType string, day time.Time, w io.Writer) error {
+	name, err := ExportName(itemType, day)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", c.ExportsUrl+"/"+name, nil)
+	if err != nil {
+		return err
+	}
+	// the exports are big, the timeout of the Api requests doesn't apply
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newError("/"+name, resp)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// ReadExport calls fn for every entry of the gzipped export, starting at the
+// line `from`. Reading stops at the first error returned by fn.
+func ReadExport(r io.Reader, from int64, fn func(line int64, e *ExportEntry) error) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	var line int64
+	for ; scanner.Scan(); line++ {
+		if line < from {
+			continue
+		}
+		var e ExportEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("tmdb: line %v of the export: %v", line, err)
+		}
+		if err := fn(line, &e); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// DiscoverMovie returns a page of the movies, the most popular first.
+func (c *Client) DiscoverMovie(ctx context.Context, page int) (*utils.TmdbResponseContentSchema, error) {
+	return c.discover(ctx, "/discover/movie", page)
+}
+
+// DiscoverTv returns a page of the series, the most popular first.
+func (c *Client) DiscoverTv(ctx context.Context, page int) (*utils.TmdbResponseContentSchema, error) {
+	return c.discover(ctx, "/discover/tv", page)
+}
+
+func (c *Client) discover(ctx context.Context, path string, page int) (*utils.TmdbResponseContentSchema, error) {
+	var resp utils.TmdbResponseContentSchema
+	if err := c.Get(ctx, path, url.Values{
+		"sort_by":       {"popularity.desc"},
+		"include_adult": {"false"},
+		"page":          {strconv.Itoa(max(page, 1))},
+	}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,257 @@
+// Package tmdb implements a rate limited client for the TMDB Api.
+package tmdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sadsonkeenolee/IO_projekt/pkg/utils"
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultUrl      = "https://api.themoviedb.org/3"
+	DefaultLanguage = "en-US"
+	DefaultTimeout  = 10
+	// TMDB allows around 50 requests per second, stay below it.
+	DefaultRate    = 40.0
+	DefaultBurst   = 20
+	DefaultRetries = 3
+	DefaultBackoff = 500
+	// MaxBackoff caps the delay, in milliseconds, between the retries.
+	MaxBackoff = 30000
+)
+
+// Config is read from the `Tmdb` section of the service's config.
+type Config struct {
+	Url        string `mapstructure:"url"`
+	ExportsUrl string `mapstructure:"exports_url"`
+	// ApiKey is the API Read Access Token, sent as a bearer token. If empty,
+	// `TMDB_API_KEY` is used.
+	ApiKey   string `mapstructure:"api_key"`
+	Language string `mapstructure:"language"`
+	// Timeout is the limit, in seconds, of a single request.
+	Timeout int `mapstructure:"timeout"`
+	// Rate is how many requests per second are sent, Burst how many can be
+	// sent at once.
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
+	// Retries is how many times a request failed with 429 or 5xx is repeated,
+	// Backoff is the first delay in milliseconds, it doubles every retry.
+	Retries int `mapstructure:"retries"`
+	Backoff int `mapstructure:"backoff"`
+}
+
+type Client struct {
+	BaseUrl    string
+	ExportsUrl string
+	ApiKey     string
+	Language   string
+	Http       *http.Client
+	Limiter    *TokenBucket
+	Retries    int
+	Backoff    time.Duration
+}
+
+// NewConfig reads the client configuration, the defaults are used if the
+// section is missing.
+func NewConfig(tableName string, v *viper.Viper) *Config {
+	c := Config{}
+	if v != nil && v.IsSet(tableName) {
+		if err := v.UnmarshalKey(tableName, &c); err != nil {
+			c = Config{}
+		}
+	}
+	if c.Url == "" {
+		c.Url = DefaultUrl
+	}
+	if c.ExportsUrl == "" {
+		c.ExportsUrl = DefaultExportsUrl
+	}
+	if c.ApiKey == "" {
+		c.ApiKey = os.Getenv("TMDB_API_KEY")
+	}
+	if c.Language == "" {
+		c.Language = DefaultLanguage
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Rate <= 0 {
+		c.Rate = DefaultRate
+	}
+	if c.Burst <= 0 {
+		c.Burst = DefaultBurst
+	}
+	// zero retries is a valid setting, only a missing one gets the default
+	if v == nil || !v.IsSet(tableName+".retries") {
+		c.Retries = DefaultRetries
+	}
+	if c.Retries < 0 {
+		c.Retries = 0
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = DefaultBackoff
+	}
+	return &c
+}
+
+func NewClient(c *Config) *Client {
+	return &Client{
+		BaseUrl:    strings.TrimSuffix(c.Url, "/"),
+		ExportsUrl: strings.TrimSuffix(c.ExportsUrl, "/"),
+		ApiKey:     c.ApiKey,
+		Language:   c.Language,
+		Http:       &http.Client{Timeout: time.Duration(c.Timeout) * time.Second},
+		Limiter:    NewTokenBucket(c.Rate, c.Burst),
+		Retries:    c.Retries,
+		Backoff:    time.Duration(c.Backoff) * time.Millisecond,
+	}
+}
+
+// SearchTv returns a page of the series matching the query, first aired in
+// the year unless it is zero.
+func (c *Client) SearchTv(ctx context.Context, query string, year, page int) (*utils.TmdbResponseContentSchema, error) {
+	var resp utils.TmdbResponseContentSchema
+	params := url.Values{
+		"query":         {query},
+		"include_adult": {"true"},
+		"page":          {strconv.Itoa(max(page, 1))},
+	}
+	if year > 0 {
+		params.Set("first_air_date_year", strconv.Itoa(year))
+	}
+	if err := c.Get(ctx, "/search/tv", params, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Tv returns the series with its seasons and networks.
+func (c *Client) Tv(ctx context.Context, id uint64) (*utils.TmdbTvSchema, error) {
+	var resp utils.TmdbTvSchema
+	if err := c.Get(ctx, "/tv/"+strconv.FormatUint(id, 10), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SearchMovie returns a page of the movies matching the query.
+func (c *Client) SearchMovie(ctx context.Context, query string, page int) (*utils.TmdbResponseContentSchema, error) {
+	var resp utils.TmdbResponseContentSchema
+	if err := c.Get(ctx, "/search/movie", url.Values{
+		"query":         {query},
+		"include_adult": {"false"},
+		"page":          {strconv.Itoa(max(page, 1))},
+	}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Movie(ctx context.Context, id uint64) (*utils.TmdbMovieSchema, error) {
+	var resp utils.TmdbMovieSchema
+	if err := c.Get(ctx, "/movie/"+strconv.FormatUint(id, 10), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) MovieCredits(ctx context.Context, id uint64) (*utils.TmdbMovieCreditsSchema, error) {
+	var resp utils.TmdbMovieCreditsSchema
+	if err := c.Get(ctx, "/movie/"+strconv.FormatUint(id, 10)+"/credits", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) MovieKeywords(ctx context.Context, id uint64) (*utils.TmdbMovieKeywordsSchema, error) {
+	var resp utils.TmdbMovieKeywordsSchema
+	if err := c.Get(ctx, "/movie/"+strconv.FormatUint(id, 10)+"/keywords", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Get requests the path and decodes the response into out. The requests wait
+// for the rate limiter, the ones failed with 429, 5xx or a network error are
+// retried with exponential backoff.
+func (c *Client) Get(ctx context.Context, path string, query url.Values, out any) error {
+	for attempt := 0; ; attempt++ {
+		if err := c.Limiter.Wait(ctx); err != nil {
+			return err
+		}
+		err := c.get(ctx, path, query, out)
+		if err == nil || attempt >= c.Retries || !isRetryable(ctx, err) {
+			return err
+		}
+
+		delay := min(c.Backoff<<attempt, MaxBackoff*time.Millisecond)
+		var te *Error
+		if errors.As(err, &te) && te.RetryAfter > delay {
+			delay = te.RetryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	if query.Get("language") == "" && c.Language != "" {
+		query.Set("language", c.Language)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET",
+		c.BaseUrl+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("accept", "application/json")
+	req.Header.Add("Authorization", "Bearer "+c.ApiKey)
+
+	resp, err := c.Http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newError(path, resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return &DecodeError{Path: path, Err: err}
+	}
+	return nil
+}
+
+// newError reads the TMDB error body, `status_code` and `status_message`.
+func newError(path string, resp *http.Response) *Error {
+	e := &Error{Path: path, Status: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	var tmdbErr struct {
+		StatusCode    int    `json:"status_code"`
+		StatusMessage string `json:"status_message"`
+	}
+	if json.Unmarshal(body, &tmdbErr) == nil && tmdbErr.StatusMessage != "" {
+		e.Code = tmdbErr.StatusCode
+		e.Message = tmdbErr.StatusMessage
+	} else {
+		e.Message = strings.TrimSpace(string(body))
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return e
+}
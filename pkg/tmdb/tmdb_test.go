@@ -0,0 +1,185 @@
+package tmdb_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sadsonkeenolee/IO_projekt/pkg/tmdb"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/tmdb/tmdbtest"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/utils"
+)
+
+func newServer(t *testing.T) *tmdbtest.Server {
+	t.Helper()
+	s := tmdbtest.NewServer()
+	t.Cleanup(s.Close)
+	s.AddMovie(utils.TmdbMovieSchema{Id: 862, Title: "Toy Story"}, nil, nil)
+	return s
+}
+
+func TestRetryAfterRateLimited(t *testing.T) {
+	s := newServer(t)
+	s.SetRetryAfter(1)
+	s.FailNext(http.StatusTooManyRequests)
+	c := tmdb.NewClient(s.Config())
+
+	start := time.Now()
+	m, err := c.Movie(context.Background(), 862)
+	if err != nil {
+		t.Fatalf("Movie() failed: %v", err)
+	}
+	if m.Title != "Toy Story" {
+		t.Errorf("got title %q, want %q", m.Title, "Toy Story")
+	}
+	if n := len(s.Requests()); n != 2 {
+		t.Errorf("got %v requests, want 2", n)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want at least the Retry-After of 1s", elapsed)
+	}
+}
+
+func TestServerErrorBackoff(t *testing.T) {
+	s := newServer(t)
+	cfg := s.Config()
+	cfg.Backoff = 10
+	c := tmdb.NewClient(cfg)
+
+	t.Run("recovers", func(t *testing.T) {
+		before := len(s.Requests())
+		s.FailNext(http.StatusInternalServerError, http.StatusBadGateway)
+		if _, err := c.Movie(context.Background(), 862); err != nil {
+			t.Fatalf("Movie() failed: %v", err)
+		}
+		if n := len(s.Requests()) - before; n != 3 {
+			t.Errorf("got %v requests, want 3", n)
+		}
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		before := len(s.Requests())
+		failures := make([]int, cfg.Retries+1)
+		for idx := range failures {
+			failures[idx] = http.StatusServiceUnavailable
+		}
+		s.FailNext(failures...)
+
+		start := time.Now()
+		_, err := c.Movie(context.Background(), 862)
+		if !errors.Is(err, tmdb.ErrUnavailable) {
+			t.Fatalf("got %v, want ErrUnavailable", err)
+		}
+		if n := len(s.Requests()) - before; n != cfg.Retries+1 {
+			t.Errorf("got %v requests, want %v", n, cfg.Retries+1)
+		}
+		// 10ms, 20ms and 40ms between the attempts
+		if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+			t.Errorf("gave up after %v, want the backoff of at least 70ms", elapsed)
+		}
+	})
+}
+
+func TestTypedErrors(t *testing.T) {
+	s := newServer(t)
+	c := tmdb.NewClient(s.Config())
+
+	_, err := c.Movie(context.Background(), 1)
+	if !errors.Is(err, tmdb.ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+	var te *tmdb.Error
+	if !errors.As(err, &te) || te.Status != http.StatusNotFound || te.Code != 34 {
+		t.Errorf("got %#v, want the 404 with TMDB's status_code 34", te)
+	}
+
+	cfg := s.Config()
+	cfg.ApiKey = "invalid"
+	before := len(s.Requests())
+	_, err = tmdb.NewClient(cfg).Movie(context.Background(), 862)
+	if !errors.Is(err, tmdb.ErrUnauthorized) {
+		t.Errorf("got %v, want ErrUnauthorized", err)
+	}
+	if n := len(s.Requests()) - before; n != 1 {
+		t.Errorf("401 was sent %v times, want no retries", n)
+	}
+
+	before = len(s.Requests())
+	s.FailNext(http.StatusBadRequest)
+	if _, err := c.Movie(context.Background(), 862); err == nil {
+		t.Error("400 succeeded")
+	}
+	if n := len(s.Requests()) - before; n != 1 {
+		t.Errorf("400 was sent %v times, want no retries", n)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	tb := tmdb.NewTokenBucket(20, 2)
+	ctx := context.Background()
+
+	start := time.Now()
+	for range 2 {
+		if err := tb.Wait(ctx); err != nil {
+			t.Fatalf("Wait() failed: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("the burst took %v, want no waiting", elapsed)
+	}
+	// the bucket is empty, every token takes 50ms to refill
+	for range 2 {
+		if err := tb.Wait(ctx); err != nil {
+			t.Fatalf("Wait() failed: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("4 tokens took %v, want at least 100ms", elapsed)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := tb.Wait(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestClientThrottling(t *testing.T) {
+	s := newServer(t)
+	cfg := s.Config()
+	cfg.Rate = 20
+	cfg.Burst = 1
+	c := tmdb.NewClient(cfg)
+
+	start := time.Now()
+	for range 3 {
+		if _, err := c.Movie(context.Background(), 862); err != nil {
+			t.Fatalf("Movie() failed: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("3 requests took %v, want at least 100ms at 20 per second", elapsed)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	s := newServer(t)
+	s.SetDelay(time.Second)
+	cfg := s.Config()
+	cfg.Retries = 0
+	c := tmdb.NewClient(cfg)
+	c.Http.Timeout = 50 * time.Millisecond
+
+	start := time.Now()
+	_, err := c.Movie(context.Background(), 862)
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("timed out after %v, want about 50ms", elapsed)
+	}
+}
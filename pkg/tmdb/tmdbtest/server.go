@@ -0,0 +1,274 @@
+// Package tmdbtest implements a fake TMDB Api on top of httptest, for testing
+// the TMDB client and the ingest service without the network.
+package tmdbtest
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sadsonkeenolee/IO_projekt/pkg/tmdb"
+	"github.com/sadsonkeenolee/IO_projekt/pkg/utils"
+)
+
+const ApiKey = "tmdbtest-key"
+
+// Server serves the movies and the series added to it. Requests without
+// ApiKey are rejected like TMDB does.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	movies   map[uint64]utils.TmdbMovieSchema
+	credits  map[uint64]utils.TmdbMovieCreditsSchema
+	keywords map[uint64]utils.TmdbMovieKeywordsSchema
+	series   map[uint64]utils.TmdbTvSchema
+	failures []int
+	requests []string
+	// retryAfter is sent with the 429 failures, in seconds.
+	retryAfter int
+	delay      time.Duration
+}
+
+func NewServer() *Server {
+	s := &Server{
+		movies:   map[uint64]utils.TmdbMovieSchema{},
+		credits:  map[uint64]utils.TmdbMovieCreditsSchema{},
+		keywords: map[uint64]utils.TmdbMovieKeywordsSchema{},
+		series:   map[uint64]utils.TmdbTvSchema{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Config returns the client configuration pointing at the server, without
+// rate limiting and with short backoff.
+func (s *Server) Config() *tmdb.Config {
+	return &tmdb.Config{
+		Url:        s.URL,
+		ExportsUrl: s.URL + "/p/exports",
+		ApiKey:     ApiKey,
+		Language:   tmdb.DefaultLanguage,
+		Timeout:    5,
+		Rate:       -1,
+		Burst:      1,
+		Retries:    tmdb.DefaultRetries,
+		Backoff:    1,
+	}
+}
+
+// AddMovie adds the movie, the credits and the keywords may be nil.
+func (s *Server) AddMovie(m utils.TmdbMovieSchema, credits *utils.TmdbMovieCreditsSchema,
+	keywords *utils.TmdbMovieKeywordsSchema) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.movies[m.Id] = m
+	if credits != nil {
+		credits.Id = m.Id
+		s.credits[m.Id] = *credits
+	}
+	if keywords != nil {
+		keywords.Id = m.Id
+		s.keywords[m.Id] = *keywords
+	}
+}
+
+func (s *Server) AddTv(t utils.TmdbTvSchema) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.series[t.Id] = t
+}
+
+// FailNext makes the next requests fail with the statuses, in order. 429 is
+// sent with the `Retry-After` set by SetRetryAfter, 0 by default.
+func (s *Server) FailNext(statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, statuses...)
+}
+
+// SetRetryAfter sets the `Retry-After` of the 429 failures, in seconds.
+func (s *Server) SetRetryAfter(seconds int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retryAfter = seconds
+}
+
+// SetDelay delays every response, e.g. to hit the client's timeout.
+func (s *Server) SetDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = d
+}
+
+// Requests returns the paths of the requests served so far.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	delay := s.delay
+	s.mu.Unlock()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.URL.Path)
+
+	// the exports are public, like on files.tmdb.org
+	if strings.HasPrefix(r.URL.Path, "/p/exports/") {
+		s.serveExport(w, strings.TrimPrefix(r.URL.Path, "/p/exports/"))
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+ApiKey {
+		writeError(w, http.StatusUnauthorized, 7, "Invalid API key: You must be granted a valid key.")
+		return
+	}
+	if len(s.failures) > 0 {
+		status := s.failures[0]
+		s.failures = s.failures[1:]
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", strconv.Itoa(s.retryAfter))
+		}
+		writeError(w, status, 25, http.StatusText(status))
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "search" && parts[1] == "movie":
+		results := []utils.TmdbResultSchema{}
+		for _, m := range s.movies {
+			if matches(r, m.Title, m.OriginalTitle) {
+				results = append(results, utils.TmdbResultSchema{Id: m.Id,
+					Title: m.Title, OriginalTitle: m.OriginalTitle,
+					ReleaseDate: m.ReleaseDate, Popularity: m.Popularity})
+			}
+		}
+		writeResults(w, results)
+	case len(parts) == 2 && parts[0] == "search" && parts[1] == "tv":
+		results := []utils.TmdbResultSchema{}
+		for _, t := range s.series {
+			if matches(r, t.Name, t.OriginalName) {
+				results = append(results, utils.TmdbResultSchema{Id: t.Id,
+					Name: t.Name, OriginalName: t.OriginalName,
+					FirstAirDate: t.FirstAirDate, Popularity: t.Popularity})
+			}
+		}
+		writeResults(w, results)
+	case len(parts) == 2 && parts[0] == "discover" && parts[1] == "movie":
+		results := []utils.TmdbResultSchema{}
+		for _, m := range s.movies {
+			results = append(results, utils.TmdbResultSchema{Id: m.Id,
+				Title: m.Title, OriginalTitle: m.OriginalTitle,
+				ReleaseDate: m.ReleaseDate, Popularity: m.Popularity})
+		}
+		writeResults(w, results)
+	case len(parts) == 2 && parts[0] == "discover" && parts[1] == "tv":
+		results := []utils.TmdbResultSchema{}
+		for _, t := range s.series {
+			results = append(results, utils.TmdbResultSchema{Id: t.Id,
+				Name: t.Name, OriginalName: t.OriginalName,
+				FirstAirDate: t.FirstAirDate, Popularity: t.Popularity})
+		}
+		writeResults(w, results)
+	case len(parts) >= 2 && parts[0] == "movie":
+		id, _ := strconv.ParseUint(parts[1], 10, 64)
+		var v any
+		var ok bool
+		switch {
+		case len(parts) == 2:
+			v, ok = s.movies[id]
+		case len(parts) == 3 && parts[2] == "credits":
+			v, ok = s.credits[id]
+		case len(parts) == 3 && parts[2] == "keywords":
+			v, ok = s.keywords[id]
+		}
+		writeItem(w, v, ok)
+	case len(parts) == 2 && parts[0] == "tv":
+		id, _ := strconv.ParseUint(parts[1], 10, 64)
+		v, ok := s.series[id]
+		writeItem(w, v, ok)
+	default:
+		writeError(w, http.StatusNotFound, 34, "The resource you requested could not be found.")
+	}
+}
+
+// serveExport serves every movie or series as the export of any day.
+func (s *Server) serveExport(w http.ResponseWriter, name string) {
+	entries := []tmdb.ExportEntry{}
+	switch {
+	case strings.HasPrefix(name, "movie_ids_"):
+		for _, m := range s.movies {
+			entries = append(entries, tmdb.ExportEntry{Id: m.Id,
+				OriginalTitle: m.OriginalTitle, Popularity: m.Popularity})
+		}
+	case strings.HasPrefix(name, "tv_series_ids_"):
+		for _, t := range s.series {
+			entries = append(entries, tmdb.ExportEntry{Id: t.Id,
+				OriginalName: t.OriginalName, Popularity: t.Popularity})
+		}
+	default:
+		writeError(w, http.StatusNotFound, 34, "The resource you requested could not be found.")
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Id < entries[j].Id })
+	gz := gzip.NewWriter(w)
+	defer gz.Close()
+	enc := json.NewEncoder(gz)
+	for _, e := range entries {
+		enc.Encode(e)
+	}
+}
+
+func matches(r *http.Request, titles ...string) bool {
+	query := strings.ToLower(r.URL.Query().Get("query"))
+	for _, t := range titles {
+		if query != "" && strings.Contains(strings.ToLower(t), query) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeResults(w http.ResponseWriter, results []utils.TmdbResultSchema) {
+	json.NewEncoder(w).Encode(utils.TmdbResponseContentSchema{
+		Page:         1,
+		Results:      results,
+		TotalPages:   1,
+		TotalResults: len(results),
+	})
+}
+
+func writeItem(w http.ResponseWriter, v any, ok bool) {
+	if !ok {
+		writeError(w, http.StatusNotFound, 34, "The resource you requested could not be found.")
+		return
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"success":        false,
+		"status_code":    code,
+		"status_message": message,
+	})
+}
@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxRawRecord limits, in bytes, the raw records kept for the malformed ones.
+const MaxRawRecord = 64 << 10
+
+// TruncateUtf8 cuts s to at most n bytes without splitting a UTF-8 character.
+func TruncateUtf8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for end := n; end > 0 && end > n-utf8.UTFMax; end-- {
+		if utf8.RuneStart(s[end]) {
+			return s[:end]
+		}
+	}
+	return s[:n]
+}
+
+// Record is a single record of a data file with its position in the file.
+type Record struct {
+	Fields []string
+	// Row is the number of the record, counted from 0.
+	Row int64
+	// Offset is the byte offset right after the record.
+	Offset int64
+	// Raw is the record as written in the file, if the streamer keeps it.
+	Raw string
+	// Err is set for the malformed records, they have no fields.
+	Err error
+}
+
+// FormatRecord returns the raw record, or the fields written as CSV if the
+// streamer didn't keep it.
+func FormatRecord(r *Record) string {
+	if r.Raw != "" || r.Err != nil {
+		return r.Raw
+	}
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Write(r.Fields)
+	w.Flush()
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// Streamer reads the records of a data file, the fields of every record are
+// in the order of the header.
+type Streamer interface {
+	// Header returns the names of the fields.
+	Header(path string) ([]string, error)
+	// Stream streams the records starting at the offset and the row of a
+	// streamed record, zeroes stream the whole file. The malformed records
+	// are streamed with Err set. The channel is closed when the file ends or
+	// the context is cancelled.
+	Stream(ctx context.Context, path string, offset, row int64, l *log.Logger,
+		c chan<- Record) error
+}
+
+// Streamers are the supported formats.
+var Streamers map[string]Streamer = map[string]Streamer{
+	"csv":     CsvFile{},
+	"jsonl":   JsonlFile{},
+	"parquet": ParquetFile{},
+}
+
+// formatExtensions maps the file extensions to the formats.
+var formatExtensions map[string]string = map[string]string{
+	".csv":     "csv",
+	".jsonl":   "jsonl",
+	".ndjson":  "jsonl",
+	".parquet": "parquet",
+}
+
+// StreamerFor returns the streamer of the format, or of the extension of the
+// file if the format is empty.
+func StreamerFor(path, format string) (Streamer, error) {
+	if format == "" {
+		format = formatExtensions[strings.ToLower(filepath.Ext(path))]
+	}
+	s, ok := Streamers[strings.ToLower(format)]
+	if !ok {
+		return nil, fmt.Errorf("unknown format of %v", path)
+	}
+	return s, nil
+}
+
+// JsonlFile streams the objects of a JSON Lines file. The header is the keys
+// of the first object, the strings are passed unquoted and the other values as
+// JSON, so the nested ones look the same as in the CSV datasets.
+type JsonlFile struct{}
+
+func (JsonlFile) Header(path string) ([]string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	br := bufio.NewReader(fd)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			return jsonKeys(line)
+		}
+		if err == io.EOF {
+			return nil, fmt.Errorf("%v has no records", path)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f JsonlFile) Stream(ctx context.Context, path string, offset, row int64,
+	l *log.Logger, c chan<- Record) error {
+	defer close(c)
+	if l == nil {
+		l = log.New(os.Stderr, "", log.LstdFlags|log.Lmsgprefix)
+		l.Println("No logger provided, using a default one.")
+	}
+	header, err := f.Header(path)
+	if err != nil {
+		return err
+	}
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	if _, err := fd.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(fd)
+	l.Printf("Reading %v from byte %v\n", path, offset)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		offset += int64(len(line))
+		// every line is counted, so the row is the line number
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			r := Record{Row: row, Offset: offset, Raw: string(trimmed)}
+			var object map[string]json.RawMessage
+			if jsonErr := json.Unmarshal(trimmed, &object); jsonErr != nil {
+				r.Raw, r.Err = TruncateUtf8(r.Raw, MaxRawRecord), jsonErr
+			} else {
+				r.Fields = jsonFields(header, object)
+			}
+			select {
+			case c <- r:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if len(line) > 0 {
+			row++
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// jsonKeys returns the keys of the object in their order.
+func jsonKeys(object []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(object))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, fmt.Errorf("the record is not a JSON object")
+	}
+	keys := []string{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		keys = append(keys, t.(string))
+	}
+	return keys, nil
+}
+
+func jsonFields(header []string, object map[string]json.RawMessage) []string {
+	fields := make([]string, len(header))
+	for idx, key := range header {
+		raw, ok := object[key]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			fields[idx] = s
+			continue
+		}
+		fields[idx] = string(raw)
+	}
+	return fields
+}
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// ParquetFile streams the rows of a Parquet file. The header is the top level
+// columns, the nested values are passed as JSON. The offset of every record is
+// the size of the file, Parquet is resumed by the row.
+type ParquetFile struct{}
+
+func (ParquetFile) Header(path string) ([]string, error) {
+	fd, f, err := openParquet(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	header := []string{}
+	for _, field := range f.Schema().Fields() {
+		header = append(header, field.Name())
+	}
+	return header, nil
+}
+
+func (ParquetFile) Stream(ctx context.Context, path string, offset, row int64,
+	l *log.Logger, c chan<- Record) error {
+	defer close(c)
+	if l == nil {
+		l = log.New(os.Stderr, "", log.LstdFlags|log.Lmsgprefix)
+		l.Println("No logger provided, using a default one.")
+	}
+	fd, f, err := openParquet(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	size := f.Size()
+	header := []string{}
+	for _, field := range f.Schema().Fields() {
+		header = append(header, field.Name())
+	}
+
+	r := parquet.NewReader(f)
+	defer r.Close()
+	if err := r.SeekToRow(row); err != nil {
+		return err
+	}
+	l.Printf("Reading %v from row %v\n", path, row)
+	for {
+		values := map[string]any{}
+		if err := r.Read(&values); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%v row %v: %v", path, row, err)
+		}
+		fields := make([]string, len(header))
+		for idx, name := range header {
+			fields[idx] = parquetField(values[name])
+		}
+		select {
+		case c <- Record{Fields: fields, Row: row, Offset: size}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		row++
+	}
+}
+
+func openParquet(path string) (*os.File, *parquet.File, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, nil, err
+	}
+	f, err := parquet.OpenFile(fd, info.Size())
+	if err != nil {
+		fd.Close()
+		return nil, nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return fd, f, nil
+}
+
+// parquetField formats the value the way it would be written in a CSV.
+func parquetField(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		if v.Equal(v.Truncate(24 * time.Hour)) {
+			return v.Format(time.DateOnly)
+		}
+		return v.Format(time.DateTime)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
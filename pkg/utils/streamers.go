@@ -1,43 +1,169 @@
 package utils
 
 import (
+	"bufio"
+	"context"
+	"crypto/sha256"
 	"encoding/csv"
-	"fmt"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"os"
+	"strings"
+	"unicode"
 )
 
-// CsvStreamer streams the content of the CSV, it requires the channel that will
-// be streamed into.
-func CsvStreamer(path *string, l *log.Logger, c chan<- []string) error {
+// CsvFile streams the records of a CSV, the header is the first record.
+type CsvFile struct{}
+
+func (CsvFile) Header(path string) ([]string, error) {
+	return CsvHeader(path)
+}
+
+func (CsvFile) Stream(ctx context.Context, path string, offset, row int64,
+	l *log.Logger, c chan<- Record) error {
+	return CsvOffsetStreamer(ctx, &path, offset, row, l, c)
+}
+
+// CsvOffsetStreamer streams the content of the CSV starting at the given byte
+// offset, which must be a record boundary. Row is the number of the first
+// streamed record. The channel is closed when the file ends or the context is
+// cancelled.
+func CsvOffsetStreamer(ctx context.Context, path *string, offset, row int64,
+	l *log.Logger, c chan<- Record) error {
+	defer close(c)
 	if l == nil {
 		l = log.New(os.Stderr, "", log.LstdFlags|log.Lmsgprefix)
 		l.Println("No logger provided, using a default one.")
 	}
-
 	fd, err := os.Open(*path)
 	if err != nil {
 		return err
 	}
 	defer fd.Close()
-	defer close(c)
-	csvReader := csv.NewReader(fd)
-	fmt.Printf("Reading %v\n", *path)
+	if _, err := fd.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
 
-	// read until EOF
+	csvReader := csv.NewReader(fd)
+	l.Printf("Reading %v from byte %v\n", *path, offset)
+	start := offset
 	for {
 		record, err := csvReader.Read()
-
 		if err == io.EOF {
 			break
 		}
+		end := offset + csvReader.InputOffset()
+		r := Record{Fields: record, Row: row, Offset: end}
+		var pe *csv.ParseError
+		if errors.As(err, &pe) {
+			// malformed records are passed on without the fields
+			r.Fields, r.Err = nil, err
+			r.Raw = readRaw(fd, start, end)
+		} else if err != nil {
+			return err
+		}
+		select {
+		case c <- r:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		start = end
+		row++
+	}
+	return nil
+}
+
+// readRaw returns the bytes of the record, cut to MaxRawRecord. One more byte
+// is read to tell whether the cut splits a character.
+func readRaw(fd *os.File, start, end int64) string {
+	b := make([]byte, min(end-start, MaxRawRecord+1))
+	n, _ := fd.ReadAt(b, start)
+	return strings.TrimRight(TruncateUtf8(string(b[:n]), MaxRawRecord), "\r\n")
+}
+
+// FileHash returns the SHA-256 of the first `limit` bytes of the file, or of
+// the whole file if limit is negative, and the size of the file.
+func FileHash(path string, limit int64) (string, int64, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer fd.Close()
+	info, err := fd.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+
+	var r io.Reader = fd
+	if limit >= 0 {
+		r = io.LimitReader(fd, limit)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), info.Size(), nil
+}
+
+// CsvHeader returns the first record of the CSV.
+func CsvHeader(path string) ([]string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	return csv.NewReader(fd).Read()
+}
 
+// JsonStreamer streams the elements of a JSON array, or the values of a JSON
+// Lines file. Every element is sent as a record with a single field.
+func JsonStreamer(path *string, l *log.Logger, c chan<- []string) error {
+	defer close(c)
+	if l == nil {
+		l = log.New(os.Stderr, "", log.LstdFlags|log.Lmsgprefix)
+		l.Println("No logger provided, using a default one.")
+	}
+	fd, err := os.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	l.Printf("Reading %v\n", *path)
+
+	br := bufio.NewReader(fd)
+	isArray := false
+	for {
+		b, err := br.Peek(1)
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
+			return err
+		}
+		if unicode.IsSpace(rune(b[0])) {
+			br.ReadByte()
 			continue
 		}
+		isArray = b[0] == '['
+		break
+	}
 
-		c <- record
+	dec := json.NewDecoder(br)
+	if isArray {
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			l.Printf("Stopped reading %v, reason: %v\n", *path, err)
+			return err
+		}
+		c <- []string{string(raw)}
 	}
 	return nil
 }
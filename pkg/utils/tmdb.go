@@ -6,48 +6,158 @@ import (
 	"github.com/sadsonkeenolee/IO_projekt/pkg/database"
 )
 
-// TmdbTvSchema implements TMDB Api schema.
+// TmdbTvSchema implements TMDB Api schema of a TV series (`/tv/{id}`).
 type TmdbTvSchema struct {
+	Adult            bool                       `json:"adult"`
+	BackdropPath     string                     `json:"backdrop_path"`
+	EpisodeRunTime   []int64                    `json:"episode_run_time"`
+	FirstAirDate     string                     `json:"first_air_date"`
+	Genres           []TmdbGenreSchema          `json:"genres"`
+	Id               uint64                     `json:"id"`
+	InProduction     bool                       `json:"in_production"`
+	LastAirDate      string                     `json:"last_air_date"`
+	Name             string                     `json:"name"`
+	Networks         []TmdbNetworkSchema        `json:"networks"`
+	NumberOfEpisodes uint64                     `json:"number_of_episodes"`
+	NumberOfSeasons  uint64                     `json:"number_of_seasons"`
+	OriginCountry    []string                   `json:"origin_country"`
+	OriginalLanguage string                     `json:"original_language"`
+	OriginalName     string                     `json:"original_name"`
+	Overview         string                     `json:"overview"`
+	Popularity       float64                    `json:"popularity"`
+	PosterPath       string                     `json:"poster_path"`
+	Seasons          []TmdbSeasonSchema         `json:"seasons"`
+	SpokenLanguages  []TmdbSpokenLanguageSchema `json:"spoken_languages"`
+	Status           string                     `json:"status"`
+	Tagline          string                     `json:"tagline"`
+	Type             string                     `json:"type"`
+	VoteAverage      float64                    `json:"vote_average"`
+	VoteCount        uint64                     `json:"vote_count"`
+}
+
+// IntoSeriesInsertable casts the TMDB Api response into insertable item into
+// database, in this case SeriesInsertable.
+func (m *TmdbTvSchema) IntoSeriesInsertable() *database.SeriesInsertable {
+	si := &database.SeriesInsertable{
+		SeriesId:         m.Id,
+		OriginalLanguage: m.OriginalLanguage,
+		Title:            m.Name,
+		OriginalTitle:    m.OriginalName,
+		Overview:         m.Overview,
+		Popularity:       m.Popularity,
+		FirstAirDate:     parseTmdbDate(m.FirstAirDate),
+		LastAirDate:      parseTmdbDate(m.LastAirDate),
+		NumberOfSeasons:  m.NumberOfSeasons,
+		NumberOfEpisodes: m.NumberOfEpisodes,
+		Status:           m.Status,
+		InProduction:     m.InProduction,
+		Tagline:          m.Tagline,
+		AverageScore:     m.VoteAverage,
+		TotalScore:       m.VoteCount,
+		Genres:           mapGenres(m.Genres),
+		Networks:         make([]database.NetworkInsertable, len(m.Networks)),
+		Seasons:          make([]database.SeasonInsertable, len(m.Seasons)),
+		PosterPath:       m.PosterPath,
+		BackdropPath:     m.BackdropPath,
+	}
+	if len(m.EpisodeRunTime) > 0 {
+		si.EpisodeRuntime = &m.EpisodeRunTime[0]
+	}
+	for i, n := range m.Networks {
+		si.Networks[i].Id = uint64(n.ID)
+		si.Networks[i].Name = n.Name
+		si.Networks[i].Country = n.OriginCountry
+	}
+	for i, s := range m.Seasons {
+		si.Seasons[i] = database.SeasonInsertable{
+			SeasonNumber: s.SeasonNumber,
+			Name:         s.Name,
+			Overview:     s.Overview,
+			AirDate:      parseTmdbDate(s.AirDate),
+			EpisodeCount: s.EpisodeCount,
+		}
+	}
+	return si
+}
+
+// parseTmdbDate returns nil for the missing or malformed dates.
+func parseTmdbDate(s string) *time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// mapGenres maps TMDB Api schema into an insertable item.
+func mapGenres(gs []TmdbGenreSchema) []database.Genre {
+	out := make([]database.Genre, len(gs))
+	for i, v := range gs {
+		out[i].Id = uint64(v.ID)
+		out[i].Name = v.Name
+	}
+	return out
+}
+
+// TmdbMovieSchema implements TMDB Api schema of a movie (`/movie/{id}`).
+type TmdbMovieSchema struct {
 	Adult               bool                          `json:"adult"`
 	BackdropPath        string                        `json:"backdrop_path"`
 	Budget              uint64                        `json:"budget"`
 	Genres              []TmdbGenreSchema             `json:"genres"`
-	ImdbId              uint64                        `json:"id"`
+	Id                  uint64                        `json:"id"`
+	ImdbId              string                        `json:"imdb_id"`
 	OriginalLanguage    string                        `json:"original_language"`
-	OriginalTitle       string                        `json:"name"`
+	OriginalTitle       string                        `json:"original_title"`
 	Overview            string                        `json:"overview"`
 	Popularity          float64                       `json:"popularity"`
 	PosterPath          string                        `json:"poster_path"`
 	ProductionCompanies []TmdbProductionCompanySchema `json:"production_companies"`
 	ProductionCountries []TmdbProductionCountrySchema `json:"production_countries"`
-	ReleaseDate         string                        `json:"first_air_date"`
+	ReleaseDate         string                        `json:"release_date"`
 	Revenue             int64                         `json:"revenue"`
 	Runtime             int64                         `json:"runtime"`
 	SpokenLanguages     []TmdbSpokenLanguageSchema    `json:"spoken_languages"`
 	Status              string                        `json:"status"`
 	Tagline             string                        `json:"tagline"`
+	Title               string                        `json:"title"`
 	Video               bool                          `json:"video"`
 	VoteAverage         float64                       `json:"vote_average"`
 	VoteCount           uint64                        `json:"vote_count"`
 }
 
-// IntoMovieInsertable casts the TMDB Api response into insertable item into
-// database, in this case MovieInsertable.
-func (m *TmdbTvSchema) IntoMovieInsertable() *database.MovieInsertable {
+// TmdbMovieCreditsSchema implements TMDB Api schema of `/movie/{id}/credits`.
+type TmdbMovieCreditsSchema struct {
+	Id   uint64                `json:"id"`
+	Cast []database.CastMember `json:"cast"`
+	Crew []database.CrewMember `json:"crew"`
+}
+
+// TmdbMovieKeywordsSchema implements TMDB Api schema of `/movie/{id}/keywords`.
+type TmdbMovieKeywordsSchema struct {
+	Id       uint64            `json:"id"`
+	Keywords []TmdbGenreSchema `json:"keywords"`
+}
+
+// IntoMovieInsertable casts the TMDB Api responses into insertable item into
+// database, in this case MovieInsertable. The credits and the keywords are
+// optional.
+func (m *TmdbMovieSchema) IntoMovieInsertable(credits *TmdbMovieCreditsSchema,
+	keywords *TmdbMovieKeywordsSchema) *database.MovieInsertable {
 	parsedDate, _ := time.Parse("2006-01-02", m.ReleaseDate)
-	return &database.MovieInsertable{
+	mi := &database.MovieInsertable{
 		Budget:              m.Budget,
-		Genres:              []database.Genre{},
-		MovieId:             m.ImdbId,
+		Genres:              mapGenres(m.Genres),
+		MovieId:             m.Id,
 		OriginalLanguage:    m.OriginalLanguage,
-		Title:               m.OriginalTitle,
-		Overview:            m.Overview,
+		Title:               database.Truncate(m.Title, 256),
+		Overview:            database.Truncate(m.Overview, 2048),
 		Popularity:          m.Popularity,
 		ReleaseDate:         parsedDate,
 		Revenue:             m.Revenue,
 		Runtime:             m.Runtime,
 		Status:              m.Status,
-		Tagline:             m.Tagline,
+		Tagline:             database.Truncate(m.Tagline, 128),
 		AverageScore:        m.VoteAverage,
 		TotalScore:          m.VoteCount,
 		ProductionCompanies: mapProductionCompanies(m.ProductionCompanies),
@@ -56,7 +166,31 @@ func (m *TmdbTvSchema) IntoMovieInsertable() *database.MovieInsertable {
 		Keywords:            []database.Keywords{},
 		Cast:                []database.CastMember{},
 		Crew:                []database.CrewMember{},
+		PosterPath:          m.PosterPath,
+		BackdropPath:        m.BackdropPath,
+	}
+	if mi.Title == "" {
+		mi.Title = database.Truncate(m.OriginalTitle, 256)
+	}
+	if !database.MovieStatuses[mi.Status] {
+		mi.Status = "N/A"
+	}
+	if len(mi.OriginalLanguage) != 2 {
+		mi.OriginalLanguage = ""
 	}
+	if credits != nil {
+		mi.Cast = append(mi.Cast, credits.Cast...)
+		mi.Crew = append(mi.Crew, credits.Crew...)
+	}
+	if keywords != nil {
+		for _, k := range keywords.Keywords {
+			var kw database.Keywords
+			kw.Id = uint64(k.ID)
+			kw.Name = k.Name
+			mi.Keywords = append(mi.Keywords, kw)
+		}
+	}
+	return mi
 }
 
 // mapProductionCompanies maps TMDB Api schema into an insertable item.
@@ -66,6 +200,9 @@ func mapProductionCompanies(pcs []TmdbProductionCompanySchema) []database.Produc
 		var pci database.ProductionCompaniesInsertable
 		pci.Id = uint64(v.ID)
 		pci.Name = v.Name
+		if v.LogoPath != nil {
+			pci.LogoPath = *v.LogoPath
+		}
 		out[i] = pci
 	}
 	return out
@@ -111,6 +248,23 @@ type TmdbGenreSchema struct {
 	Name string `json:"name"`
 }
 
+type TmdbNetworkSchema struct {
+	ID            int     `json:"id"`
+	LogoPath      *string `json:"logo_path"`
+	Name          string  `json:"name"`
+	OriginCountry string  `json:"origin_country"`
+}
+
+type TmdbSeasonSchema struct {
+	AirDate      string  `json:"air_date"`
+	EpisodeCount uint64  `json:"episode_count"`
+	Id           uint64  `json:"id"`
+	Name         string  `json:"name"`
+	Overview     string  `json:"overview"`
+	PosterPath   *string `json:"poster_path"`
+	SeasonNumber uint64  `json:"season_number"`
+}
+
 type TmdbProductionCompanySchema struct {
 	ID            int     `json:"id"`
 	LogoPath      *string `json:"logo_path"`
@@ -141,6 +295,8 @@ type TmdbResponseContentSchema struct {
 	TotalResults int                `json:"total_results"`
 }
 
+// TmdbResultSchema is a result of `/search/tv` or `/search/movie`, the fields
+// of the other kind are empty.
 type TmdbResultSchema struct {
 	Adult            bool     `json:"adult"`
 	BackdropPath     *string  `json:"backdrop_path"`
@@ -151,9 +307,12 @@ type TmdbResultSchema struct {
 	OriginCountry    []string `json:"origin_country"`
 	OriginalLanguage string   `json:"original_language"`
 	OriginalName     string   `json:"original_name"`
+	OriginalTitle    string   `json:"original_title"`
 	Overview         string   `json:"overview"`
 	Popularity       float64  `json:"popularity"`
 	PosterPath       *string  `json:"poster_path"`
+	ReleaseDate      string   `json:"release_date"`
+	Title            string   `json:"title"`
 	VoteAverage      float64  `json:"vote_average"`
 	VoteCount        int      `json:"vote_count"`
 }
@@ -32,7 +32,7 @@ export default function MainPanel({ category }) {
     try {
       let url = "";
       if (category === "filmy i seriale") {
-        url = `/v1/api/tv/title/${searchQuery}`;
+        url = `/v1/api/movie/title/${searchQuery}`;
       } else if (category === "ksiazki") {
         url = `/v1/api/book/title/${searchQuery}`;
       }
@@ -67,7 +67,7 @@ export default function MainPanel({ category }) {
 
     const isCurrentlyLiked = liked.includes(id);
     const eventType = isCurrentlyLiked ? "dislike" : "like";
-    const typeMap = { "filmy i seriale": "tv", ksiazki: "book" };
+    const typeMap = { "filmy i seriale": "movie", ksiazki: "book" };
 
     try {
       const response = await fetch("/v1/auth/event/push", {
@@ -43,47 +43,29 @@ export default function Suggestions({ category = "filmy i seriale" }) {
       }
 
       try {
-        // 1. Pobieranie polubień
-        const [respTv, respBooks] = await Promise.all([
-          fetch("/v1/auth/event/pull", {
-            method: "POST",
-            headers: { "Content-Type": "application/json" },
-            body: JSON.stringify({ access_token: token, event: "like", type: "tv" }),
-          }),
-          fetch("/v1/auth/event/pull", {
-            method: "POST",
-            headers: { "Content-Type": "application/json" },
-            body: JSON.stringify({ access_token: token, event: "like", type: "book" }),
-          }),
-        ]);
-
-        const dataTv = await respTv.json();
-        const dataBooks = await respBooks.json();
-
-        const likedItemsForML = [
-          ...(dataTv.content?.items || []).filter((i) => i.type === "tv").map((i) => ({ id: i.id, type: "movie" })),
-          ...(dataBooks.content?.items || []).filter((i) => i.type === "book").map((i) => ({ id: i.id, type: "book" })),
-        ];
-
-        if (likedItemsForML.length === 0) {
-          setLoading(false);
-          return;
-        }
-
-        // 2. Pobranie rekomendacji
-        const recResp = await fetch("/recommend", {
-          method: "POST",
-          headers: { "Content-Type": "application/json" },
-          body: JSON.stringify({
-            user_id: 1,
-            liked_items: likedItemsForML,
-            limit: 6,
-          }),
-        });
+        // Rekomendacje liczy backend na podstawie polubień użytkownika
+        const params = new URLSearchParams({ access_token: token, limit: "6" });
+        const recResp = await fetch(`/v1/api/recommendations?${params}`);
 
         if (recResp.ok) {
           const result = await recResp.json();
-          setRecommendations(result.items || []);
+          const shows = (result.content?.shows || []).map((r) => ({
+            id: r.item.movie_id,
+            type: "movie",
+            title: r.item.title,
+            genres: (r.item.genres || []).map((g) => g.name),
+            score: r.score,
+            reason: r.reason,
+          }));
+          const books = (result.content?.books || []).map((r) => ({
+            id: r.item.id,
+            type: "book",
+            title: r.item.title,
+            genres: [],
+            score: r.score,
+            reason: r.reason,
+          }));
+          setRecommendations([...shows, ...books]);
         }
       } catch (error) {
         console.error(error);
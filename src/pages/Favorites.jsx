@@ -6,9 +6,10 @@ export default function Favorites({ token }) {
   const [allLiked, setAllLiked] = useState([]);
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState("");
+  const [version, setVersion] = useState(0);
 
   const typeMap = {
-    "filmy i seriale": "tv",
+    "filmy i seriale": "movie",
     ksiazki: "book",
   };
 
@@ -75,7 +76,22 @@ export default function Favorites({ token }) {
 
     fetchData();
     return () => controller.abort();
-  }, [token, category]);
+  }, [token, category, version]);
+
+  // Zmiany z innych kart i urządzeń przychodzą strumieniem zdarzeń
+  useEffect(() => {
+    if (!token) return;
+
+    const source = new EventSource(
+      `/v1/auth/event/stream?access_token=${encodeURIComponent(token)}`
+    );
+    const onChange = () => setVersion((v) => v + 1);
+    source.addEventListener("like", onChange);
+    source.addEventListener("dislike", onChange);
+    source.addEventListener("playlist", onChange);
+    source.addEventListener("unplaylist", onChange);
+    return () => source.close();
+  }, [token]);
 
   async function handleUnlike(id) {
     const originalList = [...allLiked];